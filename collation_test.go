@@ -0,0 +1,77 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"fmt"
+	"testing"
+)
+
+var personName = core.AttrInfo{Name: "Name", Type: core.STRING}
+
+// Returns the values of the first column, which is a STRING column, in the order of the rows.
+func stringValues(rel core.Relationer) []string {
+	values := make([]string, 0)
+	for _, row := range rowValues(rel) {
+		values = append(values, row[0].(string))
+	}
+	return values
+}
+
+// Creates the relation "personen" with names differing in case, umlauts and accents.
+func createPersonen(cs *core.ColumnStore) core.Relationer {
+	personen := cs.CreateRelation("personen", []core.AttrInfo{personName})
+	for _, name := range []string{"Müller", "Mueller", "Muller", "mahler", "Mahler", "Ärger", "Arzt", "Ahorn", "Straße", "Strasse", "école", "Ecke"} {
+		personen.Insert([][]interface{}{{name}})
+	}
+	return personen
+}
+
+// Checks the order and equality of the collations. Equal values keep the order of their rows.
+func TestCollations(t *testing.T) {
+	cs := new(core.ColumnStore)
+	personen := createPersonen(cs)
+
+	tests := []struct {
+		coll  core.Collation
+		order []string
+		// the value compared with EQ and the names equal to it
+		equal   string
+		matches []string
+	}{
+		{core.BINARY,
+			[]string{"Ahorn", "Arzt", "Ecke", "Mahler", "Mueller", "Muller", "Müller", "Strasse", "Straße", "mahler", "Ärger", "école"},
+			"Müller", []string{"Müller"}},
+		{core.NOCASE,
+			[]string{"Ahorn", "Arzt", "Ecke", "mahler", "Mahler", "Mueller", "Muller", "Müller", "Strasse", "Straße", "Ärger", "école"},
+			"MÜLLER", []string{"Müller"}},
+		{core.DE_DE,
+			[]string{"Ahorn", "Ärger", "Arzt", "Ecke", "école", "mahler", "Mahler", "Mueller", "Müller", "Muller", "Straße", "Strasse"},
+			"MULLER", []string{"Müller", "Muller"}},
+		{core.DE_DE_PHONEBOOK,
+			[]string{"Ärger", "Ahorn", "Arzt", "Ecke", "école", "mahler", "Mahler", "Müller", "Mueller", "Muller", "Straße", "Strasse"},
+			"mueller", []string{"Müller", "Mueller"}},
+	}
+	for _, test := range tests {
+		collated := personen.Collate(personName, test.coll)
+		if got := stringValues(collated.OrderBy(personName, false)); fmt.Sprint(got) != fmt.Sprint(test.order) {
+			t.Errorf("%q orders the names %v instead of %v.", test.coll, got, test.order)
+		}
+		if got := stringValues(collated.Select(personName, core.EQ, test.equal)); fmt.Sprint(got) != fmt.Sprint(test.matches) {
+			t.Errorf("%q finds %v equal to %s instead of %v.", test.coll, got, test.equal, test.matches)
+		}
+	}
+
+	// Collate only changes its query, SetCollation all later queries
+	binary := tests[0].order
+	if got := stringValues(personen.OrderBy(personName, false)); fmt.Sprint(got) != fmt.Sprint(binary) {
+		t.Errorf("The relation orders the names %v after Collate instead of %v.", got, binary)
+	}
+	personen.SetCollation(personName, core.DE_DE_PHONEBOOK)
+	phonebook := tests[3].order
+	if got := stringValues(personen.OrderBy(personName, false)); fmt.Sprint(got) != fmt.Sprint(phonebook) {
+		t.Errorf("The relation orders the names %v after SetCollation instead of %v.", got, phonebook)
+	}
+	if got := stringValues(personen.MakeIndex(personName, core.ORDERED).IndexScanWhere(core.Compare(personName, core.GE, "Ä"))); fmt.Sprint(got) != fmt.Sprint(phonebook) {
+		t.Errorf("The ordered index returns the names %v instead of %v.", got, phonebook)
+	}
+}
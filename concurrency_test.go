@@ -0,0 +1,94 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Counts the rows of the relationer by pulling its batches.
+func countRows(rel core.Relationer) int {
+	it := rel.Iterator()
+	it.Open()
+	defer it.Close()
+	rows := 0
+	for batch := it.Next(); batch != nil; batch = it.Next() {
+		rows += batch.RowCount()
+	}
+	return rows
+}
+
+// Runs queries on the same relations while other goroutines build and drop indexes, collate
+// columns, analyze the relations, change rows and add relations to the store. Run with -race.
+func TestConcurrentQueries(t *testing.T) {
+	var cs = new(core.ColumnStore)
+	cs.Load("students.csv", ',')
+	cs.Load("noten.csv", ',')
+	alter := core.AttrInfo{Name: "Alter"}
+	expected := countRows(cs.GetRelation("students").Select(alter, core.GT, 22))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				students := cs.GetRelation("students")
+				if rows := countRows(students.Select(alter, core.GT, 22)); rows != expected {
+					t.Errorf("Select returned %d rows instead of %d.", rows, expected)
+				}
+				if rows := countRows(students.IndexScanWhere(core.Compare(alter, core.GT, 22))); rows != expected {
+					t.Errorf("IndexScanWhere returned %d rows instead of %d.", rows, expected)
+				}
+				students.OrderBy(alter, false).Materialize()
+				students.SelectWhere(core.Match(core.AttrInfo{Name: "Nachname"}, "meyer OR müller")).Materialize()
+				cs.HashJoin("students", core.AttrInfo{Name: "Durchschnitt"}, "noten", core.AttrInfo{Name: "Note"}, core.EQ).Materialize()
+				cs.IndexRangeJoin("students", core.AttrInfo{Name: "Durchschnitt"}, "noten", core.AttrInfo{Name: "Note"}, core.LE).Materialize()
+				students.Indexes()
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		students := cs.GetRelation("students")
+		for i := 0; i < 50; i++ {
+			for _, kind := range []core.IndexKind{core.HASH, core.ORDERED, core.BITMAP} {
+				name := fmt.Sprintf("alter_%d_%s", i, kind)
+				students.CreateIndex(name, alter, kind)
+				students.DropIndex(name)
+			}
+			students.MakeIndex(core.AttrInfo{Name: "Nachname"}, core.FULLTEXT)
+			cs.GetRelation("noten").MakeIndex(core.AttrInfo{Name: "Note"}, core.ORDERED)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		note := core.AttrInfo{Name: "Note"}
+		for i := 0; i < 50; i++ {
+			noten := cs.GetRelation("noten")
+			noten.Insert([][]interface{}{{9.0, "ungültig"}, {9.5, nil}})
+			noten.Update(core.Compare(note, core.EQ, 9.5), []core.NamedExpr{{Name: "Beschreibung", Expr: core.Const("ungültig")}})
+			noten.Delete(core.Compare(note, core.GE, 9.0))
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			coll := core.NOCASE
+			if i%2 == 1 {
+				coll = core.BINARY
+			}
+			cs.GetRelation("students").SetCollation(core.AttrInfo{Name: "Nachname"}, coll)
+			cs.GetRelation("students").Analyze()
+			cs.CreateRelation(fmt.Sprintf("empty_%d", i), []core.AttrInfo{{Name: "ID", Type: core.INT}})
+		}
+	}()
+	wg.Wait()
+}
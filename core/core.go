@@ -1,5 +1,10 @@
 package core
 
+import (
+	"sync"
+	"time"
+)
+
 /*
 	The comparison operators for filter operators.
 */
@@ -12,8 +17,86 @@ const (
 	GT  Comparison = ">"
 	LE  Comparison = "<="
 	GE  Comparison = ">="
+
+	// Pattern comparisons, only supported for STRING columns.
+	LIKE        Comparison = "LIKE"        // SQL pattern, % matches any sequence and _ a single character, \ escapes them
+	ILIKE       Comparison = "ILIKE"       // like LIKE but case insensitive
+	STARTS_WITH Comparison = "STARTS_WITH" // the value starts with the compared string
+	CONTAINS    Comparison = "CONTAINS"    // the value contains the compared string
+	REGEXP      Comparison = "REGEXP"      // the value matches the compared regular expression
+)
+
+/*
+	The kinds of joins supported by ColumnStorer.Join.
+*/
+type JoinKind string
+
+const (
+	INNER JoinKind = "INNER" // the pairs of matching rows of both relations
+	LEFT  JoinKind = "LEFT"  // like INNER, left rows without a match are kept with NULL values for the right columns
+	SEMI  JoinKind = "SEMI"  // the left rows with at least one match, only the left columns
+	ANTI  JoinKind = "ANTI"  // the left rows without a match, only the left columns
+)
+
+/*
+	The kinds of indexes built by Relationer.MakeIndex.
+*/
+type IndexKind string
+
+const (
+	HASH     IndexKind = "HASH"     // a hash map from the values to their rows, only for equality lookups
+	ORDERED  IndexKind = "ORDERED"  // the rows sorted by their values, for ranges and ordered iteration
+	BITMAP   IndexKind = "BITMAP"   // a compressed bitmap of the rows of every value, for columns with few distinct values
+	FULLTEXT IndexKind = "FULLTEXT" // the rows and positions of the tokens of STRING columns, for Match predicates
+)
+
+/*
+	The ways a Tokenizer splits texts into tokens.
+*/
+type TokenSplit string
+
+const (
+	WHITESPACE TokenSplit = "WHITESPACE" // tokens are separated by white space, punctuation stays part of the tokens
+	WORDS      TokenSplit = "WORDS"      // tokens are the words between Unicode word boundaries, made of letters and digits
 )
 
+/*
+	A Tokenizer splits the values of STRING columns into the tokens of FULLTEXT indexes and Match queries.
+*/
+type Tokenizer struct {
+	Split     TokenSplit
+	Lowercase bool
+	// Reduces German words to their stems, e.g., "Häuser" and "Haus" have the same stem.
+	Stemming bool
+}
+
+/*
+	The tokenizer of FULLTEXT indexes built by MakeIndex and CreateIndex and of Match predicates
+	on columns without FULLTEXT index.
+*/
+var DefaultTokenizer = Tokenizer{Split: WORDS, Lowercase: true}
+
+/*
+	The condition of a join, it is true for the rows where "Left Comp Right" holds.
+*/
+type JoinCondition struct {
+	Left  AttrInfo
+	Comp  Comparison
+	Right AttrInfo
+}
+
+/*
+	A predicate of a multi-way join. It compares the column Left of the relation with the name
+	LeftRelation with the column Right of the relation with the name RightRelation.
+*/
+type JoinPredicate struct {
+	LeftRelation  string
+	Left          AttrInfo
+	Comp          Comparison
+	RightRelation string
+	Right         AttrInfo
+}
+
 /*
 	The supported data types of the Column Store.
 */
@@ -25,48 +108,164 @@ const (
 	STRING
 )
 
+/*
+	The collations for comparing and sorting STRING columns.
+*/
+type Collation string
+
+const (
+	BINARY          Collation = ""                // byte order of the strings, the default
+	NOCASE          Collation = "NOCASE"          // case insensitive byte order
+	DE_DE           Collation = "de-DE"           // German dictionary order, case insensitive, ä sorts as a
+	DE_DE_PHONEBOOK Collation = "de-DE-phonebook" // German phonebook order, case insensitive, ä sorts as ae
+)
+
 /*
 	The AttrInfo structure stores metainformation about a column, e.g., the name, type and encryption used in a column.
+	The collation is only used for STRING columns.
 */
 type AttrInfo struct {
-	Name string
-	Type DataTypes
+	Name      string
+	Type      DataTypes
+	Collation Collation
 }
 
 /*
 	The column structure stores the actual data of a column in a relation.
+	Columns created by operators like Select or the joins share the data of their input and
+	only store a selection vector with the positions of their rows inside the data.
 */
 type Column struct {
 	Signature AttrInfo
-	Data      interface{}
+	Data      ColumnData
 	Index     map[interface{}][]int
+	// Selection vector into Data, nil if the column is materialized.
+	rows []int
+	// Marks the positions inside Data that are NULL, nil if the column has no NULL values.
+	nulls []bool
+	// The minimum, maximum and NULL values of the blocks of Data, nil until the relation is analyzed.
+	zones []zone
+	// The ordered index of the column, nil if there is none.
+	ordered rangeIndex
+	// The bitmap index of the column, nil if there is none.
+	bitmaps *bitmapIndex
+	// The full-text index of the column, nil if there is none.
+	fulltext *fulltextIndex
 }
 
 /*
 	The actual structure for a Relation. It contains the name of the relation and a collection
 	of the columns.
+	Relations are safe for concurrent use: queries read a snapshot of the columns, changes of the
+	indexes, collations and statistics replace the columns instead of changing them in place.
+	Inserted rows are appended to the delta, which is merged into the main columns in the background.
 */
 type Relation struct {
 	Name    string
 	Columns []Column
+	// The statistics of the columns by their names, nil until the relation is analyzed.
+	stats map[string]*columnStats
+	// The catalog of the indexes on the columns in the order they were created.
+	indexes []*indexInfo
+	// Guards the columns, the statistics and the catalog.
+	mu sync.RWMutex
+	// The relation this relation is a snapshot of, nil if it is no snapshot.
+	source *Relation
+	// The deleted rows that are not removed by a compaction yet, nil if no row is deleted. The
+	// bitmap is replaced by changes, so snapshots keep their deleted rows.
+	deleted *bitmap
+	// The data of the columns is not shared with other relations, so merges append rows in place.
+	ownsData bool
+	// The rows inserted since the last merge, their positions follow the rows of the columns.
+	// Columns without zone maps and indexes, nil if the delta is empty.
+	delta []Column
+	// The data of the delta is not shared with other relations, so rows are appended in place.
+	ownsDelta bool
+	// A merge of the delta runs in the background.
+	merging bool
+	// Held while the delta is merged, so only one merge extends the data at a time.
+	mergeMu sync.Mutex
+	// The log of the store the changes are written to, nil if the store has no directory.
+	log *writeAheadLog
+	// The sequence number of the last logged change of the relation.
+	lsn int64
+	// The number of running transactions seeing the relation. The relation is not compacted
+	// while they run, so the positions of their rows stay valid.
+	pins int
+	// The history the changes of the relation are recorded in, nil if it is not part of a store.
+	history *history
+	// The relation is a version of the history, its rows can not be changed.
+	readOnly bool
 }
 
 /*
 	The Relationer interface defines an interface for operations that can be executed on a Relation.
-	These methods implements in- and output and query operators.
+	These methods implements in- and output and query operators. The operations changing the rows
+	or the indexes exit for the results of queries, only relations can be changed.
 */
 type Relationer interface {
 	Scan(colList []AttrInfo) Relationer
 	Select(col AttrInfo, comp Comparison, compVal interface{}) Relationer
+	SelectWhere(pred Predicate) Relationer
+	OrderBy(col AttrInfo, descending bool) Relationer
+	Project(exprs []NamedExpr) Relationer
+	// Like Project, but returns the type errors of the expressions instead of exiting.
+	ProjectChecked(exprs []NamedExpr) (Relationer, error)
+	// Compares, sorts and joins the values of the STRING column with the collation in this query only.
+	Collate(col AttrInfo, coll Collation) Relationer
+	// Sets the collation of the STRING column for all later queries on the relation and rebuilds its indexes.
+	SetCollation(col AttrInfo, coll Collation) Relationer
 	Print()
-	MakeIndex(indexCol AttrInfo) Relationer
+	// Builds an index of the passed kind on the column, a HASH index if no kind is passed.
+	MakeIndex(indexCol AttrInfo, kind ...IndexKind) Relationer
+	// Creates a named index of the passed kind on the column.
+	CreateIndex(name string, col AttrInfo, kind IndexKind) Relationer
+	// Creates a named FULLTEXT index on the STRING column that splits the values with the tokenizer.
+	CreateFullTextIndex(name string, col AttrInfo, tokenizer Tokenizer) Relationer
+	// Removes the index with the passed name.
+	DropIndex(name string) Relationer
+	// Returns the indexes with their names, columns, kinds and sizes as a relation.
+	Indexes() Relationer
+	// Appends the rows, the values are in the order of the columns and nil for NULL.
+	Insert(rows [][]interface{}) Relationer
+	// Appends the rows of the batch, its columns are matched with the columns by their names.
+	InsertColumns(batch *Batch) Relationer
+	// Sets the columns of the rows meeting the predicate to the values of the expressions.
+	Update(pred Predicate, assignments []NamedExpr) Relationer
+	// Removes the rows meeting the predicate.
+	Delete(pred Predicate) Relationer
+	// Returns the rows where the column equals the key. Columns without index are filtered like Select.
 	IndexScan(col AttrInfo, key interface{}) Relationer
+	// Returns the rows meeting a comparison or a between predicate on one column in the order of
+	// the values of the column if the column has an ORDERED index. Predicates combining
+	// comparisons, In and IsNull on several columns with And, Or and Not are evaluated on the
+	// BITMAP indexes of their columns, Match predicates on FULLTEXT indexes. Predicates without
+	// suitable indexes are evaluated like Select.
+	IndexScanWhere(pred Predicate) Relationer
+	// Runs the operators and returns a relation holding their result.
+	Materialize() Relationer
+	// Runs the operators and writes their result into a csv file.
+	Export(csvFile string, separator rune)
+	// Returns an iterator producing the rows in batches.
+	Iterator() Iterator
+	// Returns the optimized plan of the operators with the chosen algorithms and estimated row counts.
+	Explain() string
+	// Returns the plan of Explain in JSON.
+	ExplainJSON() string
+	// Runs the operators and returns the plan with the actual rows, time and allocated memory of every operator.
+	ExplainAnalyze() string
+	// Returns the result of ExplainAnalyze in JSON.
+	ExplainAnalyzeJSON() string
+	// Collects the statistics of the columns used by the optimizer and returns them as a relation.
+	Analyze() Relationer
 	// Package intern possibility to get the columns from a Relationer
 	columns() []Column
 	// Package intern helper to get the index of a specific column
 	findColumn(col AttrInfo) int
 	// Package intern helper to get the number of rows
 	rowCount() int
+	// Package intern helper to get the signatures of the columns without running any operator
+	schema() []AttrInfo
 }
 
 /*
@@ -75,6 +274,14 @@ type Relationer interface {
 type ColumnStore struct {
 	// Made private so it can't be accessed from outside.
 	relations map[string]Relationer
+	// Guards the map of relations, the store is safe for concurrent use.
+	mu sync.RWMutex
+	// The log of the directory opened by Open, nil if no directory is opened.
+	log *writeAheadLog
+	// Held while a transaction commits, so transactions never see half of a commit.
+	commitMu sync.RWMutex
+	// The versions of the relations for time travel queries, nil until a relation is added.
+	history *history
 }
 
 /*
@@ -103,7 +310,70 @@ type ColumnStorer interface {
 
 	IndexNestedLoopJoin(leftRelation string, leftCol AttrInfo, rightRelation string, rightCol AttrInfo) Relationer
 
+	/*
+		Joins the rows where "right value comp left value" holds with an index on the right column
+		like IndexNestedLoopJoin, which only joins equal values. Comparisons other than EQ need
+		an ORDERED index, which is built for the query if the column has none.
+	*/
+	IndexRangeJoin(leftRelation string, leftCol AttrInfo, rightRelation string, rightCol AttrInfo, comp Comparison) Relationer
+
 	HashJoin(leftRelation string, leftCol AttrInfo, rightRelation string, rightCol AttrInfo, comp Comparison) Relationer
 
     ParallelHashJoin(leftRelation string, leftCol AttrInfo, rightRelation string, rightCol AttrInfo, comp Comparison) Relationer
+
+	/*
+		Joins two relations. The physical algorithm and the side the hash table or index is built on
+		are chosen by the optimizer from the sizes of the inputs, the comparison and the existing
+		indexes. Explain shows the choice.
+	*/
+	Join(left Relationer, right Relationer, cond JoinCondition, kind JoinKind) Relationer
+
+	/*
+		Joins all passed relations, the keys of the map are the names used by the predicates. The
+		columns of the result are named "<relation name>.<column name>". The order of the joins is
+		chosen by the optimizer, all relations have to be connected by the predicates.
+	*/
+	MultiJoin(relations map[string]Relationer, preds []JoinPredicate) Relationer
+
+	/*
+		Writes all relations with their indexes into the directory.
+	*/
+	Save(dir string)
+
+	/*
+		Reads the relations written by Save from the directory, their indexes can be used at once.
+	*/
+	Open(dir string)
+
+	/*
+		Starts a transaction that sees the relations as they are now.
+	*/
+	Begin() *Transaction
+
+	/*
+		Returns the relation as it was at the passed time. The relation is read-only and can be
+		used by all operators and joins.
+	*/
+	GetRelationAsOf(relName string, asOf time.Time) Relationer
+
+	/*
+		Returns the relation as it was after the commit with the passed number.
+	*/
+	GetRelationAtCommit(relName string, commit int64) Relationer
+
+	/*
+		Sets how long the versions of the relations are kept for time travel queries after
+		they were replaced.
+	*/
+	SetRetention(retention time.Duration)
+
+	/*
+		Sets how many versions of every relation are kept for time travel queries at most.
+	*/
+	SetMaxVersions(versions int)
+
+	/*
+		Returns the versions of the relations kept for time travel queries with their commits.
+	*/
+	Snapshots() Relationer
 }
@@ -0,0 +1,559 @@
+package core
+
+/*
+	Bitmap indexes store the rows of every value of a column as compressed bitmap. They are meant
+	for columns with few distinct values. Predicates combining comparisons on several bitmap
+	indexed columns with And, Or and Not are evaluated with bitwise operations on the bitmaps,
+	so Select and IndexScanWhere never look at the column data and the number of matching rows
+	is known before any row is read. The rows of Match predicates on columns with FULLTEXT index
+	are combined with the bitmaps as well.
+
+	The bitmaps are compressed like roaring bitmaps: the rows are split into chunks of 2^16 rows
+	by their high bits, sparse chunks store the sorted low bits of their rows, dense chunks a
+	bitset of 2^16 bits.
+*/
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// The maximum number of rows of a chunk stored as array, larger chunks are stored as bitset.
+const bitmapArrayMax = 4096
+
+// The number of words of the bitset of a dense chunk.
+const bitmapWords = 1 << 16 / 64
+
+// A compressed set of rows. The chunks are sorted by their keys, the high bits of their rows.
+type bitmap struct {
+	keys   []uint32
+	chunks []*bitmapChunk
+}
+
+// The rows of a chunk, either as sorted array of their low bits or as bitset.
+type bitmapChunk struct {
+	array []uint16
+	bits  []uint64
+	count int
+}
+
+// Returns a bitmap with the rows 0 to n-1.
+func fullBitmap(n int) *bitmap {
+	b := &bitmap{}
+	for start := 0; start < n; start += 1 << 16 {
+		chunk := &bitmapChunk{bits: make([]uint64, bitmapWords), count: minimum(n-start, 1<<16)}
+		for w := 0; w < chunk.count/64; w++ {
+			chunk.bits[w] = ^uint64(0)
+		}
+		if rest := chunk.count % 64; rest > 0 {
+			chunk.bits[chunk.count/64] = 1<<rest - 1
+		}
+		b.keys = append(b.keys, uint32(start>>16))
+		b.chunks = append(b.chunks, chunk.compact())
+	}
+	return b
+}
+
+// Adds the row to the bitmap. The rows have to be added in ascending order.
+func (b *bitmap) add(row int) {
+	key, low := uint32(row>>16), uint16(row)
+	if len(b.keys) == 0 || b.keys[len(b.keys)-1] != key {
+		b.keys = append(b.keys, key)
+		b.chunks = append(b.chunks, &bitmapChunk{})
+	}
+	chunk := b.chunks[len(b.chunks)-1]
+	if chunk.bits == nil && len(chunk.array) == bitmapArrayMax {
+		chunk.bits = chunk.bitset()
+		chunk.array = nil
+	}
+	if chunk.bits != nil {
+		chunk.bits[low/64] |= 1 << (low % 64)
+	} else {
+		chunk.array = append(chunk.array, low)
+	}
+	chunk.count++
+}
+
+// Returns the number of rows of the bitmap.
+func (b *bitmap) cardinality() int {
+	count := 0
+	for _, chunk := range b.chunks {
+		count += chunk.count
+	}
+	return count
+}
+
+// Checks if the row is part of the bitmap.
+func (b *bitmap) contains(row int) bool {
+	key := uint32(row >> 16)
+	i := sort.Search(len(b.keys), func(i int) bool { return b.keys[i] >= key })
+	return i < len(b.keys) && b.keys[i] == key && b.chunks[i].contains(uint16(row))
+}
+
+// Returns the rows of the bitmap in ascending order.
+func (b *bitmap) rows() []int {
+	result := make([]int, 0, b.cardinality())
+	for c, chunk := range b.chunks {
+		high := int(b.keys[c]) << 16
+		if chunk.bits == nil {
+			for _, low := range chunk.array {
+				result = append(result, high|int(low))
+			}
+			continue
+		}
+		for w, word := range chunk.bits {
+			for word != 0 {
+				result = append(result, high|w*64+bits.TrailingZeros64(word))
+				word &= word - 1
+			}
+		}
+	}
+	return result
+}
+
+// Returns the rows that are in both bitmaps.
+func (b *bitmap) and(other *bitmap) *bitmap {
+	result := &bitmap{}
+	for i, j := 0, 0; i < len(b.keys) && j < len(other.keys); {
+		switch {
+		case b.keys[i] < other.keys[j]:
+			i++
+		case b.keys[i] > other.keys[j]:
+			j++
+		default:
+			result.append(b.keys[i], andChunks(b.chunks[i], other.chunks[j]))
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// Returns the rows that are in one of the bitmaps.
+func (b *bitmap) or(other *bitmap) *bitmap {
+	result := &bitmap{}
+	i, j := 0, 0
+	for i < len(b.keys) || j < len(other.keys) {
+		switch {
+		case j == len(other.keys) || (i < len(b.keys) && b.keys[i] < other.keys[j]):
+			result.append(b.keys[i], b.chunks[i])
+			i++
+		case i == len(b.keys) || b.keys[i] > other.keys[j]:
+			result.append(other.keys[j], other.chunks[j])
+			j++
+		default:
+			result.append(b.keys[i], orChunks(b.chunks[i], other.chunks[j]))
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// Returns the rows of the bitmap that are not in the other bitmap.
+func (b *bitmap) andNot(other *bitmap) *bitmap {
+	result := &bitmap{}
+	j := 0
+	for i, key := range b.keys {
+		for j < len(other.keys) && other.keys[j] < key {
+			j++
+		}
+		if j < len(other.keys) && other.keys[j] == key {
+			result.append(key, andNotChunks(b.chunks[i], other.chunks[j]))
+		} else {
+			result.append(key, b.chunks[i])
+		}
+	}
+	return result
+}
+
+// Appends the chunk with the passed key if it is not empty. Chunks are shared between bitmaps
+// since they are never changed after the bitmap is built.
+func (b *bitmap) append(key uint32, chunk *bitmapChunk) {
+	if chunk.count > 0 {
+		b.keys = append(b.keys, key)
+		b.chunks = append(b.chunks, chunk)
+	}
+}
+
+// Returns the rows of the chunk as bitset.
+func (c *bitmapChunk) bitset() []uint64 {
+	if c.bits != nil {
+		return c.bits
+	}
+	words := make([]uint64, bitmapWords)
+	for _, low := range c.array {
+		words[low/64] |= 1 << (low % 64)
+	}
+	return words
+}
+
+// Checks if the row with the passed low bits is part of the chunk.
+func (c *bitmapChunk) contains(low uint16) bool {
+	if c.bits != nil {
+		return c.bits[low/64]&(1<<(low%64)) != 0
+	}
+	pos := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+	return pos < len(c.array) && c.array[pos] == low
+}
+
+// Counts the rows of a bitset chunk and stores sparse chunks as array.
+func (c *bitmapChunk) compact() *bitmapChunk {
+	if c.bits == nil {
+		c.count = len(c.array)
+		return c
+	}
+	c.count = 0
+	for _, word := range c.bits {
+		c.count += bits.OnesCount64(word)
+	}
+	if c.count > bitmapArrayMax {
+		return c
+	}
+	array := make([]uint16, 0, c.count)
+	for w, word := range c.bits {
+		for word != 0 {
+			array = append(array, uint16(w*64+bits.TrailingZeros64(word)))
+			word &= word - 1
+		}
+	}
+	return &bitmapChunk{array: array, count: len(array)}
+}
+
+func andChunks(a, b *bitmapChunk) *bitmapChunk {
+	if a.bits != nil && b.bits != nil {
+		words := make([]uint64, bitmapWords)
+		for w := range words {
+			words[w] = a.bits[w] & b.bits[w]
+		}
+		return (&bitmapChunk{bits: words}).compact()
+	}
+	if a.bits != nil {
+		a, b = b, a
+	}
+	// the rows of the array that are also in the other chunk
+	array := make([]uint16, 0)
+	for _, low := range a.array {
+		if b.contains(low) {
+			array = append(array, low)
+		}
+	}
+	return (&bitmapChunk{array: array}).compact()
+}
+
+func orChunks(a, b *bitmapChunk) *bitmapChunk {
+	if a.bits == nil && b.bits == nil && a.count+b.count <= bitmapArrayMax {
+		array := make([]uint16, 0, a.count+b.count)
+		i, j := 0, 0
+		for i < len(a.array) || j < len(b.array) {
+			switch {
+			case j == len(b.array) || (i < len(a.array) && a.array[i] < b.array[j]):
+				array = append(array, a.array[i])
+				i++
+			case i == len(a.array) || a.array[i] > b.array[j]:
+				array = append(array, b.array[j])
+				j++
+			default:
+				array = append(array, a.array[i])
+				i++
+				j++
+			}
+		}
+		return (&bitmapChunk{array: array}).compact()
+	}
+	words := make([]uint64, bitmapWords)
+	abits, bbits := a.bitset(), b.bitset()
+	for w := range words {
+		words[w] = abits[w] | bbits[w]
+	}
+	return (&bitmapChunk{bits: words}).compact()
+}
+
+func andNotChunks(a, b *bitmapChunk) *bitmapChunk {
+	if a.bits == nil {
+		array := make([]uint16, 0)
+		for _, low := range a.array {
+			if !b.contains(low) {
+				array = append(array, low)
+			}
+		}
+		return (&bitmapChunk{array: array}).compact()
+	}
+	words := make([]uint64, bitmapWords)
+	bbits := b.bitset()
+	for w := range words {
+		words[w] = a.bits[w] &^ bbits[w]
+	}
+	return (&bitmapChunk{bits: words}).compact()
+}
+
+// The bitmaps of the rows of every value of a column and of its NULL rows.
+type bitmapIndex struct {
+	values map[interface{}]*bitmap
+	nulls  *bitmap
+}
+
+// Builds the bitmap index of the column if it has none.
+func (col *Column) createBitmapIndex() {
+	if col.bitmaps != nil {
+		return
+	}
+	col.bitmaps = &bitmapIndex{values: make(map[interface{}]*bitmap), nulls: &bitmap{}}
+	for i := 0; i < col.length(); i++ {
+		col.bitmaps.add(i, col)
+	}
+}
+
+// Adds the i-th row of the column to the bitmap of its value. The rows have to be added in ascending order.
+func (idx *bitmapIndex) add(i int, col *Column) {
+	if col.isNull(i) {
+		idx.nulls.add(i)
+		return
+	}
+	key := col.indexKey(col.valueAt(i))
+	if idx.values[key] == nil {
+		idx.values[key] = &bitmap{}
+	}
+	idx.values[key].add(i)
+}
+
+// Returns a copy of the index that rows can be added to without changing this index.
+func (idx *bitmapIndex) copy() *bitmapIndex {
+	result := &bitmapIndex{values: make(map[interface{}]*bitmap, len(idx.values)), nulls: idx.nulls.appendable()}
+	for key, rows := range idx.values {
+		result.values[key] = rows.appendable()
+	}
+	return result
+}
+
+// Returns a copy of the bitmap that rows can be added to without changing this bitmap. Adding
+// rows only changes the last chunk, the other chunks are shared.
+func (b *bitmap) appendable() *bitmap {
+	n := len(b.keys)
+	result := &bitmap{keys: b.keys[:n:n], chunks: b.chunks[:n:n]}
+	if n > 0 {
+		last := *b.chunks[n-1]
+		last.array = last.array[:len(last.array):len(last.array)]
+		last.bits = append([]uint64(nil), last.bits...)
+		result.chunks = append(b.chunks[:n-1:n-1], &last)
+	}
+	return result
+}
+
+// Returns the rows whose values meet "value comp compVal". NULL values never match.
+func (idx *bitmapIndex) compare(comp Comparison, compVal interface{}) *bitmap {
+	if comp == EQ {
+		if rows, ok := idx.values[compVal]; ok {
+			return rows
+		}
+		return &bitmap{}
+	}
+	result := &bitmap{}
+	for key, rows := range idx.values {
+		if order, ok := compareValues(key, compVal); ok && compareOrder(comp, order) {
+			result = result.or(rows)
+		}
+	}
+	return result
+}
+
+// Checks if the order of two values meets the comparison.
+func compareOrder(comp Comparison, order int) bool {
+	switch comp {
+	case EQ:
+		return order == 0
+	case NEQ:
+		return order != 0
+	case LT:
+		return order < 0
+	case LE:
+		return order <= 0
+	case GT:
+		return order > 0
+	case GE:
+		return order >= 0
+	}
+	return false
+}
+
+// Returns the rows of the columns meeting the predicate from the bitmap indexes. Returns false if
+// a column of the predicate has no bitmap index or the predicate can not be evaluated on bitmaps.
+func bitmapOf(cols []Column, pred Predicate) (*bitmap, bool) {
+	switch p := pred.(type) {
+	case *comparePredicate:
+		col, ok := bitmapColumn(cols, p.col)
+		if !ok || !(indexComparison(p.comp) || p.comp == NEQ) {
+			return nil, false
+		}
+		return col.bitmaps.compare(p.comp, col.bitmapKey(p.compVal)), true
+	case *inPredicate:
+		col, ok := bitmapColumn(cols, p.col)
+		if !ok {
+			return nil, false
+		}
+		result := &bitmap{}
+		for _, value := range p.values {
+			result = result.or(col.bitmaps.compare(EQ, col.bitmapKey(value)))
+		}
+		return result, true
+	case *betweenPredicate:
+		return bitmapOf(cols, And(Compare(p.col, GE, p.lo), Compare(p.col, LE, p.hi)))
+	case *isNullPredicate:
+		col, ok := bitmapColumn(cols, p.col)
+		if !ok {
+			return nil, false
+		}
+		return col.bitmaps.nulls, true
+	case *andPredicate:
+		return combineBitmaps(cols, p.preds, (*bitmap).and)
+	case *orPredicate:
+		return combineBitmaps(cols, p.preds, (*bitmap).or)
+	case *notPredicate:
+		inner, ok := bitmapOf(cols, p.pred)
+		if !ok {
+			return nil, false
+		}
+		unknown, ok := unknownBitmap(cols, p.pred)
+		if !ok {
+			return nil, false
+		}
+		return fullBitmap(cols[0].length()).andNot(inner.or(unknown)), true
+	case *matchPredicate:
+		idx := columnIndex(cols, p.col)
+		if cols[idx].fulltext == nil {
+			return nil, false
+		}
+		result := &bitmap{}
+		for _, row := range cols[idx].fulltext.search(p.terms) {
+			result.add(row)
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// Returns the rows where the predicate is unknown, because a compared value is NULL, like the
+// unknown method of the predicate. Returns false like bitmapOf.
+func unknownBitmap(cols []Column, pred Predicate) (*bitmap, bool) {
+	switch p := pred.(type) {
+	case *comparePredicate, *inPredicate, *betweenPredicate:
+		col, ok := bitmapColumn(cols, pred.attrs()[0])
+		if !ok {
+			return nil, false
+		}
+		return col.bitmaps.nulls, true
+	case *isNullPredicate:
+		return &bitmap{}, true
+	case *andPredicate:
+		// none of the predicates is false and one is unknown
+		possible, met := fullBitmap(cols[0].length()), fullBitmap(cols[0].length())
+		for _, part := range p.preds {
+			rows, ok := bitmapOf(cols, part)
+			if !ok {
+				return nil, false
+			}
+			unknown, ok := unknownBitmap(cols, part)
+			if !ok {
+				return nil, false
+			}
+			possible, met = possible.and(rows.or(unknown)), met.and(rows)
+		}
+		return possible.andNot(met), true
+	case *orPredicate:
+		// none of the predicates is true and one is unknown
+		unknown, met := &bitmap{}, &bitmap{}
+		for _, part := range p.preds {
+			rows, ok := bitmapOf(cols, part)
+			if !ok {
+				return nil, false
+			}
+			partUnknown, ok := unknownBitmap(cols, part)
+			if !ok {
+				return nil, false
+			}
+			unknown, met = unknown.or(partUnknown), met.or(rows)
+		}
+		return unknown.andNot(met), true
+	case *notPredicate:
+		return unknownBitmap(cols, p.pred)
+	case *matchPredicate:
+		col := cols[columnIndex(cols, p.col)]
+		result := &bitmap{}
+		for row := 0; row < col.length(); row++ {
+			if col.isNull(row) {
+				result.add(row)
+			}
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// Combines the bitmaps of the predicates with the passed operation.
+func combineBitmaps(cols []Column, preds []Predicate, op func(*bitmap, *bitmap) *bitmap) (*bitmap, bool) {
+	if len(preds) == 0 {
+		return nil, false
+	}
+	result, ok := bitmapOf(cols, preds[0])
+	for _, pred := range preds[1:] {
+		if !ok {
+			return nil, false
+		}
+		var rows *bitmap
+		if rows, ok = bitmapOf(cols, pred); ok {
+			result = op(result, rows)
+		}
+	}
+	return result, ok
+}
+
+// Returns the column with the passed name if it has a bitmap index.
+func bitmapColumn(cols []Column, attr AttrInfo) (*Column, bool) {
+	for i := range cols {
+		if cols[i].Signature.Name == attr.Name {
+			return &cols[i], cols[i].bitmaps != nil
+		}
+	}
+	return nil, false
+}
+
+// Returns the key of the value inside the bitmap index, exits if the value does not have the type of the column.
+func (col *Column) bitmapKey(value interface{}) interface{} {
+	key := lookupType(col.Signature.Type).castAny(value)
+	if text, ok := key.(string); ok {
+		return col.indexKey(text)
+	}
+	return key
+}
+
+// Checks if all columns of the predicate have bitmap indexes that can evaluate it, Match predicates
+// need a FULLTEXT index.
+func hasBitmaps(cols []Column, pred Predicate) bool {
+	switch p := pred.(type) {
+	case *comparePredicate:
+		_, ok := bitmapColumn(cols, p.col)
+		return ok && (indexComparison(p.comp) || p.comp == NEQ)
+	case *inPredicate, *betweenPredicate, *isNullPredicate:
+		_, ok := bitmapColumn(cols, pred.attrs()[0])
+		return ok
+	case *andPredicate:
+		return allBitmaps(cols, p.preds)
+	case *orPredicate:
+		return allBitmaps(cols, p.preds)
+	case *notPredicate:
+		return hasBitmaps(cols, p.pred)
+	case *matchPredicate:
+		return cols[columnIndex(cols, p.col)].fulltext != nil
+	}
+	return false
+}
+
+// Checks if all predicates can be evaluated on bitmaps.
+func allBitmaps(cols []Column, preds []Predicate) bool {
+	for _, pred := range preds {
+		if !hasBitmaps(cols, pred) {
+			return false
+		}
+	}
+	return len(preds) > 0
+}
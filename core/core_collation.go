@@ -0,0 +1,86 @@
+package core
+
+/*
+	Collations for STRING columns. A collation maps every string to a sort key; two strings are
+	equal if their keys are equal and are ordered by the byte order of their keys.
+*/
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Replacements of German letters for the dictionary order (DIN 5007-1).
+var germanDictionary = strings.NewReplacer("ä", "a", "ö", "o", "ü", "u", "ß", "ss")
+
+// Replacements of German letters for the phonebook order (DIN 5007-2).
+var germanPhonebook = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss")
+
+// Replacements for other accented latin letters used by the locale collations.
+var latinAccents = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "å", "a", "æ", "ae",
+	"ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ø", "o", "œ", "oe",
+	"ù", "u", "ú", "u", "û", "u", "ý", "y", "ÿ", "y",
+)
+
+// Returns the function creating the sort keys for the passed collation.
+func collationKey(coll Collation) func(string) string {
+	switch coll {
+	case BINARY:
+		return func(a string) string { return a }
+	case NOCASE:
+		return func(a string) string { return strings.Map(unicode.ToLower, a) }
+	case DE_DE:
+		return func(a string) string {
+			return latinAccents.Replace(germanDictionary.Replace(strings.Map(unicode.ToLower, a)))
+		}
+	case DE_DE_PHONEBOOK:
+		return func(a string) string {
+			return latinAccents.Replace(germanPhonebook.Replace(strings.Map(unicode.ToLower, a)))
+		}
+	}
+	error_("Unknown collation '%s'.", coll)
+	return nil
+}
+
+// Returns the collation used to compare the values of both columns. Exits if both columns
+// use different collations that are not BINARY.
+func commonCollation(left, right AttrInfo) Collation {
+	if left.Collation == BINARY {
+		return right.Collation
+	}
+	if right.Collation != BINARY && right.Collation != left.Collation {
+		error_("Not matching collations '%s' and '%s'.", left.Collation, right.Collation)
+	}
+	return left.Collation
+}
+
+// Wraps a string predicate, so it is applied to the sort keys of the compared strings. The key of
+// every distinct value is only created once.
+func collated(coll Collation, predicate func(string) bool) func(string) bool {
+	if coll == BINARY {
+		return predicate
+	}
+	key := collationKey(coll)
+	known := make(map[string]bool)
+	return func(a string) bool {
+		matched, ok := known[a]
+		if !ok {
+			matched = predicate(key(a))
+			known[a] = matched
+		}
+		return matched
+	}
+}
+
+// Returns the sort key of the passed string using the collation of the column.
+func (col *Column) collate(a string) string {
+	return collationKey(col.Signature.Collation)(a)
+}
+
+// Casts the passed value to a string and returns its sort key using the collation of the column.
+func (col *Column) collateValue(a interface{}) string {
+	return col.collate(asString(a))
+}
@@ -2,13 +2,9 @@ package core
 
 import (
 	"encoding/csv"
-	"hash/fnv"
-	"math"
 	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
-	"sync"
 )
 
 func (cs *ColumnStore) Load(csvFile string, separator rune) Relationer {
@@ -45,57 +41,37 @@ func (cs *ColumnStore) Load(csvFile string, separator rune) Relationer {
 	}
 
 	tableName := csvFile[:len(csvFile)-len(filepath.Ext(csvFile))]
-	rel := cs.CreateRelation(tableName, attrInfos)
+	// the relation is filled before it is added to the store, so no query sees it half loaded
+	rel := newRelation(tableName, attrInfos)
 
-	for colIdx, col := range rel.columns() {
+	for colIdx, col := range rel.Columns {
 		// create column data array
-		rel.columns()[colIdx].Data = arrayForType(col.Signature.Type, len(data))
+		rel.Columns[colIdx].Data = newColumnData(col.Signature.Type, len(data))
 
 		// store column data
 		for rowIdx, row := range data {
-			if col.isInt() {
-				val, err := strconv.Atoi(row[colIdx])
-				checkError(err)
-				rel.columns()[colIdx].Data.([]int)[rowIdx] = val
-			} else if col.isFloat() {
-				val, err := strconv.ParseFloat(row[colIdx], 64)
-				checkError(err)
-				rel.columns()[colIdx].Data.([]float64)[rowIdx] = val
-			} else if col.isString() {
-				rel.columns()[colIdx].Data.([]string)[rowIdx] = row[colIdx]
-			} else {
-                error_("Unknown or unset column type.")
-            }
+			checkError(rel.Columns[colIdx].Data.Parse(rowIdx, row[colIdx]))
 		}
 	}
+	// the optimizer needs the statistics of the new relation
+	rel.analyze()
 
+	cs.addRelation(rel)
 	return rel
 }
 
 func (cs *ColumnStore) CreateRelation(tabName string, sig []AttrInfo) Relationer {
-	// initialize a new map when no one exists
-	if cs.relations == nil {
-		cs.relations = make(map[string]Relationer)
-	}
-
-	// create an appropriate number of columns and asign the signatures
-	var cols []Column = make([]Column, len(sig))
-	for i, s := range sig {
-		cols[i].Signature = s
-	}
-
-	// create a new relation and asign the columns
-	var rs *Relation = new(Relation)
-	rs.Name = tabName
-	rs.Columns = cols
+	rs := newRelation(tabName, sig)
 
 	// save and return the relation
-	cs.relations[tabName] = rs
+	cs.addRelation(rs)
 	return rs
 }
 
 func (cs *ColumnStore) GetRelation(relName string) Relationer {
+	cs.mu.RLock()
 	rel, ok := cs.relations[relName]
+	cs.mu.RUnlock()
 	if !ok {
 		error_("No relation with name '%s'", relName)
 	}
@@ -103,185 +79,51 @@ func (cs *ColumnStore) GetRelation(relName string) Relationer {
 }
 
 func (cs *ColumnStore) NestedLoopJoin(leftRelation string, leftColumn AttrInfo, rightRelation string, rightColumn AttrInfo, comp Comparison) Relationer {
-    // Basic setup
-    leftRel := cs.GetRelation(leftRelation)
-    rightRel := cs.GetRelation(rightRelation)
-    lidx := leftRel.findColumn(leftColumn)
-    ridx := rightRel.findColumn(rightColumn)
-    lcol := leftRel.columns()[lidx]
-
-    if lcol.Signature.Type != rightRel.columns()[ridx].Signature.Type {
-        error_("Not matching types for nested loop join.")
-    }
-
-    result := prepareJoinResult("NestedLoopJoin", leftRel, rightRel, lidx, ridx)
-
-    // Perform the join
-    for i := 0; i < leftRel.rowCount(); i++ {
-        var predicate interface{}
-        if lcol.isInt() {
-            predicate = comparator(comp, lcol.intAt(i))
-        } else if lcol.isFloat() {
-            predicate = comparator(comp, lcol.floatAt(i))
-        } else if lcol.isString() {
-            predicate = comparator(comp, lcol.stringAt(i))
-        } else {
-            error_("Unknown or unset column type.")
-        }
-        for j := 0; j < rightRel.rowCount(); j++ {
-            if lcol.isInt() && predicate.(func(int) bool)(rightRel.columns()[ridx].intAt(j)) {
-                join(leftRel, rightRel, result, i, j)
-            } else if lcol.isFloat() && predicate.(func(float64) bool)(rightRel.columns()[ridx].floatAt(j)) {
-                join(leftRel, rightRel, result, i, j)
-            } else if lcol.isString() && predicate.(func(string) bool)(rightRel.columns()[ridx].stringAt(j)) {
-                join(leftRel, rightRel, result, i, j)
-            }
-        }
-    }
-
-    return &result
+    node := cs.legacyJoin("NestedLoopJoin", nestedLoopJoinAlgorithm, leftRelation, leftColumn, rightRelation, rightColumn, comp)
+    return &Plan{root: node}
 }
 
 func (cs *ColumnStore) IndexNestedLoopJoin(leftRelation string, leftColumn AttrInfo, rightRelation string, rightColumn AttrInfo) Relationer {
-    leftRel := cs.GetRelation(leftRelation)
-    rightRel := cs.GetRelation(rightRelation)
-    lidx := leftRel.findColumn(leftColumn)
-    ridx := rightRel.findColumn(rightColumn)
-    lcol := leftRel.columns()[lidx]
+    return cs.IndexRangeJoin(leftRelation, leftColumn, rightRelation, rightColumn, EQ)
+}
 
-    if lcol.Signature.Type != rightRel.columns()[ridx].Signature.Type {
-        error_("Not matching types for Index nested loop join.")
+func (cs *ColumnStore) IndexRangeJoin(leftRelation string, leftColumn AttrInfo, rightRelation string, rightColumn AttrInfo, comp Comparison) Relationer {
+    if !indexComparison(comp) {
+        error_("Comparison '%s' is not supported by Index nested loop join.", comp)
     }
-
-    rightRel.MakeIndex(rightColumn)
-
-    result := prepareJoinResult("IndexNestedLoopJoin", leftRel, rightRel, lidx, ridx)
-
-    for i := 0; i < leftRel.rowCount(); i++ {
-        var value interface{}
-        if lcol.isInt() {
-            value = lcol.intAt(i)
-        } else if lcol.isFloat() {
-            value = lcol.floatAt(i)
-        } else if lcol.isString() {
-            value = lcol.stringAt(i)
-        } else {
-            error_("Unknown or unset column type.")
-        }
-        for _, row := range rightRel.columns()[ridx].IndexLookup(value) {
-            join(leftRel, rightRel, result, i, row)
-        }
-    } 
-
-    return &result
+    node := cs.legacyJoin("IndexNestedLoopJoin", indexNestedLoopJoinAlgorithm, leftRelation, leftColumn, rightRelation, rightColumn, comp)
+    if node.fattr.Collation != node.sattr.Collation {
+        error_("Not matching collations for Index nested loop join.")
+    }
+    return &Plan{root: node}
 }
 
 func (cs *ColumnStore) HashJoin(leftRelation string, leftColumn AttrInfo, rightRelation string, rightColumn AttrInfo, comp Comparison) Relationer {
-    s := cs.hashJoinSetup(leftRelation, leftColumn, rightRelation, rightColumn, "HashJoin")
-
-    // Perform the join
-    for i := 0; i < s.secondRel.rowCount(); i++ {
-        var hashed int
-        if s.scol.isInt() {
-            hashed = s.hash(s.scol.intAt(i))
-        } else if s.scol.isFloat() {
-            hashed = s.hash(s.scol.floatAt(i))
-        } else if s.scol.isString() {
-            hashed = s.hash(s.scol.stringAt(i))
-        } else {
-            error_("Unknown or unset column type.")
-        }
-        hashed = abs(hashed % len(s.hashTable))
-        for _, j := range s.hashTable[hashed] {
-            if s.fcol.isInt() {
-                predicate := comparator(comp, s.fcol.intAt(j))
-                if predicate(s.scol.intAt(i)) {
-                    join(s.firstRel, s.secondRel, s.result, j, i)
-                }
-            } else if s.fcol.isFloat() {
-                predicate := comparator(comp, s.scol.floatAt(j))
-                if predicate(s.scol.floatAt(i)) {
-                    join(s.firstRel, s.secondRel, s.result, j, i)
-                }
-            } else if s.fcol.isString() {
-                predicate := comparator(comp, s.fcol.stringAt(j))
-                if predicate(s.scol.stringAt(i)) {
-                    join(s.firstRel, s.secondRel, s.result, j, i)
-                }
-            } else {
-                error_("Unknown or unset column type.")
-            }
-        }
-    }
-
-    return &s.result
+    node := cs.legacyJoin("HashJoin", hashJoinAlgorithm, leftRelation, leftColumn, rightRelation, rightColumn, comp)
+    return &Plan{root: node}
 }
 
 func (cs *ColumnStore) ParallelHashJoin(leftRelation string, leftColumn AttrInfo, rightRelation string, rightColumn AttrInfo, comp Comparison) Relationer {
-    s := cs.hashJoinSetup(leftRelation, leftColumn, rightRelation, rightColumn, "HashJoin")
-
-    type ij struct {
-        i int
-        j int
-    }
-    n := s.secondRel.rowCount()
-
-    rows := make(chan []ij, n)
-    defer close(rows)
-
-    wg := new(sync.WaitGroup)
-    wg.Add(n)
-
-    // Perform the join
-    for i := 0; i < s.secondRel.rowCount(); i++ {
-        go func(i int, wg *sync.WaitGroup) {
-            var hashed int
-            found := make([]ij, 0)
-
-            if s.scol.isInt() {
-                hashed = s.hash(s.scol.intAt(i))
-            } else if s.scol.isFloat() {
-                hashed = s.hash(s.scol.floatAt(i))
-            } else if s.scol.isString() {
-                hashed = s.hash(s.scol.stringAt(i))
-            } else {
-                error_("Unknown or unset column type.")
-            }
-            hashed = abs(hashed % len(s.hashTable))
-            for _, j := range s.hashTable[hashed] {
-                if s.fcol.isInt() {
-                    predicate := comparator(comp, s.fcol.intAt(j))
-                    if predicate(s.scol.intAt(i)) {
-                        found = append(found, ij { i: i, j: j })
-                    }
-                } else if s.fcol.isFloat() {
-                    predicate := comparator(comp, s.scol.floatAt(j))
-                    if predicate(s.scol.floatAt(i)) {
-                        found = append(found, ij { i: i, j: j })
-                    }
-                } else if s.fcol.isString() {
-                    predicate := comparator(comp, s.fcol.stringAt(j))
-                    if predicate(s.scol.stringAt(i)) {
-                        found = append(found, ij { i: i, j: j })
-                    }
-                } else {
-                    error_("Unknown or unset column type.")
-                }
-            }
-
-            rows <- found
-            wg.Wait()
-        }(i, wg)
-    }
+    node := cs.legacyJoin("HashJoin", parallelHashJoinAlgorithm, leftRelation, leftColumn, rightRelation, rightColumn, comp)
+    return &Plan{root: node}
+}
 
-    for i := 0; i < n; i++ {
-        for _, ij := range <- rows {
-            join(s.firstRel, s.secondRel, s.result, ij.j, ij.i)
-        }
-        wg.Done()
+func (cs *ColumnStore) Join(left Relationer, right Relationer, cond JoinCondition, kind JoinKind) Relationer {
+    switch kind {
+    case INNER, LEFT, SEMI, ANTI:
+    default:
+        error_("Unknown join kind '%s'.", kind)
     }
+    node := newJoinNode("Join", planOf(left), cond.Left, planOf(right), cond.Right)
+    node.kind = kind
+    node.collisions = restrictAttrs(right.schema(), left.schema())
+    // "left comp right" is the same as "right flip(comp) left"
+    node.comp = flip(cond.Comp)
+    return &Plan{root: node}
+}
 
-    return &s.result
+func (cs *ColumnStore) MultiJoin(relations map[string]Relationer, preds []JoinPredicate) Relationer {
+    return &Plan{root: newMultiJoinNode(relations, preds)}
 }
 
 /*
@@ -290,149 +132,228 @@ ColumnStore intern helper functions
 -------------------------------------------------
 */
 
-type setup struct {
-    firstRel    Relationer
-    secondRel   Relationer
-    result      Relation
-    hash        func(interface{}) int
-    hashTable   [][]int
-    fcol        Column
-    scol        Column
+// Creates a relation with columns of the passed signatures that is not part of the store yet.
+func newRelation(tabName string, sig []AttrInfo) *Relation {
+	// create an appropriate number of columns and asign the signatures
+	var cols []Column = make([]Column, len(sig))
+	for i, s := range sig {
+		cols[i].Signature = s
+		cols[i].Data = newColumnData(s.Type, 0)
+	}
+
+	// create a new relation and asign the columns
+	var rs *Relation = new(Relation)
+	rs.Name = tabName
+	rs.Columns = cols
+	rs.ownsData = true
+	return rs
 }
 
-func (cs *ColumnStore) hashJoinSetup(leftRelation string, leftColumn AttrInfo, rightRelation string, rightColumn AttrInfo, resultName string) setup {
-    // Basic setup
-    leftRel := cs.GetRelation(leftRelation)
-    rightRel := cs.GetRelation(rightRelation)
-    lidx := leftRel.findColumn(leftColumn)
-    ridx := rightRel.findColumn(rightColumn)
-    lcol := leftRel.columns()[lidx]
-    rcol := rightRel.columns()[ridx]
+// Adds the relation to the store, a relation with the same name is replaced. The relation is
+// logged if the store has an opened directory.
+func (cs *ColumnStore) addRelation(rel *Relation) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	// initialize a new map when no one exists
+	if cs.relations == nil {
+		cs.relations = make(map[string]Relationer)
+	}
+	if old, ok := cs.relations[rel.Name]; ok {
+		old.(*Relation).detach()
+	}
+	if cs.log != nil {
+		rel.attach(cs.log)
+	}
+	rel.track(cs.historyLocked())
+	cs.relations[rel.Name] = rel
+}
+
+// Logs the relation with its rows and indexes, its later changes are logged as well.
+func (rel *Relation) attach(log *writeAheadLog) {
+	rel.lockForWrite()
+	defer rel.mu.Unlock()
+	// the stored indexes have to cover all rows
+	rel.updateIndexes()
+	rel.log = log
+	rel.logChange(walRecord{Kind: walCreate, Created: storeRelation(rel)})
+}
+
+// Stops logging and recording the changes of a relation that was replaced in the store.
+func (rel *Relation) detach() {
+	rel.mu.Lock()
+	defer rel.mu.Unlock()
+	rel.log = nil
+	rel.history = nil
+}
 
-    if lcol.Signature.Type != rcol.Signature.Type {
-        error_("Not matching types for hash join.")
+// Creates the plan node joining both inputs. The optimizer chooses the algorithm and the build side.
+func newJoinNode(name string, first planNode, firstColumn AttrInfo, second planNode, secondColumn AttrInfo) *joinNode {
+    fschema, sschema := first.schema(), second.schema()
+    checkAttrs(fschema, []AttrInfo{firstColumn})
+    checkAttrs(sschema, []AttrInfo{secondColumn})
+    fattr := fschema[findAttr(fschema, firstColumn)]
+    sattr := sschema[findAttr(sschema, secondColumn)]
+
+    if fattr.Type != sattr.Type {
+        error_("Not matching types for %s.", name)
     }
 
-    // Get the smaller relation
-    var firstRel, secondRel Relationer
-    var fidx, sidx int
-    var fcol, scol Column
-    if leftRel.rowCount() < rightRel.rowCount() {
-        firstRel, secondRel = leftRel, rightRel
-        fidx, sidx = lidx, ridx
-        fcol, scol = lcol, rcol
-    } else {
-        firstRel, secondRel = rightRel, leftRel
-        fidx, sidx = ridx, lidx
-        fcol, scol = rcol, lcol
+    return &joinNode{
+        label: name,
+        algorithm: autoJoinAlgorithm,
+        kind: INNER,
+        first: first,
+        second: second,
+        fattr: fattr,
+        sattr: sattr,
+        comp: EQ,
+        coll: commonCollation(fattr, sattr),
     }
+}
 
-    // create the hash table, the length should be done differently
-    var hashTable = make([][]int, firstRel.rowCount())
-    hash := createHashFunction(fcol.Signature)
-    for i := 0; i < firstRel.rowCount(); i++ {
-        var hashed int
-        if fcol.isInt() {
-            hashed = hash(fcol.intAt(i))
-        } else if fcol.isFloat() {
-            hashed = hash(fcol.floatAt(i))
-        } else if fcol.isString() {
-            hashed = hash(fcol.stringAt(i))
-        } else {
-            error_("Unknown or unset column type.")
+// Creates the plan node of the joins with an algorithm chosen by the caller. The join columns
+// are renamed and hash joins build the hash table on the smaller relation. Only equal keys are
+// in the same bucket, so hash joins on other comparisons are executed as nested loop joins.
+func (cs *ColumnStore) legacyJoin(name string, algorithm joinAlgorithm, leftRelation string, leftColumn AttrInfo, rightRelation string, rightColumn AttrInfo, comp Comparison) *joinNode {
+    leftRel := cs.GetRelation(leftRelation)
+    rightRel := cs.GetRelation(rightRelation)
+    if (algorithm == hashJoinAlgorithm || algorithm == parallelHashJoinAlgorithm) && comp != EQ {
+        algorithm = nestedLoopJoinAlgorithm
+    }
+    node := newJoinNode(name, planOf(leftRel), leftColumn, planOf(rightRel), rightColumn)
+    node.algorithm = algorithm
+    node.comp = comp
+    node.renameKeys = true
+
+    if algorithm == hashJoinAlgorithm || algorithm == parallelHashJoinAlgorithm {
+        // the hash table is built on the relation with less keys, NULL values are not inserted
+        node.buildFirst = true
+        if joinKeyCount(leftRel, leftColumn) >= joinKeyCount(rightRel, rightColumn) {
+            node.first, node.second = node.second, node.first
+            node.fattr, node.sattr = node.sattr, node.fattr
         }
-        hashed = abs(hashed % len(hashTable))
-        hashTable[hashed] = append(hashTable[hashed], i)
     }
+    return node
+}
 
-    result := prepareJoinResult(resultName, firstRel, secondRel, fidx, sidx)
-    return setup {
-        firstRel: firstRel,
-        secondRel: secondRel,
-        result: result,
-        hash: hash,
-        hashTable: hashTable,
-        fcol: fcol,
-        scol: scol,
+// Returns the number of non NULL values of the join column from the statistics of the relation.
+func joinKeyCount(rel Relationer, col AttrInfo) int {
+    stats := columnStatsOf(planOf(rel), col)
+    if stats == nil {
+        return rel.rowCount()
     }
+    return stats.rows - stats.nulls
 }
 
-func createHashFunction(info AttrInfo) func(interface{}) int {
-    switch info.Type {
-    case INT:
-        return func(in interface{}) int {
-            return asInt(in)
+// Joins the rows of both key arrays where "right comp left" is true. The left keys are probed.
+func nestedLoopJoin[T Value](comp Comparison, left, right []T, lnulls, rnulls []bool, result *joinResult) {
+    candidates := allRows(len(right))
+    matches := make([]int, 0)
+    for i, val := range left {
+        if lnulls != nil && lnulls[i] {
+            continue
         }
-    case FLOAT:
-        return func(in interface{}) int {
-            return int(math.Round(asFloat(in)))
+        matches = compareKernel(comp, val, right, nil, rnulls, candidates, matches[:0])
+        for _, j := range matches {
+            result.add(i, j)
         }
-    default:
-        return func(in interface{}) int {
-            h := fnv.New64a()
-            h.Write([]byte(asString(in)))
-            return int(h.Sum64())
+    }
+}
+
+// Joins every value of the left keys with the rows of the index of the right column where
+// "right value comp left value" is true.
+func indexNestedLoopJoin[T Value](comp Comparison, left []T, lnulls []bool, rcol Column, result *joinResult) {
+    for i, val := range left {
+        if lnulls != nil && lnulls[i] {
+            continue
+        }
+        for _, row := range rcol.indexLookup(comp, val) {
+            result.add(i, row)
         }
     }
 }
 
-func prepareJoinResult(name string, first, second Relationer, fidx, sidx int) Relation {
-    // create relation
-    var result Relation
-    result.Name = name
-    result.Columns = make([]Column, len(first.columns()) + len(second.columns()))
-
-    // Setup columns
-    for i := 0; i < len(result.Columns); i++ {
-        if i < len(first.columns()) {
-            result.Columns[i].Signature = first.columns()[i].Signature
-            if i == fidx {
-                result.Columns[i].Signature.Name += " (first)"
-            }
-        } else {
-            i2 := i - len(first.columns())
-            result.Columns[i].Signature = second.columns()[i2].Signature
-            if i2 == sidx {
-                result.Columns[i].Signature.Name += " (second)"
-            }
+// The joinTable interface hides the key type of a hash table.
+type joinTable interface {
+    // Probes the table with the passed keys and adds the row pairs where "key comp build key" is true.
+    probe(comp Comparison, keys ColumnData, nulls []bool, result *joinResult)
+    // Returns the size of the table shown by ExplainAnalyze.
+    stats() *hashTableStats
+}
+
+// The size of a hash table. Collisions are keys placed in a bucket with other keys.
+type hashTableStats struct {
+    Entries     int `json:"entries"`
+    Buckets     int `json:"buckets"`
+    Collisions  int `json:"collisions"`
+}
+
+// A hash table on the keys of the build side of a hash join.
+type hashTable[T Value] struct {
+    first       []T
+    table       [][]int
+    hash        func(T) int
+    entries     int
+    collisions  int
+}
+
+// Builds the hash table on the keys of the first relation.
+func newHashTable[T Value](first []T, fnulls []bool) *hashTable[T] {
+    ht := &hashTable[T]{first: first, table: make([][]int, len(first)), hash: hashFunction[T]()}
+    for j, val := range first {
+        if fnulls != nil && fnulls[j] {
+            continue
         }
-        if result.Columns[i].isInt() {
-            result.Columns[i].Data = make([]int, 0)
-        } else if result.Columns[i].isFloat() {
-            result.Columns[i].Data = make([]float64, 0)
-        } else if result.Columns[i].isString() {
-            result.Columns[i].Data = make([]string, 0)
-        } else {
-            error_("Unknown or unset column type.")
+        hashed := abs(ht.hash(val) % len(ht.table))
+        // equal keys in the same bucket are no collision
+        if len(ht.table[hashed]) > 0 && first[ht.table[hashed][0]] != val {
+            ht.collisions++
         }
+        ht.table[hashed] = append(ht.table[hashed], j)
+        ht.entries++
     }
+    return ht
+}
 
-    return result
+func (ht *hashTable[T]) stats() *hashTableStats {
+    return &hashTableStats{Entries: ht.entries, Buckets: len(ht.table), Collisions: ht.collisions}
 }
 
-func join(firstRel, secondRel Relationer, result Relation, firstIndex, secondIndex int) {
-    for i := 0; i < len(result.Columns); i++ {
-        if i < len(firstRel.columns()) {
-            if result.Columns[i].isInt() {
-                result.Columns[i].Data = append(result.Columns[i].Data.([]int), firstRel.columns()[i].intAt(firstIndex))
-            } else if result.Columns[i].isFloat() {
-                result.Columns[i].Data = append(result.Columns[i].Data.([]float64), firstRel.columns()[i].floatAt(firstIndex))
-            } else if result.Columns[i].isString() {
-                result.Columns[i].Data = append(result.Columns[i].Data.([]string), firstRel.columns()[i].stringAt(firstIndex))
-            } else {
-                error_("Unknown or unset column type.")
-            }
-        } else {
-            i2 := i - len(firstRel.columns())
-            if result.Columns[i].isInt() {
-                result.Columns[i].Data = append(result.Columns[i].Data.([]int), secondRel.columns()[i2].intAt(secondIndex))
-            } else if result.Columns[i].isFloat() {
-                result.Columns[i].Data = append(result.Columns[i].Data.([]float64), secondRel.columns()[i2].floatAt(secondIndex))
-            } else if result.Columns[i].isString() {
-                result.Columns[i].Data = append(result.Columns[i].Data.([]string), secondRel.columns()[i2].stringAt(secondIndex))
-            } else {
-                error_("Unknown or unset column type.")
-            }
+func (ht *hashTable[T]) probe(comp Comparison, keys ColumnData, snulls []bool, result *joinResult) {
+    if len(ht.table) == 0 {
+        return
+    }
+    second := values[T](keys)
+    matches := make([]int, 0)
+    for i := range second {
+        if snulls != nil && snulls[i] {
+            continue
+        }
+        bucket := ht.table[abs(ht.hash(second[i]) % len(ht.table))]
+        // "second comp first" is the same as "first flip(comp) second"
+        matches = compareBatch(flip(comp), second[i], ht.first, bucket, bucket, matches[:0])
+        for _, j := range matches {
+            result.add(i, j)
         }
     }
 }
+
+// Collects the row pairs of a join. The values of the joined rows are not copied, the
+// columns of the result are views on the columns of both inputs.
+type joinResult struct {
+    probeRows   []int
+    buildRows   []int
+}
+
+func newJoinResult() *joinResult {
+    return &joinResult {
+        probeRows: make([]int, 0),
+        buildRows: make([]int, 0),
+    }
+}
+
+// Adds the row pair with the passed positions to the result.
+func (r *joinResult) add(probeIndex, buildIndex int) {
+    r.probeRows = append(r.probeRows, probeIndex)
+    r.buildRows = append(r.buildRows, buildIndex)
+}
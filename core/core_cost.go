@@ -0,0 +1,272 @@
+package core
+
+/*
+	The cost model of the optimizer. The number of rows produced by every node of a plan is
+	estimated from the sizes of the relations and the statistics of their columns. Columns
+	without statistics, e.g., computed ones, use fixed selectivities. The join algorithm and
+	the build side with the lowest estimated cost are chosen for every join whose algorithm
+	is not fixed by the caller.
+*/
+
+import (
+	"math"
+	"runtime"
+)
+
+const (
+	hashBuildCost     = 2.0    // per row inserted into a hash table
+	hashProbeCost     = 1.0    // per row probed against a hash table
+	indexLookupCost   = 1.5    // per row looked up in an existing index
+	compareCost       = 1.0    // per pair of rows compared by a nested loop join
+	materializeCost   = 1.0    // per row of the build side of a nested loop join
+	parallelProbeRows = 100000 // number of probe rows from which on hash joins probe in parallel
+)
+
+// Chooses the algorithm and the build side of all joins of the plan that are not fixed.
+func chooseJoinAlgorithms(node planNode) planNode {
+	node = withChildren(node, chooseJoinAlgorithms)
+	join, ok := node.(*joinNode)
+	if !ok {
+		return node
+	}
+	if join.algorithm != autoJoinAlgorithm {
+		join.cost = algorithmCost(join, join.algorithm, join.buildFirst)
+		return join
+	}
+
+	join.algorithm, join.buildFirst, join.cost = cheapestJoin(join)
+	return join
+}
+
+// Returns the algorithm and build side with the lowest estimated cost for the join.
+func cheapestJoin(join *joinNode) (joinAlgorithm, bool, float64) {
+	best, bestBuildFirst, bestCost := nestedLoopJoinAlgorithm, false, math.Inf(1)
+	for _, algorithm := range []joinAlgorithm{nestedLoopJoinAlgorithm, indexNestedLoopJoinAlgorithm, hashJoinAlgorithm, parallelHashJoinAlgorithm} {
+		for _, buildFirst := range []bool{false, true} {
+			if cost := joinCost(join, algorithm, buildFirst); cost < bestCost {
+				best, bestBuildFirst, bestCost = algorithm, buildFirst, cost
+			}
+		}
+	}
+	return best, bestBuildFirst, bestCost
+}
+
+// Returns the estimated cost of the join with the passed algorithm and build side. Algorithms
+// that can not be used for the join have an infinite cost.
+func joinCost(join *joinNode, algorithm joinAlgorithm, buildFirst bool) float64 {
+	// the build rows meet "build value buildComp probe value"
+	probe, buildNode, buildAttr, buildComp := estimateRows(join.first), join.second, join.sattr, join.comp
+	if buildFirst {
+		probe, buildNode, buildAttr, buildComp = estimateRows(join.second), join.first, join.fattr, flip(join.comp)
+	}
+
+	switch algorithm {
+	case indexNestedLoopJoinAlgorithm:
+		if join.fattr.Collation != join.sattr.Collation || !hasIndex(buildNode, buildAttr, buildComp) {
+			return math.Inf(1)
+		}
+	case hashJoinAlgorithm, parallelHashJoinAlgorithm:
+		// only equal keys are in the same bucket
+		if join.comp != EQ {
+			return math.Inf(1)
+		}
+		parallel := probe >= parallelProbeRows && runtime.NumCPU() > 1
+		if parallel != (algorithm == parallelHashJoinAlgorithm) {
+			return math.Inf(1)
+		}
+	}
+	return algorithmCost(join, algorithm, buildFirst)
+}
+
+// Returns the estimated cost of the join with the passed algorithm and build side, also for
+// algorithms chosen by the caller that the optimizer would not use.
+func algorithmCost(join *joinNode, algorithm joinAlgorithm, buildFirst bool) float64 {
+	build, probe := estimateRows(join.second), estimateRows(join.first)
+	if buildFirst {
+		build, probe = probe, build
+	}
+
+	switch algorithm {
+	case nestedLoopJoinAlgorithm:
+		return build*materializeCost + build*probe*compareCost
+	case indexNestedLoopJoinAlgorithm:
+		if join.comp == EQ {
+			return probe * indexLookupCost
+		}
+		// ranges of an ordered index return all their rows
+		return probe*indexLookupCost + joinRows(join)*compareCost
+	case hashJoinAlgorithm, parallelHashJoinAlgorithm:
+		return build*hashBuildCost + probe*hashProbeCost
+	}
+	return math.Inf(1)
+}
+
+// Returns the estimated number of rows produced by the node.
+func estimateRows(node planNode) float64 {
+	switch n := node.(type) {
+	case *relationNode:
+		return float64(n.rel.liveCount())
+	case *selectNode:
+		return estimateRows(n.child) * selectivity(n.child, n.pred)
+	case *scanNode:
+		return estimateRows(n.child)
+	case *projectNode:
+		return estimateRows(n.child)
+	case *collateNode:
+		return estimateRows(n.child)
+	case *orderByNode:
+		return estimateRows(n.child)
+	case *makeIndexNode:
+		return estimateRows(n.child)
+	case *indexScanNode:
+		// existing indexes know the exact number of rows
+		if source, ok := n.child.(*relationNode); ok && hasBitmaps(source.rel.Columns, n.pred) {
+			rows, _ := bitmapOf(source.rel.Columns, n.pred)
+			return float64(rows.cardinality())
+		}
+		if source, ok := n.child.(*relationNode); ok && n.indexed(source.rel) {
+			rel := source.rel
+			return float64(len(rel.Columns[columnIndex(rel.Columns, n.col())].indexScan(n.pred)))
+		}
+		// predicates without index are evaluated on all rows
+		return estimateRows(n.child) * selectivity(n.child, n.pred)
+	case *joinNode:
+		return joinRows(n)
+	case *multiJoinNode:
+		return estimateRows(n.order())
+	}
+	return 0
+}
+
+// Returns the estimated number of rows of a join.
+func joinRows(join *joinNode) float64 {
+	first, second := estimateRows(join.first), estimateRows(join.second)
+	fstats, sstats := columnStatsOf(join.first, join.fattr), columnStatsOf(join.second, join.sattr)
+	var matches float64
+	switch {
+	case join.comp == EQ && fstats != nil && sstats != nil:
+		// the keys of the input with less distinct values are expected to be found in the other input
+		matches = first * nonNullFraction(fstats) * second * nonNullFraction(sstats) /
+			math.Max(fstats.distinctValues(first), sstats.distinctValues(second))
+	case join.comp == EQ:
+		// every row of the larger input is expected to match one row of the smaller input
+		matches = math.Max(first, second)
+	case join.comp == NEQ:
+		matches = first * second * 0.9
+	default:
+		matches = first * second / 3
+	}
+	if first == 0 || second == 0 {
+		matches = 0
+	}
+
+	switch join.kind {
+	case LEFT:
+		return math.Max(matches, first)
+	case SEMI:
+		return math.Min(matches, first)
+	case ANTI:
+		return math.Max(first-matches, first*0.1)
+	}
+	return matches
+}
+
+// Returns the estimated fraction of the rows of the node meeting the predicate.
+func selectivity(node planNode, pred Predicate) float64 {
+	switch p := pred.(type) {
+	case *comparePredicate:
+		return valueSelectivity(node, p.col, p.comp, p.compVal)
+	case *columnComparePredicate:
+		left, right := columnStatsOf(node, p.left), columnStatsOf(node, p.right)
+		if p.comp == EQ && left != nil && right != nil {
+			rows := estimateRows(node)
+			return nonNullFraction(left) * nonNullFraction(right) / math.Max(left.distinctValues(rows), right.distinctValues(rows))
+		}
+		return compareSelectivity(p.comp)
+	case *inPredicate:
+		result := 0.0
+		for _, value := range p.values {
+			result += valueSelectivity(node, p.col, EQ, value)
+		}
+		return math.Min(1, result)
+	case *betweenPredicate:
+		if stats := columnStatsOf(node, p.col); stats != nil {
+			below, lok := stats.compareFraction(LT, p.lo)
+			above, hok := stats.compareFraction(GT, p.hi)
+			if lok && hok {
+				return math.Max(0, nonNullFraction(stats)-below-above)
+			}
+		}
+		return 0.25
+	case *isNullPredicate:
+		if stats := columnStatsOf(node, p.col); stats != nil {
+			return 1 - nonNullFraction(stats)
+		}
+		return 0.05
+	case *andPredicate:
+		result := 1.0
+		for _, part := range p.preds {
+			result *= selectivity(node, part)
+		}
+		return result
+	case *orPredicate:
+		none := 1.0
+		for _, part := range p.preds {
+			none *= 1 - selectivity(node, part)
+		}
+		return 1 - none
+	case *notPredicate:
+		return 1 - selectivity(node, p.pred)
+	case *matchPredicate:
+		return compareSelectivity(CONTAINS)
+	}
+	return 1
+}
+
+// Returns the estimated fraction of the rows of the node whose column meets the comparison with the value.
+func valueSelectivity(node planNode, col AttrInfo, comp Comparison, value interface{}) float64 {
+	if stats := columnStatsOf(node, col); stats != nil {
+		if fraction, ok := stats.compareFraction(comp, value); ok {
+			return fraction
+		}
+	}
+	return compareSelectivity(comp)
+}
+
+// Returns the fraction of the rows of a column that are not NULL.
+func nonNullFraction(stats *columnStats) float64 {
+	if stats.rows == 0 {
+		return 0
+	}
+	return float64(stats.rows-stats.nulls) / float64(stats.rows)
+}
+
+// Returns the estimated fraction of rows meeting a comparison.
+func compareSelectivity(comp Comparison) float64 {
+	switch comp {
+	case EQ:
+		return 0.1
+	case NEQ:
+		return 0.9
+	case LT, GT, LE, GE:
+		return 1.0 / 3
+	}
+	// pattern comparisons
+	return 0.25
+}
+
+// Checks if the node is a relation with an index on the passed column finding the rows of the
+// comparison or builds such an index.
+func hasIndex(node planNode, attr AttrInfo, comp Comparison) bool {
+	switch n := node.(type) {
+	case *relationNode:
+		idx := n.rel.findColumn(attr)
+		return idx != -1 && n.rel.Columns[idx].hasIndexFor(comp)
+	case *makeIndexNode:
+		if n.kind == BITMAP || n.kind == FULLTEXT || (n.kind == HASH && comp != EQ) {
+			return false
+		}
+		return n.col.Name == attr.Name && indexComparison(comp)
+	}
+	return false
+}
@@ -0,0 +1,288 @@
+package core
+
+/*
+	The delta store of a relation. Appending rows to the main columns of a relation is expensive,
+	their zone maps and indexes have to be changed with them and are copied for the snapshots of
+	running queries. Inserted rows are therefore appended to the delta, small columns of their
+	own without zone maps and indexes, which are cheap to extend. The rows of the delta follow
+	the rows of the main columns, their positions stay the same when they are merged, so the
+	deleted rows, the log and transactions refer to the rows of both by the same positions.
+
+	Queries see the rows of the main columns and of the delta: scans read the delta after the
+	main columns, index scans search the rows of the delta that are not indexed yet with the
+	predicate, and operators needing all rows at once combine both.
+
+	After every change a merge runs in the background. It appends the delta to a copy of the
+	main columns and adds the rows to their zone maps and indexes without locking the relation,
+	so readers and writers are not blocked by it. Only replacing the main columns locks the
+	relation shortly. Rows inserted meanwhile stay in the delta for the next merge, and if the
+	main columns were replaced meanwhile, e.g., by a new index or a compaction, the merge is
+	made again on the new columns.
+*/
+
+import "sort"
+
+/*
+	Merges the delta into the main columns at once instead of in the background, e.g., before
+	measuring queries on the merged columns.
+*/
+func (rel *Relation) MergeDelta() {
+	rel.mergeDelta()
+}
+
+// Appends the rows of the columns to the delta of the relation. The delta data is extended in
+// place, snapshots only see the rows up to their own length. The relation has to be locked for
+// writing.
+func (rel *Relation) appendDelta(cols []Column) {
+	if len(cols) == 0 || cols[0].length() == 0 {
+		return
+	}
+	delta := make([]Column, len(rel.Columns))
+	for i, col := range rel.Columns {
+		switch {
+		case rel.delta == nil:
+			delta[i] = Column{Signature: col.Signature, Data: newColumnData(col.Signature.Type, 0)}
+		case rel.ownsDelta:
+			delta[i] = rel.delta[i]
+		default:
+			// the delta of a snapshot is shared with its relation
+			view := rel.delta[i].view(allRows(rel.delta[i].length()))
+			delta[i] = view.materialize()
+		}
+		delta[i].appendRows(cols[i])
+	}
+	rel.delta, rel.ownsDelta = delta, true
+}
+
+// Appends the rows of the source column to the materialized column, the data is extended in
+// place.
+func (col *Column) appendRows(src Column) {
+	start := col.length()
+	src = src.materialize()
+	col.Data = col.Data.appendAll(src.Data)
+	if col.nulls != nil || src.nulls != nil {
+		if col.nulls == nil {
+			col.nulls = make([]bool, start)
+		}
+		if src.nulls == nil {
+			src.nulls = make([]bool, src.length())
+		}
+		col.nulls = append(col.nulls, src.nulls...)
+	}
+}
+
+// Starts merging the delta in the background unless a merge is running. The relation has to be
+// locked for writing.
+func (rel *Relation) scheduleMerge() {
+	if rel.merging || len(rel.delta) == 0 {
+		return
+	}
+	rel.merging = true
+	go rel.mergeDelta()
+}
+
+// Merges the delta into the main columns until it is empty.
+func (rel *Relation) mergeDelta() {
+	rel.mergeMu.Lock()
+	defer rel.mergeMu.Unlock()
+	for rel.mergeStep() {
+	}
+}
+
+// Merges the current rows of the delta into the main columns. Reports if the delta has to be
+// merged again. The caller holds mergeMu.
+func (rel *Relation) mergeStep() bool {
+	rel.mu.Lock()
+	if len(rel.delta) == 0 {
+		rel.merging = false
+		rel.mu.Unlock()
+		return false
+	}
+	start := &Relation{Name: rel.Name, Columns: rel.Columns, delta: rel.delta, indexes: copyIndexes(rel.indexes), ownsData: rel.ownsData}
+	rel.mu.Unlock()
+
+	merged := start.merged(true)
+
+	rel.mu.Lock()
+	defer rel.mu.Unlock()
+	if !sameColumns(rel.Columns, start.Columns) {
+		// the main columns were replaced meanwhile, e.g., by a new index or a compaction
+		return true
+	}
+	rel.Columns, rel.indexes, rel.ownsData = merged.Columns, merged.indexes, true
+	mergedRows, deltaRows := start.delta[0].length(), rel.delta[0].length()
+	if mergedRows == deltaRows {
+		rel.delta = nil
+		return false
+	}
+	// rows inserted during the merge stay in the delta
+	remaining := make([]int, deltaRows-mergedRows)
+	for i := range remaining {
+		remaining[i] = mergedRows + i
+	}
+	delta := make([]Column, len(rel.delta))
+	for i := range rel.delta {
+		view := rel.delta[i].view(remaining)
+		delta[i] = view.materialize()
+	}
+	rel.delta, rel.ownsDelta = delta, true
+	return true
+}
+
+// Returns a relation with the rows of the delta appended to the main columns, their zone maps
+// and indexes. The relation is not changed. If inPlace is set, the owned data of the main
+// columns is extended in place, which only one merge at a time may do.
+func (rel *Relation) merged(inPlace bool) *Relation {
+	result := &Relation{
+		Name: rel.Name, Columns: append([]Column{}, rel.Columns...), indexes: copyIndexes(rel.indexes),
+		ownsData: inPlace && rel.ownsData, stats: rel.stats, deleted: rel.deleted, lsn: rel.lsn,
+	}
+	if len(rel.delta) == 0 {
+		return result
+	}
+	result.ownData()
+	start := rel.mainRows()
+	for i := range result.Columns {
+		result.Columns[i].appendRows(rel.delta[i])
+	}
+	result.updateZones(start)
+	result.updateIndexes()
+	return result
+}
+
+// Copies the data of views and of relations sharing their data with other relations, so rows
+// can be appended to it. The positions of the rows and with them the indexes stay the same.
+func (rel *Relation) ownData() {
+	if rel.ownsData {
+		return
+	}
+	for i := range rel.Columns {
+		col := &rel.Columns[i]
+		rows := col.rows
+		if rows == nil {
+			rows = allRows(col.length())
+		}
+		col.Data = col.Data.Gather(rows)
+		if col.nulls != nil {
+			col.nulls = gather(col.nulls, rows)
+		}
+		col.rows = nil
+	}
+	rel.ownsData = true
+}
+
+// Returns copies of the catalog entries of the indexes.
+func copyIndexes(indexes []*indexInfo) []*indexInfo {
+	result := make([]*indexInfo, len(indexes))
+	for i, info := range indexes {
+		copied := *info
+		result[i] = &copied
+	}
+	return result
+}
+
+// Checks if both slices are the same columns of a relation.
+func sameColumns(a, b []Column) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// Returns the number of rows of the main columns.
+func (rel *Relation) mainRows() int {
+	if len(rel.Columns) == 0 {
+		return 0
+	}
+	return rel.Columns[0].length()
+}
+
+// Returns the number of rows of the main columns and the delta including the deleted rows.
+func (rel *Relation) length() int {
+	if len(rel.delta) == 0 {
+		return rel.mainRows()
+	}
+	return rel.mainRows() + rel.delta[0].length()
+}
+
+// Returns the columns of the rows at the positions, positions from the number of rows of the
+// main columns on are rows of the delta. Rows of the main columns or of the delta only are
+// views on their data, rows of both are copied into new columns.
+func (rel *Relation) gather(rows []int) []Column {
+	main := rel.mainRows()
+	mainRows, deltaRows := make([]int, 0, len(rows)), make([]int, 0)
+	ascending := true
+	for k, row := range rows {
+		if row < main {
+			mainRows = append(mainRows, row)
+		} else {
+			deltaRows = append(deltaRows, row-main)
+		}
+		ascending = ascending && (k == 0 || rows[k-1] < row)
+	}
+	switch {
+	case len(deltaRows) == 0:
+		return selectColumns(rel.Columns, rows)
+	case len(mainRows) == 0:
+		return selectColumns(rel.delta, deltaRows)
+	}
+
+	result := make([]Column, len(rel.Columns))
+	if ascending {
+		mainPart, deltaPart := selectColumns(rel.Columns, mainRows), selectColumns(rel.delta, deltaRows)
+		combined := make([]combinedRows, 0)
+		for i, col := range rel.Columns {
+			result[i] = concatColumns(col.Signature, []Column{mainPart[i], deltaPart[i]}, &combined)
+		}
+		return result
+	}
+	// rows in the order of the values of an index mix the rows of both
+	for i := range rel.Columns {
+		sig := rel.Columns[i].Signature
+		result[i] = Column{Signature: sig, Data: newColumnData(sig.Type, len(rows))}
+		for k, row := range rows {
+			src, j := &rel.Columns[i], row
+			if row >= main {
+				src, j = &rel.delta[i], row-main
+			}
+			if src.isNull(j) {
+				result[i].setNull(k, len(rows))
+			} else {
+				result[i].set(k, *src, j)
+			}
+		}
+	}
+	return result
+}
+
+// Returns the positions of the rows of the main columns and the delta meeting the predicate,
+// deleted rows are left out.
+func (rel *Relation) filter(pred Predicate) []int {
+	live := rel.liveRows()
+	main := sort.SearchInts(live, rel.mainRows())
+	return append(pred.filter(rel.Columns, live[:main:main]), rel.filterDelta(pred)...)
+}
+
+// Returns the positions of the rows of the delta meeting the predicate, deleted rows are left out.
+func (rel *Relation) filterDelta(pred Predicate) []int {
+	if len(rel.delta) == 0 {
+		return make([]int, 0)
+	}
+	main := rel.mainRows()
+	candidates := make([]int, 0, rel.delta[0].length())
+	for row := 0; row < rel.delta[0].length(); row++ {
+		if rel.deleted == nil || !rel.deleted.contains(main+row) {
+			candidates = append(candidates, row)
+		}
+	}
+	cols := rel.delta
+	for _, attr := range pred.attrs() {
+		// Match predicates split the rows of the delta like the index of the main column
+		if idx := findColumnIn(cols, attr); idx != -1 && rel.Columns[idx].fulltext != nil && cols[idx].fulltext == nil {
+			cols = append([]Column{}, cols...)
+			cols[idx].createFullTextIndex(rel.Columns[idx].fulltext.tokenizer)
+		}
+	}
+	rows := pred.filter(cols, candidates)
+	for i := range rows {
+		rows[i] += main
+	}
+	return rows
+}
@@ -0,0 +1,379 @@
+package core
+
+/*
+	Explain shows the optimized plan of a query as a tree with one operator per line. Joins
+	show the chosen algorithm, the input the hash table or index is built on and the
+	estimated cost. ExplainAnalyze runs the plan with every operator wrapped by an iterator
+	measuring the produced rows, the wall time and the allocated memory. The time and memory
+	of an operator do not include its inputs, so the expensive operators stand out. Both are
+	available as text and as JSON.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// An operator of an explained plan. The statistics are only collected by ExplainAnalyze.
+type explainEntry struct {
+	Operator      string          `json:"operator"`
+	EstimatedRows float64         `json:"estimated_rows"`
+	Actual        *operatorStats  `json:"actual,omitempty"`
+	Inputs        []*explainEntry `json:"inputs,omitempty"`
+}
+
+// The measured execution of an operator.
+type operatorStats struct {
+	Rows      int             `json:"rows"`
+	Time      time.Duration   `json:"time_ns"`
+	Allocated uint64          `json:"allocated_bytes"`
+	HashTable *hashTableStats `json:"hash_table,omitempty"`
+}
+
+// The result of Explain and ExplainAnalyze, the totals are only set by ExplainAnalyze.
+type explainResult struct {
+	Plan  *explainEntry  `json:"plan"`
+	Total *operatorStats `json:"total,omitempty"`
+}
+
+// The node executing an operator of the plan with an analyzeIterator.
+type analyzeNode struct {
+	node  planNode
+	stats *operatorStats
+}
+
+// Measures the calls of the iterator of an operator, including the calls of its inputs.
+type analyzeIterator struct {
+	child Iterator
+	stats *operatorStats
+}
+
+// An analyzeIterator for operators returning an existing relation.
+type analyzeSourceIterator struct {
+	*analyzeIterator
+}
+
+// The names of the join algorithms used by Explain.
+var joinAlgorithmNames = map[joinAlgorithm]string{
+	autoJoinAlgorithm:            "Join",
+	nestedLoopJoinAlgorithm:      "NestedLoopJoin",
+	indexNestedLoopJoinAlgorithm: "IndexNestedLoopJoin",
+	hashJoinAlgorithm:            "HashJoin",
+	parallelHashJoinAlgorithm:    "ParallelHashJoin",
+}
+
+func (rel *Relation) Explain() string {
+	return explain(&relationNode{rel: rel.snapshot()}).text()
+}
+
+func (rel *Relation) ExplainJSON() string {
+	return explain(&relationNode{rel: rel.snapshot()}).json()
+}
+
+func (rel *Relation) ExplainAnalyze() string {
+	return analyze(&relationNode{rel: rel.snapshot()}).text()
+}
+
+func (rel *Relation) ExplainAnalyzeJSON() string {
+	return analyze(&relationNode{rel: rel.snapshot()}).json()
+}
+
+func (p *Plan) Explain() string {
+	return explain(optimize(p.root)).text()
+}
+
+func (p *Plan) ExplainJSON() string {
+	return explain(optimize(p.root)).json()
+}
+
+func (p *Plan) ExplainAnalyze() string {
+	return analyze(optimize(p.root)).text()
+}
+
+func (p *Plan) ExplainAnalyzeJSON() string {
+	return analyze(optimize(p.root)).json()
+}
+
+// Returns the tree of the plan with the passed root.
+func explain(root planNode) *explainResult {
+	return &explainResult{Plan: explainTree(root)}
+}
+
+// Returns the entries of the node and its inputs.
+func explainTree(node planNode) *explainEntry {
+	entry := newExplainEntry(node)
+	for _, child := range planInputs(node) {
+		entry.Inputs = append(entry.Inputs, explainTree(child))
+	}
+	return entry
+}
+
+// Returns the entry of the node without its inputs.
+func newExplainEntry(node planNode) *explainEntry {
+	return &explainEntry{Operator: describeNode(node), EstimatedRows: math.Round(estimateRows(node))}
+}
+
+// Runs the plan with the passed root and returns its tree with the measured statistics. The
+// produced rows are dropped, so the time of a sink is not part of the result.
+func analyze(root planNode) *explainResult {
+	instrumented, entry := instrument(root)
+	it := instrumented.iterator()
+	it.Open()
+	for it.Next() != nil {
+	}
+	it.Close()
+
+	total := *entry.Actual
+	entry.withoutInputs()
+	return &explainResult{Plan: entry, Total: &total}
+}
+
+// Wraps the node and its inputs by analyzeNodes and returns their entries.
+func instrument(node planNode) (planNode, *explainEntry) {
+	entry := newExplainEntry(node)
+	entry.Actual = &operatorStats{}
+	wrapped := withChildren(node, func(child planNode) planNode {
+		instrumented, input := instrument(child)
+		entry.Inputs = append(entry.Inputs, input)
+		return instrumented
+	})
+	return &analyzeNode{node: wrapped, stats: entry.Actual}, entry
+}
+
+// Subtracts the time and memory of the inputs from the measured time and memory of the operators.
+func (e *explainEntry) withoutInputs() {
+	for _, input := range e.Inputs {
+		e.Actual.Time -= input.Actual.Time
+		if input.Actual.Allocated < e.Actual.Allocated {
+			e.Actual.Allocated -= input.Actual.Allocated
+		} else {
+			e.Actual.Allocated = 0
+		}
+		input.withoutInputs()
+	}
+	// the measurement of the inputs takes time too
+	if e.Actual.Time < 0 {
+		e.Actual.Time = 0
+	}
+}
+
+// Returns the tree with one operator per line.
+func (r *explainResult) text() string {
+	var builder strings.Builder
+	r.Plan.write(&builder, 0)
+	if r.Total != nil {
+		fmt.Fprintf(&builder, "Execution time: %v, allocated: %s\n", r.Total.Time, formatBytes(r.Total.Allocated))
+	}
+	return builder.String()
+}
+
+func (r *explainResult) json() string {
+	var builder strings.Builder
+	encoder := json.NewEncoder(&builder)
+	// comparisons like ">=" are kept readable
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	checkError(encoder.Encode(r))
+	return builder.String()
+}
+
+// Writes the line of the operator and the lines of its inputs with a deeper indentation.
+func (e *explainEntry) write(builder *strings.Builder, depth int) {
+	builder.WriteString(strings.Repeat("  ", depth))
+	builder.WriteString(e.Operator)
+	fmt.Fprintf(builder, " (rows: %.0f", e.EstimatedRows)
+	if stats := e.Actual; stats != nil {
+		fmt.Fprintf(builder, ", actual rows: %d, time: %v, allocated: %s", stats.Rows, stats.Time, formatBytes(stats.Allocated))
+		if table := stats.HashTable; table != nil {
+			fmt.Fprintf(builder, ", hash table: %d entries in %d buckets, %d collisions", table.Entries, table.Buckets, table.Collisions)
+		}
+	}
+	builder.WriteString(")\n")
+
+	for _, input := range e.Inputs {
+		input.write(builder, depth+1)
+	}
+}
+
+func (n *analyzeNode) name() string {
+	return n.node.name()
+}
+
+func (n *analyzeNode) schema() []AttrInfo {
+	return n.node.schema()
+}
+
+func (n *analyzeNode) iterator() Iterator {
+	it := &analyzeIterator{child: n.node.iterator(), stats: n.stats}
+	if _, ok := it.child.(relationSource); ok {
+		// joins and index scans use the relation without copying it
+		return &analyzeSourceIterator{it}
+	}
+	return it
+}
+
+func (it *analyzeIterator) Open() {
+	it.measure(it.child.Open)
+	if join, ok := it.child.(*joinIterator); ok && join.table != nil {
+		it.stats.HashTable = join.table.stats()
+	}
+}
+
+func (it *analyzeIterator) Next() *Batch {
+	var batch *Batch
+	it.measure(func() {
+		batch = it.child.Next()
+	})
+	if batch != nil {
+		it.stats.Rows += batch.RowCount()
+	}
+	return batch
+}
+
+func (it *analyzeIterator) Close() {
+	it.measure(it.child.Close)
+}
+
+func (it *analyzeIterator) Schema() []AttrInfo {
+	return it.child.Schema()
+}
+
+// Adds the wall time and the allocated memory of the call to the statistics.
+func (it *analyzeIterator) measure(call func()) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	call()
+	it.stats.Time += time.Since(start)
+	runtime.ReadMemStats(&after)
+	it.stats.Allocated += after.TotalAlloc - before.TotalAlloc
+}
+
+func (it *analyzeSourceIterator) relation() *Relation {
+	var rel *Relation
+	it.measure(func() {
+		rel = it.child.(relationSource).relation()
+	})
+	if len(rel.Columns) > 0 {
+		it.stats.Rows += rel.liveCount()
+	}
+	return rel
+}
+
+// Returns the description of the operator of the node without its inputs.
+func describeNode(node planNode) string {
+	switch n := node.(type) {
+	case *relationNode:
+		if n.blockFilter != nil {
+			return fmt.Sprintf("Relation %s, skipped blocks: %d of %d", n.rel.Name, n.rel.skippedBlocks(n.blockFilter), n.rel.blockCount())
+		}
+		return "Relation " + n.rel.Name
+	case *selectNode:
+		return "Select on " + attrNames(n.pred.attrs())
+	case *scanNode:
+		return "Scan " + attrNames(n.cols)
+	case *projectNode:
+		names := make([]AttrInfo, len(n.exprs))
+		for i, named := range n.exprs {
+			names[i].Name = named.Name
+		}
+		return "Project " + attrNames(names)
+	case *collateNode:
+		return fmt.Sprintf("Collate %s with '%s'", n.col.Name, n.coll)
+	case *orderByNode:
+		if n.descending {
+			return "OrderBy " + n.col.Name + " descending"
+		}
+		return "OrderBy " + n.col.Name
+	case *makeIndexNode:
+		if n.kind != HASH {
+			return fmt.Sprintf("MakeIndex %s on %s", n.kind, n.col.Name)
+		}
+		return "MakeIndex on " + n.col.Name
+	case *indexScanNode:
+		if source, ok := n.child.(*relationNode); ok && !n.indexed(source.rel) {
+			return "IndexScan " + describeIndexPredicate(n.pred) + ", no index: all rows are filtered"
+		}
+		return "IndexScan " + describeIndexPredicate(n.pred)
+	case *joinNode:
+		build := "second"
+		if n.buildFirst {
+			build = "first"
+		}
+		// the join keeps the rows where "second comp first" is true
+		return fmt.Sprintf("%s %s on %s %s %s, build: %s, cost: %.0f",
+			joinAlgorithmNames[n.algorithm], n.kind, n.fattr.Name, flip(n.comp), n.sattr.Name, build, n.cost)
+	case *multiJoinNode:
+		return "MultiJoin of " + strings.Join(n.names, ", ")
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+// Returns the predicate of an index scan as text, predicates combining several comparisons
+// are only described by their columns.
+func describeIndexPredicate(pred Predicate) string {
+	switch p := pred.(type) {
+	case *comparePredicate:
+		return fmt.Sprintf("where %s %s %v", p.col.Name, p.comp, p.compVal)
+	case *betweenPredicate:
+		return fmt.Sprintf("where %s between %v and %v", p.col.Name, p.lo, p.hi)
+	case *matchPredicate:
+		return fmt.Sprintf("where %s matches %q", p.col.Name, p.query)
+	}
+	cols := make([]AttrInfo, 0)
+	for _, attr := range pred.attrs() {
+		if findAttr(cols, attr) == -1 {
+			cols = append(cols, attr)
+		}
+	}
+	return "on bitmaps of " + attrNames(cols)
+}
+
+// Returns the inputs of the node in the order of their columns.
+func planInputs(node planNode) []planNode {
+	switch n := node.(type) {
+	case *selectNode:
+		return []planNode{n.child}
+	case *scanNode:
+		return []planNode{n.child}
+	case *projectNode:
+		return []planNode{n.child}
+	case *collateNode:
+		return []planNode{n.child}
+	case *orderByNode:
+		return []planNode{n.child}
+	case *makeIndexNode:
+		return []planNode{n.child}
+	case *indexScanNode:
+		return []planNode{n.child}
+	case *joinNode:
+		return []planNode{n.first, n.second}
+	case *multiJoinNode:
+		return n.inputs
+	}
+	return nil
+}
+
+// Returns the number of bytes with a readable unit.
+func formatBytes(bytes uint64) string {
+	switch {
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
+
+// Returns the comma separated names of the columns.
+func attrNames(attrs []AttrInfo) string {
+	names := make([]string, len(attrs))
+	for i, attr := range attrs {
+		names[i] = attr.Name
+	}
+	return strings.Join(names, ", ")
+}
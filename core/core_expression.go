@@ -0,0 +1,607 @@
+package core
+
+/*
+	Expressions for computed columns used by Relation.Project. Expressions are type checked
+	against the columns of a relation before any row is evaluated and are evaluated for all
+	rows at once, every expression returns a whole column. NULL values propagate through
+	arithmetic and string functions.
+*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+	The Expr interface is implemented by all expressions.
+*/
+type Expr interface {
+	// Returns the type of the expression for the passed columns or an error if it is not well typed.
+	check(cols []Column) (DataTypes, error)
+	// Evaluates the expression for the rows at the passed positions.
+	eval(cols []Column, rows []int) Column
+	// Returns the columns used by the expression.
+	attrs() []AttrInfo
+	// Returns the expression with all constant subexpressions replaced by their values.
+	fold() Expr
+}
+
+/*
+	A NamedExpr is an expression and the name of the column it computes.
+*/
+type NamedExpr struct {
+	Name string
+	Expr Expr
+}
+
+/*
+	A When is a branch of a Case expression. The expression Then is used for all rows meeting Cond.
+*/
+type When struct {
+	Cond Predicate
+	Then Expr
+}
+
+type columnExpr struct {
+	col AttrInfo
+}
+
+type constExpr struct {
+	type_ DataTypes
+	value interface{} // nil for NULL
+}
+
+type arithExpr struct {
+	op    byte
+	left  Expr
+	right Expr
+}
+
+type stringFuncExpr struct {
+	name string
+	args []Expr
+}
+
+type caseExpr struct {
+	whens []When
+	else_ Expr
+}
+
+type castExpr struct {
+	expr  Expr
+	type_ DataTypes
+}
+
+type coalesceExpr struct {
+	exprs []Expr
+}
+
+/*
+	References the column with the passed name.
+*/
+func Col(name string) Expr {
+	return &columnExpr{col: AttrInfo{Name: name}}
+}
+
+/*
+	A constant value of type int, float64 or string.
+*/
+func Const(value interface{}) Expr {
+	switch value.(type) {
+	case int:
+		return &constExpr{type_: INT, value: value}
+	case float64:
+		return &constExpr{type_: FLOAT, value: value}
+	case string:
+		return &constExpr{type_: STRING, value: value}
+	}
+	error_("Unsupported constant of type '%T'.", value)
+	return nil
+}
+
+/*
+	A NULL value of the passed type.
+*/
+func Null(type_ DataTypes) Expr {
+	return &constExpr{type_: type_}
+}
+
+/*
+	Arithmetic on INT and FLOAT expressions. The result is an INT if both operands are INTs
+	and a FLOAT otherwise. A division by zero results in NULL.
+*/
+func Add(left, right Expr) Expr { return &arithExpr{op: '+', left: left, right: right} }
+func Sub(left, right Expr) Expr { return &arithExpr{op: '-', left: left, right: right} }
+func Mul(left, right Expr) Expr { return &arithExpr{op: '*', left: left, right: right} }
+func Div(left, right Expr) Expr { return &arithExpr{op: '/', left: left, right: right} }
+
+/*
+	String functions on STRING expressions. Substring uses 1-based positions like SQL.
+*/
+func Upper(expr Expr) Expr               { return &stringFuncExpr{name: "upper", args: []Expr{expr}} }
+func Lower(expr Expr) Expr               { return &stringFuncExpr{name: "lower", args: []Expr{expr}} }
+func Length(expr Expr) Expr              { return &stringFuncExpr{name: "length", args: []Expr{expr}} }
+func Concat(exprs ...Expr) Expr          { return &stringFuncExpr{name: "concat", args: exprs} }
+func Substring(expr, start, length Expr) Expr {
+	return &stringFuncExpr{name: "substring", args: []Expr{expr, start, length}}
+}
+
+/*
+	CASE WHEN ... THEN ... ELSE ... END. The first matching branch is used for every row.
+	All branches must have the same type. A nil else expression results in NULL.
+*/
+func Case(whens []When, else_ Expr) Expr {
+	return &caseExpr{whens: whens, else_: else_}
+}
+
+/*
+	Converts an expression into another type. Strings that can not be parsed result in NULL.
+*/
+func Cast(expr Expr, type_ DataTypes) Expr {
+	return &castExpr{expr: expr, type_: type_}
+}
+
+/*
+	Returns the first value that is not NULL. All expressions must have the same type.
+*/
+func Coalesce(exprs ...Expr) Expr {
+	return &coalesceExpr{exprs: exprs}
+}
+
+/*
+	Checks the types of all expressions against the columns of the passed relation.
+	Returns the first error found.
+*/
+func TypeCheck(rel Relationer, exprs []NamedExpr) error {
+	for _, named := range exprs {
+		if named.Expr == nil {
+			return fmt.Errorf("missing expression for column '%s'", named.Name)
+		}
+		if _, err := named.Expr.check(schemaColumns(rel.schema())); err != nil {
+			return fmt.Errorf("column '%s': %w", named.Name, err)
+		}
+	}
+	return nil
+}
+
+func (e *columnExpr) check(cols []Column) (DataTypes, error) {
+	for _, col := range cols {
+		if col.Signature.Name == e.col.Name {
+			return col.Signature.Type, nil
+		}
+	}
+	return INT, fmt.Errorf("unknown column '%s'", e.col.Name)
+}
+
+func (e *columnExpr) eval(cols []Column, rows []int) Column {
+	return cols[columnIndex(cols, e.col)].view(rows)
+}
+
+func (e *constExpr) check(cols []Column) (DataTypes, error) {
+	return e.type_, nil
+}
+
+func (e *constExpr) eval(cols []Column, rows []int) Column {
+	result := Column{Signature: AttrInfo{Type: e.type_}, Data: newColumnData(e.type_, len(rows))}
+	if e.value == nil {
+		result.nulls = make([]bool, len(rows))
+		for i := range result.nulls {
+			result.nulls[i] = true
+		}
+		return result
+	}
+	for i := range rows {
+		result.Data.Set(i, e.value)
+	}
+	return result
+}
+
+func (e *arithExpr) check(cols []Column) (DataTypes, error) {
+	left, err := e.left.check(cols)
+	if err != nil {
+		return INT, err
+	}
+	right, err := e.right.check(cols)
+	if err != nil {
+		return INT, err
+	}
+	if left == STRING || right == STRING {
+		return INT, fmt.Errorf("operator '%c' is not defined for strings", e.op)
+	}
+	if left == FLOAT || right == FLOAT {
+		return FLOAT, nil
+	}
+	return INT, nil
+}
+
+func (e *arithExpr) eval(cols []Column, rows []int) Column {
+	left := e.left.eval(cols, rows)
+	right := e.right.eval(cols, rows)
+	if left.isInt() && right.isInt() {
+		return arithmetic(e.op, left, right, ints(left), ints(right), INT)
+	}
+	return arithmetic(e.op, left, right, floats(left), floats(right), FLOAT)
+}
+
+func (e *stringFuncExpr) check(cols []Column) (DataTypes, error) {
+	if e.name == "substring" {
+		if err := expectTypes(cols, e.args, STRING, INT, INT); err != nil {
+			return INT, err
+		}
+		return STRING, nil
+	}
+	for _, arg := range e.args {
+		if err := expectTypes(cols, []Expr{arg}, STRING); err != nil {
+			return INT, err
+		}
+	}
+	if e.name == "length" {
+		return INT, nil
+	}
+	return STRING, nil
+}
+
+func (e *stringFuncExpr) eval(cols []Column, rows []int) Column {
+	args := make([]Column, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.eval(cols, rows)
+	}
+
+	type_ := STRING
+	if e.name == "length" {
+		type_ = INT
+	}
+	result := Column{Signature: AttrInfo{Type: type_}, Data: newColumnData(type_, len(rows))}
+	for i := range rows {
+		if anyNull(args, i) {
+			result.setNull(i, len(rows))
+			continue
+		}
+		switch e.name {
+		case "upper":
+			values[string](result.Data)[i] = strings.ToUpper(args[0].stringAt(i))
+		case "lower":
+			values[string](result.Data)[i] = strings.ToLower(args[0].stringAt(i))
+		case "length":
+			values[int](result.Data)[i] = len([]rune(args[0].stringAt(i)))
+		case "concat":
+			var builder strings.Builder
+			for _, arg := range args {
+				builder.WriteString(arg.stringAt(i))
+			}
+			values[string](result.Data)[i] = builder.String()
+		case "substring":
+			values[string](result.Data)[i] = substring(args[0].stringAt(i), args[1].intAt(i), args[2].intAt(i))
+		}
+	}
+	return result
+}
+
+func (e *caseExpr) check(cols []Column) (DataTypes, error) {
+	if len(e.whens) == 0 {
+		return INT, fmt.Errorf("case without when")
+	}
+	type_, err := e.whens[0].Then.check(cols)
+	if err != nil {
+		return INT, err
+	}
+	branches := []Expr{}
+	for _, when := range e.whens {
+		if when.Cond == nil {
+			return INT, fmt.Errorf("when without condition")
+		}
+		if err := when.Cond.check(cols); err != nil {
+			return INT, err
+		}
+		branches = append(branches, when.Then)
+	}
+	if e.else_ != nil {
+		branches = append(branches, e.else_)
+	}
+	for _, branch := range branches {
+		if err := expectTypes(cols, []Expr{branch}, type_); err != nil {
+			return INT, fmt.Errorf("case branches with different types: %w", err)
+		}
+	}
+	return type_, nil
+}
+
+func (e *caseExpr) eval(cols []Column, rows []int) Column {
+	type_, _ := e.check(cols)
+	result := Column{Signature: AttrInfo{Type: type_}, Data: newColumnData(type_, len(rows))}
+
+	// positions inside rows that are not handled by a previous branch
+	remaining := allRows(len(rows))
+	for _, when := range e.whens {
+		if len(remaining) == 0 {
+			break
+		}
+		matched := when.Cond.filter(cols, gather(rows, remaining))
+		// translate the matched rows back to positions inside rows
+		positions := make([]int, 0, len(matched))
+		j := 0
+		for _, pos := range remaining {
+			if j < len(matched) && rows[pos] == matched[j] {
+				positions = append(positions, pos)
+				j++
+			}
+		}
+		result.scatter(when.Then.eval(cols, matched), positions, len(rows))
+		remaining = difference(remaining, positions)
+	}
+
+	if e.else_ != nil {
+		result.scatter(e.else_.eval(cols, gather(rows, remaining)), remaining, len(rows))
+	} else {
+		for _, pos := range remaining {
+			result.setNull(pos, len(rows))
+		}
+	}
+	return result
+}
+
+func (e *castExpr) check(cols []Column) (DataTypes, error) {
+	if _, err := e.expr.check(cols); err != nil {
+		return INT, err
+	}
+	return e.type_, nil
+}
+
+func (e *castExpr) eval(cols []Column, rows []int) Column {
+	value := e.expr.eval(cols, rows)
+	if value.Signature.Type == e.type_ {
+		return value
+	}
+	result := Column{Signature: AttrInfo{Type: e.type_}, Data: newColumnData(e.type_, len(rows))}
+	for i := range rows {
+		if value.isNull(i) {
+			result.setNull(i, len(rows))
+			continue
+		}
+		switch e.type_ {
+		case INT:
+			if value.isFloat() {
+				values[int](result.Data)[i] = int(value.floatAt(i))
+			} else if parsed, err := strconv.Atoi(strings.TrimSpace(value.stringAt(i))); err == nil {
+				values[int](result.Data)[i] = parsed
+			} else {
+				result.setNull(i, len(rows))
+			}
+		case FLOAT:
+			if value.isInt() {
+				values[float64](result.Data)[i] = float64(value.intAt(i))
+			} else if parsed, err := strconv.ParseFloat(strings.TrimSpace(value.stringAt(i)), 64); err == nil {
+				values[float64](result.Data)[i] = parsed
+			} else {
+				result.setNull(i, len(rows))
+			}
+		case STRING:
+			if value.isInt() {
+				values[string](result.Data)[i] = strconv.Itoa(value.intAt(i))
+			} else {
+				values[string](result.Data)[i] = strconv.FormatFloat(value.floatAt(i), 'f', -1, 64)
+			}
+		}
+	}
+	return result
+}
+
+func (e *coalesceExpr) check(cols []Column) (DataTypes, error) {
+	if len(e.exprs) == 0 {
+		return INT, fmt.Errorf("coalesce without arguments")
+	}
+	type_, err := e.exprs[0].check(cols)
+	if err != nil {
+		return INT, err
+	}
+	if err := expectTypes(cols, e.exprs, type_); err != nil {
+		return INT, fmt.Errorf("coalesce with different types: %w", err)
+	}
+	return type_, nil
+}
+
+func (e *coalesceExpr) eval(cols []Column, rows []int) Column {
+	values := make([]Column, len(e.exprs))
+	for i, expr := range e.exprs {
+		values[i] = expr.eval(cols, rows)
+	}
+	result := Column{Signature: AttrInfo{Type: values[0].Signature.Type}, Data: newColumnData(values[0].Signature.Type, len(rows))}
+	for i := range rows {
+		result.setNull(i, len(rows))
+		for _, value := range values {
+			if !value.isNull(i) {
+				result.set(i, value, i)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (e *columnExpr) attrs() []AttrInfo { return []AttrInfo{e.col} }
+func (e *constExpr) attrs() []AttrInfo  { return nil }
+func (e *arithExpr) attrs() []AttrInfo  { return exprAttrs([]Expr{e.left, e.right}) }
+func (e *stringFuncExpr) attrs() []AttrInfo {
+	return exprAttrs(e.args)
+}
+func (e *castExpr) attrs() []AttrInfo     { return e.expr.attrs() }
+func (e *coalesceExpr) attrs() []AttrInfo { return exprAttrs(e.exprs) }
+
+func (e *caseExpr) attrs() []AttrInfo {
+	attrs := make([]AttrInfo, 0)
+	for _, when := range e.whens {
+		attrs = append(attrs, when.Cond.attrs()...)
+		attrs = append(attrs, when.Then.attrs()...)
+	}
+	if e.else_ != nil {
+		attrs = append(attrs, e.else_.attrs()...)
+	}
+	return attrs
+}
+
+func (e *columnExpr) fold() Expr {
+	return e
+}
+
+func (e *constExpr) fold() Expr {
+	return e
+}
+
+func (e *arithExpr) fold() Expr {
+	folded := &arithExpr{op: e.op, left: e.left.fold(), right: e.right.fold()}
+	return constant(folded, folded.left, folded.right)
+}
+
+func (e *stringFuncExpr) fold() Expr {
+	folded := &stringFuncExpr{name: e.name, args: foldAll(e.args)}
+	return constant(folded, folded.args...)
+}
+
+func (e *caseExpr) fold() Expr {
+	// the conditions depend on the rows, only the branches are folded
+	folded := &caseExpr{whens: make([]When, len(e.whens))}
+	for i, when := range e.whens {
+		folded.whens[i] = When{Cond: when.Cond, Then: when.Then.fold()}
+	}
+	if e.else_ != nil {
+		folded.else_ = e.else_.fold()
+	}
+	return folded
+}
+
+func (e *castExpr) fold() Expr {
+	folded := &castExpr{expr: e.expr.fold(), type_: e.type_}
+	return constant(folded, folded.expr)
+}
+
+func (e *coalesceExpr) fold() Expr {
+	folded := &coalesceExpr{exprs: foldAll(e.exprs)}
+	// a leading constant that is not NULL is always the result
+	if first, ok := folded.exprs[0].(*constExpr); ok && first.value != nil {
+		return first
+	}
+	return constant(folded, folded.exprs...)
+}
+
+/*
+-------------------------------------------------
+Expression intern helper functions
+-------------------------------------------------
+*/
+
+// Returns the columns used by all passed expressions.
+func exprAttrs(exprs []Expr) []AttrInfo {
+	attrs := make([]AttrInfo, 0)
+	for _, expr := range exprs {
+		attrs = append(attrs, expr.attrs()...)
+	}
+	return attrs
+}
+
+// Folds all passed expressions.
+func foldAll(exprs []Expr) []Expr {
+	folded := make([]Expr, len(exprs))
+	for i, expr := range exprs {
+		folded[i] = expr.fold()
+	}
+	return folded
+}
+
+// Replaces the expression by its value if all of its arguments are constants.
+func constant(expr Expr, args ...Expr) Expr {
+	for _, arg := range args {
+		if _, ok := arg.(*constExpr); !ok {
+			return expr
+		}
+	}
+	type_, err := expr.check(nil)
+	if err != nil {
+		// errors are reported by the type check of the whole projection
+		return expr
+	}
+	value := expr.eval(nil, []int{0})
+	if value.isNull(0) {
+		return Null(type_)
+	}
+	return &constExpr{type_: type_, value: value.valueAt(0)}
+}
+
+// Checks that the expressions have the passed types. A single type is used for all expressions.
+func expectTypes(cols []Column, exprs []Expr, types ...DataTypes) error {
+	for i, expr := range exprs {
+		expected := types[0]
+		if len(types) > 1 {
+			expected = types[i]
+		}
+		actual, err := expr.check(cols)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			return fmt.Errorf("expected %s but got %s", expected, actual)
+		}
+	}
+	return nil
+}
+
+// Applies an arithmetic operator to the values of both columns.
+func arithmetic[T int | float64](op byte, left, right Column, leftData, rightData []T, type_ DataTypes) Column {
+	result := Column{Signature: AttrInfo{Type: type_}}
+	data := make([]T, len(leftData))
+	arithmeticKernel(op, leftData, rightData, data)
+	result.Data = NewTypedColumn(data)
+
+	// NULL values and divisions by zero result in NULL
+	for i := range data {
+		if left.isNull(i) || right.isNull(i) || (op == '/' && rightData[i] == 0) {
+			result.setNull(i, len(data))
+		}
+	}
+	return result
+}
+
+// Returns the values of an INT column in a new array.
+func ints(col Column) []int {
+	return values[int](col.materialize().Data)
+}
+
+// Returns the values of an INT or FLOAT column as floats in a new array.
+func floats(col Column) []float64 {
+	if col.isFloat() {
+		return values[float64](col.materialize().Data)
+	}
+	values := make([]float64, col.length())
+	for i := range values {
+		values[i] = float64(col.intAt(i))
+	}
+	return values
+}
+
+// Checks if one of the columns has a NULL value in the i-th row.
+func anyNull(cols []Column, i int) bool {
+	for _, col := range cols {
+		if col.isNull(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the substring with the passed 1-based start and length in characters.
+func substring(value string, start, length int) string {
+	runes := []rune(value)
+	from := start - 1
+	if from < 0 {
+		length += from
+		from = 0
+	}
+	if from > len(runes) || length <= 0 {
+		return ""
+	}
+	to := from + length
+	if to > len(runes) {
+		to = len(runes)
+	}
+	return string(runes[from:to])
+}
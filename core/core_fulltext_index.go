@@ -0,0 +1,268 @@
+package core
+
+/*
+	Full-text indexes store for every token of a STRING column the rows containing it together
+	with the positions of the token inside the values, so Match predicates find the rows of their
+	terms and phrases without reading the column. The values are split into tokens by the
+	tokenizer of the index, the terms of the queries are split by the same tokenizer.
+
+	A query consists of terms separated by white space that all have to be found in a row. The
+	keyword OR separates alternatives, AND binds stronger than OR: "rot grün OR blau" matches the
+	rows containing rot and grün or containing blau. Terms in double quotes are phrases whose
+	tokens have to follow each other, terms the tokenizer splits into several tokens are phrases
+	as well.
+*/
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The rows of a token in ascending order and the positions of the token inside every row.
+type postingList struct {
+	rows      []int
+	positions [][]int
+}
+
+// The posting lists of the tokens of a column.
+type fulltextIndex struct {
+	tokenizer Tokenizer
+	postings  map[string]*postingList
+	// The number of rows with a value, NULL values are not indexed.
+	rows int
+}
+
+// A parsed query, the alternatives of the terms that all have to be found in a row.
+type matchQuery [][]string
+
+// Builds the full-text index of the column with the tokenizer if it has none.
+func (col *Column) createFullTextIndex(tokenizer Tokenizer) {
+	if col.fulltext != nil {
+		return
+	}
+	if !col.isString() {
+		error_("FULLTEXT indexes are only supported for strings, '%s' is not a string column.", col.Signature.Name)
+	}
+	col.fulltext = &fulltextIndex{tokenizer: tokenizer, postings: make(map[string]*postingList)}
+	for i := 0; i < col.length(); i++ {
+		col.fulltext.add(i, col)
+	}
+}
+
+// Adds the tokens of the i-th row of the column. The rows have to be added in ascending order.
+func (idx *fulltextIndex) add(i int, col *Column) {
+	if col.isNull(i) {
+		return
+	}
+	idx.rows++
+	for pos, token := range idx.tokenizer.tokens(col.stringAt(i)) {
+		list := idx.postings[token]
+		if list == nil {
+			list = &postingList{}
+			idx.postings[token] = list
+		}
+		if n := len(list.rows); n == 0 || list.rows[n-1] != i {
+			list.rows = append(list.rows, i)
+			list.positions = append(list.positions, nil)
+		}
+		list.positions[len(list.positions)-1] = append(list.positions[len(list.positions)-1], pos)
+	}
+}
+
+// Returns a copy of the index that rows can be added to without changing this index.
+func (idx *fulltextIndex) copy() *fulltextIndex {
+	result := &fulltextIndex{tokenizer: idx.tokenizer, postings: make(map[string]*postingList, len(idx.postings)), rows: idx.rows}
+	for token, list := range idx.postings {
+		// appending to the rows and positions reallocates them
+		n := len(list.rows)
+		result.postings[token] = &postingList{rows: list.rows[:n:n], positions: list.positions[:n:n]}
+	}
+	return result
+}
+
+// Returns the rows of the index matching the query in ascending order.
+func (idx *fulltextIndex) search(query matchQuery) []int {
+	result := make([]int, 0)
+	for _, terms := range idx.tokenizer.split(query) {
+		if len(terms) == 0 {
+			continue
+		}
+		rows := idx.phrase(terms[0])
+		for _, term := range terms[1:] {
+			if len(rows) == 0 {
+				break
+			}
+			rows = intersect(rows, idx.phrase(term))
+		}
+		result = union(result, rows)
+	}
+	return result
+}
+
+// Returns the rows containing the tokens one after another.
+func (idx *fulltextIndex) phrase(tokens []string) []int {
+	first := idx.postings[tokens[0]]
+	if first == nil {
+		return make([]int, 0)
+	}
+	result := make([]int, 0, len(first.rows))
+	for r, row := range first.rows {
+		for _, start := range first.positions[r] {
+			if idx.follows(tokens[1:], row, start+1) {
+				result = append(result, row)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Checks if the tokens are found in the row one after another starting at the position.
+func (idx *fulltextIndex) follows(tokens []string, row, pos int) bool {
+	for k, token := range tokens {
+		list := idx.postings[token]
+		if list == nil {
+			return false
+		}
+		r := sort.SearchInts(list.rows, row)
+		if r == len(list.rows) || list.rows[r] != row || !containsSorted(list.positions[r], pos+k) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if the tokens of the text match the query.
+func (t Tokenizer) matches(query matchQuery, text string) bool {
+	positions := make(map[string][]int)
+	for pos, token := range t.tokens(text) {
+		positions[token] = append(positions[token], pos)
+	}
+	for _, terms := range t.split(query) {
+		if len(terms) > 0 && allMatch(terms, func(tokens []string) bool { return containsPhrase(positions, tokens) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the tokens follow each other in the text with the positions of its tokens.
+func containsPhrase(positions map[string][]int, tokens []string) bool {
+	for _, start := range positions[tokens[0]] {
+		found := true
+		for k, token := range tokens[1:] {
+			if !containsSorted(positions[token], start+k+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the tokens of the terms of the query. Terms without tokens are left out, alternatives
+// without any terms match no rows.
+func (t Tokenizer) split(query matchQuery) [][][]string {
+	result := make([][][]string, len(query))
+	for i, terms := range query {
+		for _, term := range terms {
+			if tokens := t.tokens(term); len(tokens) > 0 {
+				result[i] = append(result[i], tokens)
+			}
+		}
+	}
+	return result
+}
+
+// Returns the tokens of the text.
+func (t Tokenizer) tokens(text string) []string {
+	var tokens []string
+	switch t.Split {
+	case WHITESPACE:
+		tokens = strings.Fields(text)
+	case WORDS:
+		tokens = strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) })
+	default:
+		error_("Unknown token split '%s'.", t.Split)
+	}
+	for i := range tokens {
+		if t.Lowercase {
+			tokens[i] = strings.ToLower(tokens[i])
+		}
+		if t.Stemming {
+			tokens[i] = germanStem(tokens[i])
+		}
+	}
+	return tokens
+}
+
+// Returns the stem of a German word following the CISTEM stemmer. The stem is lower case and
+// without umlauts, so the stems of all forms of a word are equal, e.g., "Häuser" and "Haus".
+func germanStem(word string) string {
+	word = strings.ToLower(word)
+	word = strings.NewReplacer("ä", "a", "ö", "o", "ü", "u", "ß", "ss").Replace(word)
+	// letter groups and doubled letters are replaced by single runes, so the suffixes are not cut inside them
+	word = strings.NewReplacer("sch", "$", "ie", "&", "ei", "%").Replace(word)
+	runes := []rune(word)
+	for i := 1; i < len(runes); i++ {
+		if runes[i] == runes[i-1] {
+			runes[i] = '*'
+		}
+	}
+	for len(runes) > 3 {
+		n := len(runes)
+		if suffix := string(runes[n-2:]); n > 5 && (suffix == "em" || suffix == "er" || suffix == "nd") {
+			runes = runes[:n-2]
+		} else if last := runes[n-1]; last == 't' || last == 'e' || last == 's' || last == 'n' {
+			runes = runes[:n-1]
+		} else {
+			break
+		}
+	}
+	for i := 1; i < len(runes); i++ {
+		if runes[i] == '*' {
+			runes[i] = runes[i-1]
+		}
+	}
+	return strings.NewReplacer("$", "sch", "&", "ie", "%", "ei").Replace(string(runes))
+}
+
+// Parses the query into its alternatives of terms. Exits if a phrase is not closed.
+func parseMatchQuery(query string) matchQuery {
+	result := matchQuery{nil}
+	for rest := strings.TrimSpace(query); rest != ""; rest = strings.TrimSpace(rest) {
+		var term string
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end == -1 {
+				error_("The phrase of the query '%s' is not closed.", query)
+			}
+			term, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexFunc(rest, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+			if end == -1 {
+				end = len(rest)
+			}
+			term, rest = rest[:end], rest[end:]
+			switch term {
+			case "OR":
+				result = append(result, nil)
+				continue
+			case "AND":
+				continue
+			}
+		}
+		result[len(result)-1] = append(result[len(result)-1], term)
+	}
+	return result
+}
+
+// Checks if the sorted array contains the value.
+func containsSorted(array []int, value int) bool {
+	i := sort.SearchInts(array, value)
+	return i < len(array) && array[i] == value
+}
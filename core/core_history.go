@@ -0,0 +1,242 @@
+package core
+
+/*
+	The history of the relations of a store for time travel queries. Every change of the rows of
+	a relation of the store and every commit of a transaction is a commit with its own number
+	and time, after which the relation is recorded as a version. A version is a snapshot of the
+	relation: later changes replace the columns, deleted rows and delta of the relation and leave
+	the snapshot unchanged, so versions cost no copies of the data. A compaction builds new
+	columns as well, the versions keep the deleted rows they see.
+
+	Versions are kept until their successor is older than the retention of the store, and at
+	most the number of versions set by SetMaxVersions per relation, so many small changes within
+	the retention do not keep the data replaced by every one of them. The current version of a
+	relation is always kept. The history is kept in memory only, a store
+	opened from a directory starts with the opened relations as its first versions.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	The retention of the history of a store until SetRetention is called.
+*/
+const DefaultRetention = time.Hour
+
+/*
+	The number of versions kept per relation until SetMaxVersions is called.
+*/
+const DefaultMaxVersions = 100
+
+// The versions of the relations of a store.
+type history struct {
+	mu        sync.Mutex
+	retention time.Duration
+	// The number of versions kept per relation, including the current one.
+	maxVersions int
+	// The number of the last commit.
+	commit int64
+	// The versions of the relations by their names in the order of their commits.
+	versions map[string][]*relationVersion
+}
+
+// The relation as it was after a commit.
+type relationVersion struct {
+	commit int64
+	time   time.Time
+	rel    *Relation
+}
+
+/*
+	Returns the relation with the passed name as it was at the passed time. The relation is
+	read-only, it can be used by all operators and joins, but its rows can not be changed.
+	Exits if the relation has no version at the time within the retention of the store.
+*/
+func (cs *ColumnStore) GetRelationAsOf(relName string, asOf time.Time) Relationer {
+	return cs.storeHistory().find(relName, asOf.String(), func(v *relationVersion) bool {
+		return !v.time.After(asOf)
+	})
+}
+
+/*
+	Returns the relation with the passed name as it was after the commit with the passed number,
+	as listed by Snapshots. The relation is read-only like the relations of GetRelationAsOf.
+*/
+func (cs *ColumnStore) GetRelationAtCommit(relName string, commit int64) Relationer {
+	return cs.storeHistory().find(relName, fmt.Sprintf("commit %d", commit), func(v *relationVersion) bool {
+		return v.commit <= commit
+	})
+}
+
+/*
+	Sets how long the versions of the relations are kept after they were replaced by a change.
+	A retention of 0 keeps the current versions only.
+*/
+func (cs *ColumnStore) SetRetention(retention time.Duration) {
+	if retention < 0 {
+		error_("The retention %s is negative.", retention)
+	}
+	h := cs.storeHistory()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.retention = retention
+	h.prune()
+}
+
+/*
+	Sets how many versions of every relation are kept at most, the oldest versions are removed
+	first. A limit of 1 keeps the current versions only.
+*/
+func (cs *ColumnStore) SetMaxVersions(versions int) {
+	if versions < 1 {
+		error_("At least the current version has to be kept, %d versions are too few.", versions)
+	}
+	h := cs.storeHistory()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxVersions = versions
+	h.prune()
+}
+
+/*
+	Returns the versions of the relations kept for time travel queries as a relation with one
+	row per version, ordered by their commits. Rows is the number of rows of the version.
+*/
+func (cs *ColumnStore) Snapshots() Relationer {
+	h := cs.storeHistory()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prune()
+	all := make([]*relationVersion, 0)
+	for _, versions := range h.versions {
+		all = append(all, versions...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].commit != all[j].commit {
+			return all[i].commit < all[j].commit
+		}
+		return all[i].rel.Name < all[j].rel.Name
+	})
+
+	sigs := []AttrInfo{
+		{Name: "Relation", Type: STRING},
+		{Name: "Commit", Type: INT},
+		{Name: "Time", Type: STRING},
+		{Name: "Rows", Type: INT},
+	}
+	result := &Relation{Name: "snapshots", Columns: make([]Column, len(sigs))}
+	for i, sig := range sigs {
+		result.Columns[i] = Column{Signature: sig, Data: newColumnData(sig.Type, len(all))}
+	}
+	for row, v := range all {
+		values := []interface{}{v.rel.Name, int(v.commit), v.time.Format("2006-01-02 15:04:05.000000"), v.rel.liveCount()}
+		for i, value := range values {
+			result.Columns[i].Data.Set(row, value)
+		}
+	}
+	return result
+}
+
+/*
+-------------------------------------------------
+History intern helper functions
+-------------------------------------------------
+*/
+
+// Returns the history of the store, which is created with the default retention when it is
+// used first.
+func (cs *ColumnStore) storeHistory() *history {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.historyLocked()
+}
+
+// Returns the history of the store like storeHistory, the caller holds cs.mu for writing.
+func (cs *ColumnStore) historyLocked() *history {
+	if cs.history == nil {
+		cs.history = &history{retention: DefaultRetention, maxVersions: DefaultMaxVersions, versions: make(map[string][]*relationVersion)}
+	}
+	return cs.history
+}
+
+// Records the relation of the store with its current rows, its later changes are recorded
+// as well.
+func (rel *Relation) track(h *history) {
+	rel.mu.Lock()
+	defer rel.mu.Unlock()
+	rel.history = h
+	h.record(rel)
+}
+
+// Records the relations as versions of one commit, the relations have to be locked. Relations
+// that are not part of a store have no history and are not recorded.
+func (h *history) record(rels ...*Relation) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.commit++
+	now := time.Now()
+	for _, rel := range rels {
+		version := &relationVersion{commit: h.commit, time: now, rel: rel.version()}
+		h.versions[rel.Name] = append(h.versions[rel.Name], version)
+	}
+	h.prune()
+}
+
+// Removes the versions whose successors are older than the retention and the oldest versions
+// beyond the limit of versions, the caller holds h.mu.
+func (h *history) prune() {
+	expired := time.Now().Add(-h.retention)
+	for name, versions := range h.versions {
+		kept := maximum(0, len(versions)-h.maxVersions)
+		for kept < len(versions)-1 && versions[kept+1].time.Before(expired) {
+			kept++
+		}
+		if kept > 0 {
+			// the versions are copied, so the removed ones can be freed
+			h.versions[name] = append([]*relationVersion{}, versions[kept:]...)
+		}
+	}
+}
+
+// Returns a copy of the last version of the relation accepted by the passed function, the
+// versions are searched from the newest on. Exits if no version is accepted.
+func (h *history) find(relName string, at string, accept func(*relationVersion) bool) *Relation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prune()
+	versions, ok := h.versions[relName]
+	if !ok {
+		error_("No relation with name '%s'", relName)
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if accept(versions[i]) {
+			// every caller gets its own copy for its indexes and collations
+			return versions[i].rel.version()
+		}
+	}
+	error_("No version of the relation '%s' at %s is kept.", relName, at)
+	return nil
+}
+
+// Returns a read-only copy of the relation sharing its columns, statistics, indexes, deleted
+// rows and delta like a snapshot. The relation has to be locked or must not be changed.
+func (rel *Relation) version() *Relation {
+	return &Relation{
+		Name: rel.Name, Columns: rel.Columns, stats: rel.stats, indexes: copyIndexes(rel.indexes),
+		deleted: rel.deleted, delta: rel.delta, lsn: rel.lsn, readOnly: true,
+	}
+}
+
+// Exits if the rows of the relation can not be changed.
+func (rel *Relation) checkWritable() {
+	if rel.readOnly {
+		error_("The relation '%s' is a version of the history and can not be changed.", rel.Name)
+	}
+}
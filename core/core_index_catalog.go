@@ -0,0 +1,341 @@
+package core
+
+/*
+	The indexes of a relation are catalog objects with a name, the indexed column and their kind.
+	Indexes created by MakeIndex get a name made of the column and the kind. The catalog keeps
+	the indexes up to date: rows inserted into the relation are added to its indexes when the
+	delta is merged into the main columns, collating a column rebuilds its indexes with the new sort
+	keys, and other changes of the data rebuild the indexes of the changed columns.
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The appended rows up to which indexes are maintained incrementally, more rows rebuild them.
+const indexRebuildRows = 1024
+
+// An index of the catalog of a relation.
+type indexInfo struct {
+	name   string
+	column string
+	kind   IndexKind
+	// The number of rows of the column covered by the index.
+	rows int
+	// The tokenizer of FULLTEXT indexes.
+	tokenizer Tokenizer
+}
+
+/*
+	Creates an index of the passed kind on the column and adds it to the catalog of the relation.
+	Exits if the name is already used or the column already has an index of this kind.
+*/
+func (rel *Relation) CreateIndex(name string, col AttrInfo, kind IndexKind) Relationer {
+	rel.lockForWrite()
+	defer rel.unlockAfterChange()
+	colIdx := findColumnIn(rel.Columns, col)
+	if colIdx == -1 {
+		error_("Unknown column name '%s'.", col.Name)
+	}
+	kind = indexKind([]IndexKind{kind})
+	if rel.findIndex(name) != nil {
+		error_("The relation '%s' already has an index with the name '%s'.", rel.Name, name)
+	}
+	if existing := rel.indexOf(col.Name, kind); existing != nil {
+		error_("The column '%s' already has the %s index '%s'.", col.Name, kind, existing.name)
+	}
+	rel.addIndex(name, colIdx, kind, DefaultTokenizer)
+	return rel
+}
+
+/*
+	Creates a FULLTEXT index on the STRING column that splits the values with the tokenizer and adds
+	it to the catalog of the relation. Exits if the name is already used or the column already has
+	a FULLTEXT index.
+*/
+func (rel *Relation) CreateFullTextIndex(name string, col AttrInfo, tokenizer Tokenizer) Relationer {
+	rel.lockForWrite()
+	defer rel.unlockAfterChange()
+	colIdx := findColumnIn(rel.Columns, col)
+	if colIdx == -1 {
+		error_("Unknown column name '%s'.", col.Name)
+	}
+	if rel.findIndex(name) != nil {
+		error_("The relation '%s' already has an index with the name '%s'.", rel.Name, name)
+	}
+	if existing := rel.indexOf(col.Name, FULLTEXT); existing != nil {
+		error_("The column '%s' already has the %s index '%s'.", col.Name, FULLTEXT, existing.name)
+	}
+	rel.addIndex(name, colIdx, FULLTEXT, tokenizer)
+	return rel
+}
+
+/*
+	Removes the index with the passed name from the relation. Exits if there is no such index.
+*/
+func (rel *Relation) DropIndex(name string) Relationer {
+	rel.lockForWrite()
+	defer rel.unlockAfterChange()
+	if rel.findIndex(name) == nil {
+		error_("The relation '%s' has no index with the name '%s'.", rel.Name, name)
+	}
+	rel.logChange(walRecord{Kind: walDropIndex, Index: name})
+	rel.dropIndex(name)
+	return rel
+}
+
+/*
+	Returns the indexes of the relation as a relation with one row per index. Keys is the
+	number of distinct values or tokens of the merged rows and Rows the number of covered rows,
+	including the rows of the delta, which are indexed when they are merged. NULL values are
+	not indexed.
+*/
+func (rel *Relation) Indexes() Relationer {
+	rel.mu.RLock()
+	defer rel.mu.RUnlock()
+
+	sigs := []AttrInfo{
+		{Name: "Name", Type: STRING},
+		{Name: "Column", Type: STRING},
+		{Name: "Kind", Type: STRING},
+		{Name: "Keys", Type: INT},
+		{Name: "Rows", Type: INT},
+	}
+	result := &Relation{Name: "indexes of " + rel.Name, Columns: make([]Column, len(sigs))}
+	for i, sig := range sigs {
+		result.Columns[i] = Column{Signature: sig, Data: newColumnData(sig.Type, len(rel.indexes))}
+	}
+	for row, info := range rel.indexes {
+		colIdx := findColumnIn(rel.Columns, AttrInfo{Name: info.column})
+		keys, rows := rel.Columns[colIdx].indexSize(info.kind)
+		if len(rel.delta) > 0 {
+			rows += rel.delta[colIdx].length() - rel.delta[colIdx].nullCount()
+		}
+		values := []interface{}{info.name, info.column, string(info.kind), keys, rows}
+		for i, value := range values {
+			result.Columns[i].Data.Set(row, value)
+		}
+	}
+	return result
+}
+
+func (p *Plan) CreateIndex(name string, col AttrInfo, kind IndexKind) Relationer {
+	p.modificationError("CreateIndex")
+	return nil
+}
+
+func (p *Plan) CreateFullTextIndex(name string, col AttrInfo, tokenizer Tokenizer) Relationer {
+	p.modificationError("CreateFullTextIndex")
+	return nil
+}
+
+func (p *Plan) DropIndex(name string) Relationer {
+	p.modificationError("DropIndex")
+	return nil
+}
+
+func (p *Plan) Indexes() Relationer {
+	return p.materialized().Indexes()
+}
+
+/*
+-------------------------------------------------
+Index catalog intern helper functions
+-------------------------------------------------
+*/
+
+// Builds the index of the passed kind on the column unless the catalog already has one, the
+// index is named after the column and the kind.
+func (rel *Relation) ensureIndex(colIdx int, kind IndexKind) {
+	col := rel.Columns[colIdx].Signature.Name
+	if rel.indexOf(col, kind) != nil {
+		return
+	}
+	name := fmt.Sprintf("%s_%s", col, strings.ToLower(string(kind)))
+	for i := 2; rel.findIndex(name) != nil; i++ {
+		name = fmt.Sprintf("%s_%s_%d", col, strings.ToLower(string(kind)), i)
+	}
+	rel.addIndex(name, colIdx, kind, DefaultTokenizer)
+}
+
+// Builds the index on the column and adds it to the catalog.
+func (rel *Relation) addIndex(name string, colIdx int, kind IndexKind, tokenizer Tokenizer) {
+	col := &rel.Columns[colIdx]
+	rel.logChange(walRecord{Kind: walCreateIndex, Index: name, Column: col.Signature.Name, IndexKind: kind, Tokenizer: tokenizer})
+	info := &indexInfo{name: name, column: col.Signature.Name, kind: kind, rows: col.length(), tokenizer: tokenizer}
+	col.clearIndex(kind)
+	col.buildIndex(info)
+	rel.indexes = append(rel.indexes, info)
+}
+
+// Removes the index with the passed name from the column and the catalog.
+func (rel *Relation) dropIndex(name string) {
+	for i, info := range rel.indexes {
+		if info.name == name {
+			rel.Columns[findColumnIn(rel.Columns, AttrInfo{Name: info.column})].clearIndex(info.kind)
+			rel.indexes = append(rel.indexes[:i:i], rel.indexes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Returns the index with the passed name or nil.
+func (rel *Relation) findIndex(name string) *indexInfo {
+	for _, info := range rel.indexes {
+		if info.name == name {
+			return info
+		}
+	}
+	return nil
+}
+
+// Returns the index of the passed kind on the column or nil.
+func (rel *Relation) indexOf(column string, kind IndexKind) *indexInfo {
+	for _, info := range rel.indexes {
+		if info.column == column && info.kind == kind {
+			return info
+		}
+	}
+	return nil
+}
+
+// Brings the indexes up to date with the rows of their columns. Columns with less rows than
+// their indexes or many new rows are indexed again. The relation has to be locked for writing
+// or not be shared yet.
+func (rel *Relation) updateIndexes() {
+	for _, info := range rel.indexes {
+		col := &rel.Columns[findColumnIn(rel.Columns, AttrInfo{Name: info.column})]
+		rows := col.length()
+		switch {
+		case rows == info.rows:
+			continue
+		case rows < info.rows || rows-info.rows > indexRebuildRows:
+			col.clearIndex(info.kind)
+			col.buildIndex(info)
+		default:
+			// snapshots of running queries still use the index
+			col.copyIndex(info.kind)
+			for i := info.rows; i < rows; i++ {
+				col.indexRow(info.kind, i)
+			}
+		}
+		info.rows = rows
+	}
+}
+
+// Rebuilds the indexes of the catalog on the column, e.g., after the data or the collation changed.
+func (rel *Relation) rebuildIndexes(colIdx int) {
+	col := &rel.Columns[colIdx]
+	for _, kind := range []IndexKind{HASH, ORDERED, BITMAP, FULLTEXT} {
+		col.clearIndex(kind)
+	}
+	for _, info := range rel.indexes {
+		if info.column == col.Signature.Name {
+			col.buildIndex(info)
+			info.rows = col.length()
+		}
+	}
+}
+
+// Removes the index of the passed kind from the column.
+func (col *Column) clearIndex(kind IndexKind) {
+	switch kind {
+	case HASH:
+		col.Index = nil
+	case ORDERED:
+		col.ordered = nil
+	case BITMAP:
+		col.bitmaps = nil
+	case FULLTEXT:
+		col.fulltext = nil
+	}
+}
+
+// Replaces the index of the passed kind by a copy that rows can be added to without changing the
+// index. Only the parts of the index changed by adding rows are copied.
+func (col *Column) copyIndex(kind IndexKind) {
+	switch kind {
+	case HASH:
+		index := make(map[interface{}][]int, len(col.Index))
+		for key, rows := range col.Index {
+			// appending to the rows reallocates them
+			index[key] = rows[:len(rows):len(rows)]
+		}
+		col.Index = index
+	case BITMAP:
+		col.bitmaps = col.bitmaps.copy()
+	case FULLTEXT:
+		col.fulltext = col.fulltext.copy()
+	}
+	// ORDERED indexes are copied on insert
+}
+
+// Builds the index of the catalog on all rows of the column. NULL values are not indexed.
+func (col *Column) buildIndex(info *indexInfo) {
+	switch info.kind {
+	case HASH:
+		col.CreateIndex()
+		for i := 0; i < col.length(); i++ {
+			col.indexRow(HASH, i)
+		}
+	case ORDERED:
+		col.createOrderedIndex()
+	case BITMAP:
+		col.createBitmapIndex()
+	case FULLTEXT:
+		col.createFullTextIndex(info.tokenizer)
+	}
+}
+
+// Adds the i-th row to the index of the passed kind. The rows have to be added in ascending order.
+func (col *Column) indexRow(kind IndexKind, i int) {
+	switch kind {
+	case HASH:
+		if !col.isNull(i) {
+			col.IndexInsert(col.valueAt(i), i)
+		}
+	case ORDERED:
+		if !col.isNull(i) {
+			col.ordered = col.ordered.insert(i, col.indexKey(col.valueAt(i)))
+		}
+	case BITMAP:
+		col.bitmaps.add(i, col)
+	case FULLTEXT:
+		col.fulltext.add(i, col)
+	}
+}
+
+// Returns the number of distinct keys and indexed rows of the index of the passed kind.
+func (col *Column) indexSize(kind IndexKind) (int, int) {
+	switch kind {
+	case HASH:
+		rows := 0
+		for _, positions := range col.Index {
+			rows += len(positions)
+		}
+		return len(col.Index), rows
+	case ORDERED:
+		return col.ordered.keyCount(), len(col.ordered.ordered())
+	case BITMAP:
+		rows := 0
+		for _, positions := range col.bitmaps.values {
+			rows += positions.cardinality()
+		}
+		return len(col.bitmaps.values), rows
+	case FULLTEXT:
+		return len(col.fulltext.postings), col.fulltext.rows
+	}
+	return 0, 0
+}
+
+// Returns the number of NULL values of the column.
+func (col *Column) nullCount() int {
+	count := 0
+	for i := 0; i < col.length(); i++ {
+		if col.isNull(i) {
+			count++
+		}
+	}
+	return count
+}
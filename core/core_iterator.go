@@ -0,0 +1,786 @@
+package core
+
+/*
+	The pull based execution of query plans. Every operator is an Iterator producing batches of
+	at most batchSize rows (joins may produce larger batches). The columns of a batch are views
+	on the data of the relations, values are only copied when a sink materializes the result.
+*/
+
+import (
+	"runtime"
+	"sync"
+)
+
+/*
+	A Batch contains a chunk of rows for all columns produced by an operator.
+*/
+type Batch struct {
+	Columns []Column
+}
+
+/*
+	The Iterator interface is implemented by all operators of a query plan. Next returns nil
+	when there are no more rows.
+*/
+type Iterator interface {
+	Open()
+	Next() *Batch
+	Close()
+	// Returns the signatures of the columns of the produced batches.
+	Schema() []AttrInfo
+}
+
+/*
+	Returns the number of rows of the batch.
+*/
+func (b *Batch) RowCount() int {
+	if len(b.Columns) == 0 {
+		return 0
+	}
+	return b.Columns[0].length()
+}
+
+/*
+	Returns the value of the passed row and column or nil if the value is NULL.
+*/
+func (b *Batch) Value(col, row int) interface{} {
+	if b.Columns[col].isNull(row) {
+		return nil
+	}
+	return b.Columns[col].valueAt(row)
+}
+
+type relationIterator struct {
+	rel         *Relation
+	blockFilter Predicate // nil if no block is skipped
+	pos         int
+}
+
+type selectIterator struct {
+	child Iterator
+	pred  Predicate
+}
+
+type scanIterator struct {
+	child   Iterator
+	indices []int
+	schema  []AttrInfo
+}
+
+type projectIterator struct {
+	child Iterator
+	exprs []NamedExpr
+}
+
+type collateIterator struct {
+	child Iterator
+	col   AttrInfo
+	coll  Collation
+}
+
+type orderByIterator struct {
+	child      Iterator
+	col        AttrInfo
+	descending bool
+	sorted     *Relation
+	positions  []int
+	pos        int
+}
+
+type makeIndexIterator struct {
+	child Iterator
+	name  string
+	col   AttrInfo
+	kind  IndexKind
+	rel   *Relation // the materialized input with the index
+	scan  relationIterator
+}
+
+type indexScanIterator struct {
+	child Iterator
+	name  string
+	pred  Predicate
+	rel   *Relation
+	rows  []int
+	pos   int
+}
+
+type joinIterator struct {
+	node       *joinNode
+	probe      Iterator   // the input whose batches are joined one after another
+	buildInput Iterator   // the input the hash table or index is built on
+	schema     []AttrInfo // the signatures of the result
+	build      *Relation  // the materialized build side
+	buildAttr  AttrInfo
+	probeAttr  AttrInfo
+	probeComp  Comparison // the joined rows meet "probe value probeComp build value"
+	table      joinTable  // the hash table of hash joins
+	keys       ColumnData // the join keys of the build side
+	nulls      []bool     // the NULL marks of the build keys
+	matched    []bool     // build rows with a match, only for LEFT, SEMI and ANTI joins building on the first input
+	done       bool       // all probe batches are joined
+	pending    []*Batch   // produced batches not returned yet
+}
+
+func (it *relationIterator) Open() {
+	it.pos = 0
+}
+
+func (it *relationIterator) Next() *Batch {
+	if len(it.rel.Columns) == 0 {
+		return nil
+	}
+	main := it.rel.mainRows()
+	for {
+		// batches never cross the borders of the blocks and of the delta, which has no zones
+		for it.blockFilter != nil && it.pos < main && it.pos%zoneBlockSize == 0 &&
+			it.rel.excludes(it.pos/zoneBlockSize, it.blockFilter) {
+			it.pos = minimum(it.pos+zoneBlockSize, main)
+		}
+		if it.pos >= it.rel.length() {
+			return nil
+		}
+		end := minimum(it.pos+batchSize, it.rel.length())
+		if it.pos < main {
+			end = minimum(end, main)
+		}
+		if it.rel.deleted == nil && (it.pos == 0 && end == main || it.pos == main && end == it.rel.length()) {
+			// relations within one batch are passed on without a selection vector
+			cols := it.rel.Columns
+			if it.pos == main {
+				cols = it.rel.delta
+			}
+			it.pos = end
+			return &Batch{Columns: wholeColumns(cols)}
+		}
+		selection := make([]int, 0, end-it.pos)
+		for i := it.pos; i < end; i++ {
+			if it.rel.deleted == nil || !it.rel.deleted.contains(i) {
+				selection = append(selection, i)
+			}
+		}
+		it.pos = end
+		// batches of deleted rows only are left out
+		if len(selection) > 0 {
+			return &Batch{Columns: it.rel.gather(selection)}
+		}
+	}
+}
+
+func (it *relationIterator) Close() {}
+
+func (it *relationIterator) relation() *Relation {
+	return it.rel
+}
+
+func (it *relationIterator) Schema() []AttrInfo {
+	return signatures(it.rel.Columns)
+}
+
+func (it *selectIterator) Open() {
+	it.child.Open()
+}
+
+func (it *selectIterator) Next() *Batch {
+	for batch := it.child.Next(); batch != nil; batch = it.child.Next() {
+		selection := it.pred.filter(batch.Columns, allRows(batch.RowCount()))
+		if len(selection) > 0 {
+			return &Batch{Columns: selectColumns(batch.Columns, selection)}
+		}
+	}
+	return nil
+}
+
+func (it *selectIterator) Close() {
+	it.child.Close()
+}
+
+func (it *selectIterator) Schema() []AttrInfo {
+	return it.child.Schema()
+}
+
+func (it *scanIterator) Open() {
+	it.child.Open()
+}
+
+func (it *scanIterator) Next() *Batch {
+	batch := it.child.Next()
+	if batch == nil {
+		return nil
+	}
+	result := &Batch{Columns: make([]Column, len(it.indices))}
+	for i, idx := range it.indices {
+		result.Columns[i] = batch.Columns[idx]
+	}
+	return result
+}
+
+func (it *scanIterator) Close() {
+	it.child.Close()
+}
+
+func (it *scanIterator) Schema() []AttrInfo {
+	return it.schema
+}
+
+func (it *projectIterator) Open() {
+	it.child.Open()
+}
+
+func (it *projectIterator) Next() *Batch {
+	batch := it.child.Next()
+	if batch == nil {
+		return nil
+	}
+	result := &Batch{Columns: make([]Column, len(it.exprs))}
+	rows := allRows(batch.RowCount())
+	for i, named := range it.exprs {
+		result.Columns[i] = named.Expr.eval(batch.Columns, rows)
+		result.Columns[i].Signature.Name = named.Name
+	}
+	return result
+}
+
+func (it *projectIterator) Close() {
+	it.child.Close()
+}
+
+func (it *projectIterator) Schema() []AttrInfo {
+	schema := make([]AttrInfo, len(it.exprs))
+	cols := schemaColumns(it.child.Schema())
+	for i, named := range it.exprs {
+		if ref, ok := named.Expr.(*columnExpr); ok {
+			// referenced columns keep their collation
+			schema[i] = cols[columnIndex(cols, ref.col)].Signature
+		}
+		schema[i].Name = named.Name
+		schema[i].Type, _ = named.Expr.check(cols)
+	}
+	return schema
+}
+
+func (it *collateIterator) Open() {
+	it.child.Open()
+}
+
+func (it *collateIterator) Next() *Batch {
+	batch := it.child.Next()
+	if batch == nil {
+		return nil
+	}
+	result := &Batch{Columns: append([]Column{}, batch.Columns...)}
+	idx := columnIndex(result.Columns, it.col)
+	result.Columns[idx].Signature.Collation = it.coll
+	result.Columns[idx].Index = nil
+	return result
+}
+
+func (it *collateIterator) Close() {
+	it.child.Close()
+}
+
+func (it *collateIterator) Schema() []AttrInfo {
+	schema := append([]AttrInfo{}, it.child.Schema()...)
+	for i := range schema {
+		if schema[i].Name == it.col.Name {
+			schema[i].Collation = it.coll
+		}
+	}
+	return schema
+}
+
+func (it *orderByIterator) Open() {
+	it.pos = 0
+	if source, ok := it.child.(relationSource); ok {
+		it.sorted = source.relation()
+		sortCol := it.sorted.Columns[columnIndex(it.sorted.Columns, it.col)]
+		// columns without NULL values are returned in the order of their ordered index, which
+		// does not contain the rows of the delta
+		if !it.descending && sortCol.ordered != nil && sortCol.nulls == nil && len(it.sorted.delta) == 0 {
+			it.positions = it.sorted.withoutDeleted(sortCol.ordered.ordered())
+			return
+		}
+		it.sorted = it.sorted.live()
+	} else {
+		// sorting has to see all rows before returning the first one
+		it.sorted = materialize("order by", it.child)
+	}
+	sortCol := it.sorted.Columns[columnIndex(it.sorted.Columns, it.col)]
+	it.positions = allRows(sortCol.length())
+	sortCol.Data.keys(sortCol.Signature.Collation).sortRows(it.positions, sortCol.rows, it.descending)
+}
+
+func (it *orderByIterator) Next() *Batch {
+	if it.pos >= len(it.positions) {
+		return nil
+	}
+	end := minimum(it.pos+batchSize, len(it.positions))
+	batch := &Batch{Columns: selectColumns(it.sorted.Columns, it.positions[it.pos:end])}
+	it.pos = end
+	return batch
+}
+
+func (it *orderByIterator) Close() {
+	it.sorted = nil
+	it.positions = nil
+}
+
+func (it *orderByIterator) Schema() []AttrInfo {
+	return it.child.Schema()
+}
+
+func (it *makeIndexIterator) Open() {
+	it.scan = relationIterator{rel: it.relation()}
+}
+
+func (it *makeIndexIterator) Next() *Batch {
+	return it.scan.Next()
+}
+
+func (it *makeIndexIterator) Close() {
+	it.rel, it.scan.rel = nil, nil
+}
+
+func (it *makeIndexIterator) Schema() []AttrInfo {
+	return it.child.Schema()
+}
+
+// Materializes the input and builds the index on it once.
+func (it *makeIndexIterator) relation() *Relation {
+	if it.rel == nil {
+		it.rel = indexedInput(materializeInput(it.name, it.child), it.col, it.kind)
+	}
+	return it.rel
+}
+
+func (it *indexScanIterator) Open() {
+	it.rel = materializeInput(it.name, it.child)
+	it.pos = 0
+	// ordered indexes return the rows in the order of their values, bitmaps in the order of the rows
+	// the indexes still contain the deleted rows
+	if columnIndexed(it.rel.Columns, it.pred) {
+		idx := columnIndex(it.rel.Columns, it.pred.attrs()[0])
+		it.rows = it.rel.withoutDeleted(it.rel.Columns[idx].indexScan(it.pred))
+		it.addDelta(idx)
+		return
+	}
+	if rows, ok := bitmapOf(it.rel.Columns, it.pred); ok {
+		if it.rel.deleted != nil {
+			rows = rows.andNot(it.rel.deleted)
+		}
+		it.rows = rows.rows()
+		it.addDelta(-1)
+		return
+	}
+	// predicates without a suitable index are evaluated on all rows like Select
+	it.rows = it.rel.filter(it.pred)
+}
+
+// Adds the rows of the delta meeting the predicate to the rows found by the indexes, which do not
+// contain the delta. If the index of the column with the passed position returned the rows in the
+// order of their values, the rows of the delta are sorted into them.
+func (it *indexScanIterator) addDelta(sortCol int) {
+	rows := it.rel.filterDelta(it.pred)
+	if len(rows) == 0 {
+		return
+	}
+	it.rows = append(it.rows, rows...)
+	if sortCol == -1 {
+		return
+	}
+	it.rel = &Relation{Name: it.rel.Name, Columns: it.rel.gather(it.rows)}
+	col := it.rel.Columns[sortCol]
+	it.rows = allRows(len(it.rows))
+	col.Data.keys(col.Signature.Collation).sortRows(it.rows, col.rows, false)
+}
+
+func (it *indexScanIterator) Next() *Batch {
+	if it.pos >= len(it.rows) {
+		return nil
+	}
+	end := minimum(it.pos+batchSize, len(it.rows))
+	batch := &Batch{Columns: it.rel.gather(it.rows[it.pos:end])}
+	it.pos = end
+	return batch
+}
+
+func (it *indexScanIterator) Close() {
+	it.rel, it.rows = nil, nil
+}
+
+func (it *indexScanIterator) Schema() []AttrInfo {
+	return it.child.Schema()
+}
+
+func (it *joinIterator) Open() {
+	n := it.node
+	it.pending, it.done, it.matched = nil, false, nil
+
+	buildName := n.second.name()
+	it.buildAttr, it.probeAttr, it.probeComp = n.sattr, n.fattr, flip(n.comp)
+	if n.buildFirst {
+		buildName = n.first.name()
+		it.buildAttr, it.probeAttr, it.probeComp = n.fattr, n.sattr, n.comp
+	}
+
+	// the build side is indexed without its deleted rows
+	it.build = materializeInput(buildName, it.buildInput).live()
+	col := it.build.Columns[columnIndex(it.build.Columns, it.buildAttr)]
+	switch n.algorithm {
+	case hashJoinAlgorithm, parallelHashJoinAlgorithm:
+		it.table = joinKeys(col, n.coll).hashTable(nullMarks(col))
+	case nestedLoopJoinAlgorithm:
+		it.keys, it.nulls = joinKeys(col, n.coll), nullMarks(col)
+	case indexNestedLoopJoinAlgorithm:
+		// the index is kept for later joins, ranges need an ordered one
+		if it.probeComp == EQ {
+			it.build = indexedInput(it.build, it.buildAttr, HASH)
+		} else if !it.build.Columns[columnIndex(it.build.Columns, it.buildAttr)].hasIndexFor(flip(it.probeComp)) {
+			it.build = indexedInput(it.build, it.buildAttr, ORDERED)
+		}
+	}
+	if n.buildFirst && n.kind != INNER {
+		it.matched = make([]bool, col.length())
+	}
+	it.probe.Open()
+}
+
+func (it *joinIterator) Next() *Batch {
+	for len(it.pending) == 0 {
+		if !it.produce() {
+			return nil
+		}
+	}
+	batch := it.pending[0]
+	it.pending = it.pending[1:]
+	return batch
+}
+
+// Joins the next batches of the probe side. Returns false if there are no more rows.
+func (it *joinIterator) produce() bool {
+	if it.done {
+		return false
+	}
+	workers := 1
+	if it.node.algorithm == parallelHashJoinAlgorithm {
+		workers = runtime.NumCPU()
+	}
+	// pull a batch for every worker and join them at the same time
+	batches := make([]*Batch, 0, workers)
+	for len(batches) < workers {
+		batch := it.probe.Next()
+		if batch == nil {
+			break
+		}
+		batches = append(batches, batch)
+	}
+	if len(batches) == 0 {
+		it.done = true
+		if it.matched != nil {
+			it.emitBuildRows()
+		}
+		return len(it.pending) > 0
+	}
+
+	if len(batches) == 1 {
+		// a single batch is joined without starting a goroutine
+		it.emit(batches[0].Columns, it.join(batches[0]))
+		return true
+	}
+	results := make([]*joinResult, len(batches))
+	wg := new(sync.WaitGroup)
+	for b, batch := range batches {
+		wg.Add(1)
+		go func(b int, batch *Batch) {
+			defer wg.Done()
+			results[b] = it.join(batch)
+		}(b, batch)
+	}
+	wg.Wait()
+	for b, batch := range batches {
+		it.emit(batch.Columns, results[b])
+	}
+	return true
+}
+
+// Returns the row pairs of the probe batch and the build side meeting the join condition.
+func (it *joinIterator) join(batch *Batch) *joinResult {
+	n := it.node
+	col := batch.Columns[columnIndex(batch.Columns, it.probeAttr)]
+	result := newJoinResult()
+	switch n.algorithm {
+	case hashJoinAlgorithm, parallelHashJoinAlgorithm:
+		it.table.probe(it.probeComp, joinKeys(col, n.coll), nullMarks(col), result)
+	case nestedLoopJoinAlgorithm:
+		// the kernel joins the rows where "build value comp probe value" is true
+		joinKeys(col, n.coll).nestedLoopJoin(flip(it.probeComp), it.keys, nullMarks(col), it.nulls, result)
+	case indexNestedLoopJoinAlgorithm:
+		buildCol := it.build.Columns[columnIndex(it.build.Columns, it.buildAttr)]
+		// the index returns the build rows where "build value flip(probeComp) probe value" is true
+		joinKeys(col, BINARY).indexNestedLoopJoin(flip(it.probeComp), nullMarks(col), buildCol, result)
+	}
+	return result
+}
+
+// Adds the batches with the joined rows of a probe batch to the pending batches.
+func (it *joinIterator) emit(probe []Column, result *joinResult) {
+	n := it.node
+	if it.matched != nil {
+		// the rows of the first input are added when the probe side is exhausted
+		for _, j := range result.buildRows {
+			it.matched[j] = true
+		}
+	}
+
+	switch {
+	case n.kind == INNER || n.kind == LEFT:
+		if n.buildFirst {
+			it.addBatch(selectColumns(it.build.Columns, result.buildRows), selectColumns(probe, result.probeRows))
+		} else {
+			it.addBatch(selectColumns(probe, result.probeRows), selectColumns(it.build.Columns, result.buildRows))
+		}
+		if n.kind == LEFT && !n.buildFirst {
+			unmatched := difference(allRows(probe[0].length()), distinct(result.probeRows))
+			it.addBatch(selectColumns(probe, unmatched), nullColumns(it.build.Columns, len(unmatched)))
+		}
+	case !n.buildFirst:
+		// SEMI and ANTI joins only return the rows of the probe side
+		rows := distinct(result.probeRows)
+		if n.kind == ANTI {
+			rows = difference(allRows(probe[0].length()), rows)
+		}
+		it.addBatch(selectColumns(probe, rows))
+	}
+}
+
+// Adds the rows of the first input that are only known after all probe batches are joined.
+func (it *joinIterator) emitBuildRows() {
+	rows := make([]int, 0)
+	for j, matched := range it.matched {
+		if matched == (it.node.kind == SEMI) {
+			rows = append(rows, j)
+		}
+	}
+	if it.node.kind == LEFT {
+		it.addBatch(selectColumns(it.build.Columns, rows), nullColumns(schemaColumns(it.probe.Schema()), len(rows)))
+	} else {
+		it.addBatch(selectColumns(it.build.Columns, rows))
+	}
+}
+
+// Adds a batch with the columns of both inputs and the names of the result to the pending batches.
+func (it *joinIterator) addBatch(parts ...[]Column) {
+	cols := make([]Column, 0, len(it.schema))
+	for _, part := range parts {
+		cols = append(cols, part...)
+	}
+	if len(cols) == 0 || cols[0].length() == 0 {
+		return
+	}
+	for i := range cols {
+		cols[i].Signature.Name = it.schema[i].Name
+	}
+	it.pending = append(it.pending, &Batch{Columns: cols})
+}
+
+func (it *joinIterator) Close() {
+	it.probe.Close()
+	it.build, it.table, it.keys, it.nulls, it.matched, it.pending = nil, nil, nil, nil, nil, nil
+}
+
+func (it *joinIterator) Schema() []AttrInfo {
+	return it.schema
+}
+
+/*
+-------------------------------------------------
+Iterator intern helper functions
+-------------------------------------------------
+*/
+
+// Runs the iterator and collects all produced rows in a new relation with the passed name.
+func materialize(name string, it Iterator) *Relation {
+	it.Open()
+	defer it.Close()
+
+	batches := make([]*Batch, 0)
+	for batch := it.Next(); batch != nil; batch = it.Next() {
+		batches = append(batches, batch)
+	}
+
+	result := &Relation{Name: name, Columns: make([]Column, len(it.Schema()))}
+	// columns with the same selection vectors in every batch share the combined selection vector
+	combined := make([]combinedRows, 0)
+	for i, sig := range it.Schema() {
+		parts := make([]Column, len(batches))
+		for b, batch := range batches {
+			parts[b] = batch.Columns[i]
+		}
+		result.Columns[i] = concatColumns(sig, parts, &combined)
+	}
+	return result
+}
+
+// Returns the columns without their indexes, like the views of batches.
+func wholeColumns(cols []Column) []Column {
+	result := make([]Column, len(cols))
+	for i, col := range cols {
+		result[i] = Column{Signature: col.Signature, Data: col.Data, rows: col.rows, nulls: col.nulls}
+	}
+	return result
+}
+
+// The relationSource interface is implemented by iterators whose result is an existing relation.
+type relationSource interface {
+	relation() *Relation
+}
+
+// Runs the iterator and returns the result. Relations are returned without copying them.
+func materializeInput(name string, it Iterator) *Relation {
+	if source, ok := it.(relationSource); ok {
+		return source.relation()
+	}
+	return materialize(name, it)
+}
+
+// Returns the materialized input with an index of the kind on the column. An index of the
+// catalog of the input is used, otherwise the index is built for the query only: snapshots of
+// relations copy their columns for it and are not logged, so queries never change the catalog
+// of a relation. If the input has rows in its delta, which the indexes do not contain, a view
+// with all rows gets an index of its own.
+func indexedInput(rel *Relation, col AttrInfo, kind IndexKind) *Relation {
+	if len(rel.delta) > 0 {
+		rel = rel.live()
+	}
+	rel.MakeIndex(col, kind)
+	return rel
+}
+
+// Combines the rows of the passed columns into one column. Batches that are views on the same
+// data are combined into one view, other batches are copied into a new data array. The parts of
+// previously combined columns are used to share their combined selection vectors.
+func concatColumns(sig AttrInfo, parts []Column, combined *[]combinedRows) Column {
+	if len(parts) == 0 {
+		return Column{Signature: sig, Data: newColumnData(sig.Type, 0)}
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	if sharedData(parts) {
+		rows := sharedRows(parts, *combined)
+		if rows == nil {
+			total := 0
+			for _, part := range parts {
+				total += part.length()
+			}
+			rows = make([]int, 0, total)
+			for _, part := range parts {
+				if part.rows == nil {
+					rows = append(rows, allRows(part.length())...)
+				} else {
+					rows = append(rows, part.rows...)
+				}
+			}
+			*combined = append(*combined, combinedRows{parts: parts, rows: rows})
+		}
+		// the batches may change the signature, e.g., the collation
+		return Column{Signature: parts[0].Signature, Data: parts[0].Data, rows: rows, nulls: parts[0].nulls}
+	}
+
+	result := Column{Signature: parts[0].Signature, Data: newColumnData(sig.Type, 0)}
+	hasNulls := false
+	for _, part := range parts {
+		hasNulls = hasNulls || part.nulls != nil
+	}
+	for _, part := range parts {
+		dense := part.materialize()
+		if hasNulls {
+			nulls := dense.nulls
+			if nulls == nil {
+				nulls = make([]bool, dense.length())
+			}
+			result.nulls = append(result.nulls, nulls...)
+		}
+		result.Data = result.Data.appendAll(dense.Data)
+	}
+	return result
+}
+
+// The selection vector combined from the selection vectors of the batches of a column.
+type combinedRows struct {
+	parts []Column
+	rows  []int
+}
+
+// Returns the combined selection vector of a previously combined column whose batches have the
+// same selection vectors as the passed parts or nil if there is none.
+func sharedRows(parts []Column, combined []combinedRows) []int {
+	for _, entry := range combined {
+		same := true
+		for b, part := range parts {
+			other := entry.parts[b]
+			if len(part.rows) == 0 || len(other.rows) != len(part.rows) || &other.rows[0] != &part.rows[0] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return entry.rows
+		}
+	}
+	return nil
+}
+
+// Returns true if all columns are views on the same data and NULL marks.
+func sharedData(parts []Column) bool {
+	for _, part := range parts[1:] {
+		if part.Data != parts[0].Data || len(part.nulls) != len(parts[0].nulls) {
+			return false
+		}
+		if part.nulls != nil && &part.nulls[0] != &parts[0].nulls[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the sorted positions without duplicates.
+func distinct(positions []int) []int {
+	result := make([]int, 0, len(positions))
+	for i, pos := range positions {
+		if i == 0 || pos != positions[i-1] {
+			result = append(result, pos)
+		}
+	}
+	return result
+}
+
+// Creates columns with the signatures of the passed columns containing n NULL values.
+func nullColumns(cols []Column, n int) []Column {
+	result := make([]Column, len(cols))
+	for i, col := range cols {
+		result[i] = Column{Signature: col.Signature, Data: newColumnData(col.Signature.Type, n), nulls: make([]bool, n)}
+		for j := range result[i].nulls {
+			result[i].nulls[j] = true
+		}
+	}
+	return result
+}
+
+// Returns the signatures of the passed columns.
+func signatures(cols []Column) []AttrInfo {
+	schema := make([]AttrInfo, len(cols))
+	for i, col := range cols {
+		schema[i] = col.Signature
+	}
+	return schema
+}
+
+// Creates columns without data for the passed signatures, used to check expressions and predicates.
+func schemaColumns(schema []AttrInfo) []Column {
+	cols := make([]Column, len(schema))
+	for i, sig := range schema {
+		cols[i].Signature = sig
+	}
+	return cols
+}
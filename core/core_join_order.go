@@ -0,0 +1,281 @@
+package core
+
+/*
+	Multi-way joins. A multiJoinNode records a set of relations and the join predicates between
+	them without fixing an order. After the predicates of the query are pushed into the inputs,
+	the optimizer replaces it by a tree of binary joins: dynamic programming over all subsets of
+	the inputs finds the tree with the lowest estimated cost for up to dpJoinLimit inputs, a
+	greedy heuristic joins the pair with the smallest estimated result first for more inputs.
+*/
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// The maximal number of inputs ordered by dynamic programming.
+const dpJoinLimit = 10
+
+type multiJoinNode struct {
+	names  []string   // the names of the inputs used to qualify their columns
+	inputs []planNode // the inputs with qualified column names
+	preds  []multiJoinPredicate
+}
+
+// A join predicate between the inputs with the positions left and right.
+type multiJoinPredicate struct {
+	left  int
+	lattr AttrInfo
+	comp  Comparison
+	right int
+	rattr AttrInfo
+}
+
+// A join tree of a set of inputs and its estimated cost.
+type joinTree struct {
+	inputs uint // bit set of the joined inputs
+	node   planNode
+	cost   float64
+}
+
+// Creates the node joining the relations, their columns are named "<relation name>.<column name>".
+func newMultiJoinNode(relations map[string]Relationer, preds []JoinPredicate) *multiJoinNode {
+	if len(relations) < 2 {
+		error_("A multi-way join needs at least two relations.")
+	}
+	n := &multiJoinNode{}
+	for name := range relations {
+		n.names = append(n.names, name)
+	}
+	sort.Strings(n.names)
+
+	positions := make(map[string]int)
+	for i, name := range n.names {
+		positions[name] = i
+		exprs := make([]NamedExpr, 0)
+		for _, sig := range relations[name].schema() {
+			exprs = append(exprs, NamedExpr{Name: name + "." + sig.Name, Expr: Col(sig.Name)})
+		}
+		n.inputs = append(n.inputs, &projectNode{child: planOf(relations[name]), exprs: exprs})
+	}
+
+	for _, pred := range preds {
+		left, lok := positions[pred.LeftRelation]
+		right, rok := positions[pred.RightRelation]
+		if !lok || !rok {
+			error_("Unknown relation in the join predicate on '%s' and '%s'.", pred.LeftRelation, pred.RightRelation)
+		}
+		lattr := qualifiedAttr(n.inputs[left], pred.LeftRelation, pred.Left)
+		rattr := qualifiedAttr(n.inputs[right], pred.RightRelation, pred.Right)
+		if lattr.Type != rattr.Type {
+			error_("Not matching types for the join predicate on '%s' and '%s'.", lattr.Name, rattr.Name)
+		}
+		commonCollation(lattr, rattr) // exits for conflicting collations
+		n.preds = append(n.preds, multiJoinPredicate{left: left, lattr: lattr, comp: pred.Comp, right: right, rattr: rattr})
+	}
+	return n
+}
+
+func (n *multiJoinNode) name() string {
+	return "MultiJoin"
+}
+
+func (n *multiJoinNode) schema() []AttrInfo {
+	schema := make([]AttrInfo, 0)
+	for _, input := range n.inputs {
+		schema = append(schema, input.schema()...)
+	}
+	return schema
+}
+
+func (n *multiJoinNode) iterator() Iterator {
+	return n.order().iterator()
+}
+
+// Replaces all multi-way joins of the plan by trees of binary joins.
+func orderJoins(node planNode) planNode {
+	node = withChildren(node, orderJoins)
+	if multi, ok := node.(*multiJoinNode); ok {
+		return multi.order()
+	}
+	return node
+}
+
+// Returns the join tree with the lowest estimated cost. The columns are returned in the order of
+// the inputs, independent of the order of the joins.
+func (n *multiJoinNode) order() planNode {
+	var best *joinTree
+	if len(n.inputs) <= dpJoinLimit {
+		best = n.dynamicProgramming()
+	} else {
+		best = n.greedy()
+	}
+	if best == nil {
+		error_("The relations of the multi-way join are not connected by join predicates.")
+	}
+	return &scanNode{child: best.node, cols: n.schema()}
+}
+
+// Finds the cheapest tree for every connected subset of the inputs, starting with the single inputs.
+func (n *multiJoinNode) dynamicProgramming() *joinTree {
+	full := uint(1)<<len(n.inputs) - 1
+	best := make(map[uint]*joinTree)
+	for i := range n.inputs {
+		best[1<<i] = n.leaf(i)
+	}
+
+	// every subset is larger than its proper subsets, so they are processed first
+	for set := uint(1); set <= full; set++ {
+		if bits.OnesCount(set) < 2 {
+			continue
+		}
+		lowest := set & -set
+		// the first part contains the lowest input, so every split is only looked at once
+		for part := (set - 1) & set; part > 0; part = (part - 1) & set {
+			if part&lowest == 0 {
+				continue
+			}
+			left, right := best[part], best[set&^part]
+			if left == nil || right == nil {
+				continue
+			}
+			if tree := n.join(left, right); tree != nil && (best[set] == nil || tree.cost < best[set].cost) {
+				best[set] = tree
+			}
+		}
+	}
+	return best[full]
+}
+
+// Joins the pair of trees with the smallest estimated result until one tree is left.
+func (n *multiJoinNode) greedy() *joinTree {
+	trees := make([]*joinTree, len(n.inputs))
+	for i := range n.inputs {
+		trees[i] = n.leaf(i)
+	}
+
+	for len(trees) > 1 {
+		var best *joinTree
+		bestRows := math.Inf(1)
+		bestI, bestJ := -1, -1
+		for i := range trees {
+			for j := i + 1; j < len(trees); j++ {
+				tree := n.join(trees[i], trees[j])
+				if tree == nil {
+					continue
+				}
+				if rows := estimateRows(tree.node); best == nil || rows < bestRows || (rows == bestRows && tree.cost < best.cost) {
+					best, bestRows, bestI, bestJ = tree, rows, i, j
+				}
+			}
+		}
+		if best == nil {
+			return nil
+		}
+		trees[bestI] = best
+		trees = append(trees[:bestJ], trees[bestJ+1:]...)
+	}
+	return trees[0]
+}
+
+// Returns the tree of a single input. Predicates between columns of the same input filter it.
+func (n *multiJoinNode) leaf(i int) *joinTree {
+	filters := make([]Predicate, 0)
+	for _, pred := range n.preds {
+		if pred.left == i && pred.right == i {
+			filters = append(filters, CompareColumns(pred.lattr, pred.comp, pred.rattr))
+		}
+	}
+	return &joinTree{inputs: 1 << i, node: selectOn(n.inputs[i], filters)}
+}
+
+// Joins two trees with the predicates connecting them. One predicate is the join condition, the
+// others filter the joined rows. Returns nil if no predicate connects the trees.
+func (n *multiJoinNode) join(first, second *joinTree) *joinTree {
+	connecting := make([]multiJoinPredicate, 0)
+	cond := -1
+	for _, pred := range n.preds {
+		if !pred.connects(first.inputs, second.inputs) {
+			continue
+		}
+		// equality predicates allow hash joins
+		if cond == -1 || (connecting[cond].comp != EQ && pred.comp == EQ) {
+			cond = len(connecting)
+		}
+		connecting = append(connecting, pred)
+	}
+	if cond == -1 {
+		return nil
+	}
+
+	// the join keeps the rows where "second comp first" is true
+	var join *joinNode
+	pred := connecting[cond]
+	if first.inputs&(1<<pred.left) != 0 {
+		join = newJoinNode("MultiJoin", first.node, pred.lattr, second.node, pred.rattr)
+		join.comp = flip(pred.comp)
+	} else {
+		join = newJoinNode("MultiJoin", first.node, pred.rattr, second.node, pred.lattr)
+		join.comp = pred.comp
+	}
+	filters := make([]Predicate, 0)
+	for i, other := range connecting {
+		if i != cond {
+			filters = append(filters, CompareColumns(other.lattr, other.comp, other.rattr))
+		}
+	}
+
+	_, _, cost := cheapestJoin(join)
+	node := selectOn(join, filters)
+	// the size of the intermediate result is part of the cost, smaller results are cheaper to join later
+	return &joinTree{
+		inputs: first.inputs | second.inputs,
+		node:   node,
+		cost:   first.cost + second.cost + cost + estimateRows(node),
+	}
+}
+
+// Returns the position of the input containing all passed columns or -1.
+func (n *multiJoinNode) inputOf(attrs []AttrInfo) int {
+	for i, input := range n.inputs {
+		if len(restrictAttrs(attrs, input.schema())) == len(attrs) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Converts a comparison of the columns of two inputs into a join predicate.
+func (n *multiJoinNode) joinPredicate(pred Predicate) (multiJoinPredicate, bool) {
+	compare, ok := pred.(*columnComparePredicate)
+	if !ok {
+		return multiJoinPredicate{}, false
+	}
+	left, right := n.inputOf([]AttrInfo{compare.left}), n.inputOf([]AttrInfo{compare.right})
+	if left == -1 || right == -1 {
+		return multiJoinPredicate{}, false
+	}
+	lattr := n.inputs[left].schema()[findAttr(n.inputs[left].schema(), compare.left)]
+	rattr := n.inputs[right].schema()[findAttr(n.inputs[right].schema(), compare.right)]
+	if lattr.Type != rattr.Type {
+		return multiJoinPredicate{}, false
+	}
+	return multiJoinPredicate{left: left, lattr: lattr, comp: compare.comp, right: right, rattr: rattr}, true
+}
+
+// Checks if the predicate compares a column of the first set of inputs with a column of the second set.
+func (p multiJoinPredicate) connects(first, second uint) bool {
+	left, right := uint(1)<<p.left, uint(1)<<p.right
+	return (first&left != 0 && second&right != 0) || (first&right != 0 && second&left != 0)
+}
+
+// Returns the signature of the column of the relation inside the input with qualified names.
+func qualifiedAttr(input planNode, relation string, attr AttrInfo) AttrInfo {
+	schema := input.schema()
+	idx := findAttr(schema, AttrInfo{Name: relation + "." + attr.Name})
+	if idx == -1 {
+		error_("Unknown column name '%s' of relation '%s'.", attr.Name, relation)
+	}
+	return schema[idx]
+}
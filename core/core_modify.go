@@ -0,0 +1,346 @@
+package core
+
+/*
+	Changes of the rows of relations. Inserted rows are appended to the delta of the relation,
+	which is merged into the columns with their indexes and zone maps in the background. Deleted rows stay in the data and are only marked in
+	the delete bitmap of the relation, all operators skip them. Updated rows are deleted and
+	appended with their new values. Once a quarter of the rows is deleted, the relation is
+	compacted: the deleted rows are removed from the data and the indexes, zone maps and
+	statistics are built again. Relations seen by running transactions are compacted once the
+	transactions ended, as the deleted rows are older versions of their rows.
+*/
+
+import "fmt"
+
+// The fraction of deleted rows at which a relation is compacted.
+const compactionRatio = 0.25
+
+/*
+	Appends the rows to the relation. The values of a row are in the order of the columns and
+	have to be of their types, nil values are NULL.
+*/
+func (rel *Relation) Insert(rows [][]interface{}) Relationer {
+	rel.mu.Lock()
+	defer rel.unlockAfterChange()
+	rel.checkWritable()
+	cols := make([]Column, len(rel.Columns))
+	for i, col := range rel.Columns {
+		cols[i] = Column{Signature: col.Signature, Data: newColumnData(col.Signature.Type, len(rows))}
+	}
+	for r, row := range rows {
+		if len(row) != len(cols) {
+			error_("The row %v has %d values, the relation '%s' has %d columns.", row, len(row), rel.Name, len(cols))
+		}
+		for i, value := range row {
+			if value == nil {
+				cols[i].setNull(r, len(rows))
+				continue
+			}
+			checkValue(cols[i].Signature, value)
+			cols[i].Data.Set(r, value)
+		}
+	}
+	if len(rows) > 0 {
+		rel.logChange(walRecord{Kind: walInsert, Columns: storeColumns(cols)})
+	}
+	rel.appendDelta(cols)
+	if len(rows) > 0 {
+		rel.history.record(rel)
+	}
+	rel.scheduleMerge()
+	return rel
+}
+
+/*
+	Appends the rows of the batch to the relation. The columns of the batch are matched with
+	the columns of the relation by their names and have to be of their types.
+*/
+func (rel *Relation) InsertColumns(batch *Batch) Relationer {
+	rel.mu.Lock()
+	defer rel.unlockAfterChange()
+	rel.checkWritable()
+	if len(batch.Columns) != len(rel.Columns) {
+		error_("The batch has %d columns, the relation '%s' has %d columns.", len(batch.Columns), rel.Name, len(rel.Columns))
+	}
+	cols := make([]Column, len(rel.Columns))
+	for i, col := range rel.Columns {
+		idx := findColumnIn(batch.Columns, col.Signature)
+		if idx == -1 {
+			error_("The batch has no column '%s'.", col.Signature.Name)
+		}
+		if type_ := batch.Columns[idx].Signature.Type; type_ != col.Signature.Type {
+			error_("The column '%s' of the batch is of type %s instead of %s.", col.Signature.Name, type_, col.Signature.Type)
+		}
+		if batch.Columns[idx].length() != batch.Columns[0].length() {
+			error_("The columns of the batch have different numbers of rows.")
+		}
+		cols[i] = batch.Columns[idx]
+	}
+	if len(cols) > 0 && cols[0].length() > 0 {
+		rel.logChange(walRecord{Kind: walInsert, Columns: storeColumns(cols)})
+		rel.appendDelta(cols)
+		rel.history.record(rel)
+	}
+	rel.scheduleMerge()
+	return rel
+}
+
+/*
+	Sets the columns of the rows meeting the predicate to the values of the expressions. The
+	expressions are evaluated on the values before the update and have to be of the types of
+	the columns. The updated rows are moved to the end of the relation.
+*/
+func (rel *Relation) Update(pred Predicate, assignments []NamedExpr) Relationer {
+	rel.mu.Lock()
+	defer rel.unlockAfterChange()
+	rel.checkWritable()
+	checkAttrs(signatures(rel.Columns), pred.attrs())
+	targets := make([]int, len(assignments))
+	for i, assignment := range assignments {
+		targets[i] = findColumnIn(rel.Columns, AttrInfo{Name: assignment.Name})
+		if targets[i] == -1 {
+			error_("Invalid update: unknown column '%s'.", assignment.Name)
+		}
+		if assignment.Expr == nil {
+			error_("Invalid update: missing expression for column '%s'.", assignment.Name)
+		}
+		type_, err := assignment.Expr.check(rel.Columns)
+		if err != nil {
+			error_("Invalid update: column '%s': %s", assignment.Name, err)
+		}
+		if expected := rel.Columns[targets[i]].Signature.Type; type_ != expected {
+			error_("Invalid update: column '%s' expected %s but got %s", assignment.Name, expected, type_)
+		}
+	}
+
+	rows := rel.filter(pred)
+	if len(rows) == 0 {
+		return rel
+	}
+	old := rel.gather(rows)
+	cols := append([]Column{}, old...)
+	for i, assignment := range assignments {
+		value := assignment.Expr.eval(old, allRows(len(rows)))
+		value.Signature = rel.Columns[targets[i]].Signature
+		cols[targets[i]] = value
+	}
+	compact := rel.compactionDue(len(rows), len(rows))
+	rel.logChange(walRecord{Kind: walUpdate, Rows: rows, Columns: storeColumns(cols), Compact: compact})
+	rel.replaceRows(rows, cols)
+	if compact {
+		rel.compact()
+	}
+	rel.history.record(rel)
+	rel.scheduleMerge()
+	return rel
+}
+
+/*
+	Removes the rows meeting the predicate from the relation.
+*/
+func (rel *Relation) Delete(pred Predicate) Relationer {
+	rel.mu.Lock()
+	defer rel.unlockAfterChange()
+	rel.checkWritable()
+	checkAttrs(signatures(rel.Columns), pred.attrs())
+	rows := rel.filter(pred)
+	if len(rows) == 0 {
+		return rel
+	}
+	compact := rel.compactionDue(len(rows), 0)
+	rel.logChange(walRecord{Kind: walDelete, Rows: rows, Compact: compact})
+	rel.markDeleted(rows)
+	if compact {
+		rel.compact()
+	}
+	rel.history.record(rel)
+	return rel
+}
+
+func (p *Plan) Insert(rows [][]interface{}) Relationer {
+	p.modificationError("Insert")
+	return nil
+}
+
+func (p *Plan) InsertColumns(batch *Batch) Relationer {
+	p.modificationError("InsertColumns")
+	return nil
+}
+
+func (p *Plan) Update(pred Predicate, assignments []NamedExpr) Relationer {
+	p.modificationError("Update")
+	return nil
+}
+
+func (p *Plan) Delete(pred Predicate) Relationer {
+	p.modificationError("Delete")
+	return nil
+}
+
+/*
+-------------------------------------------------
+Modification intern helper functions
+-------------------------------------------------
+*/
+
+// Exits because the operation changes a relation. The result of a query is computed from its
+// relations, so changing it would not change them.
+func (p *Plan) modificationError(operation string) {
+	error_("%s needs a relation, the result of the query '%s' can not be changed.", operation, p.root.name())
+}
+
+// Exits if the value is not of the type of the column.
+func checkValue(sig AttrInfo, value interface{}) {
+	if err := valueError(sig, value); err != nil {
+		error_("The %s.", err)
+	}
+}
+
+// Returns an error if the value is not of the type of the column.
+func valueError(sig AttrInfo, value interface{}) error {
+	t := typeOfValue(value)
+	if t == nil {
+		return fmt.Errorf("value '%v' of column '%s' has the unsupported type %T", value, sig.Name, value)
+	}
+	if type_ := t.dataType(); type_ != sig.Type {
+		return fmt.Errorf("value '%v' of column '%s' is of type %s instead of %s", value, sig.Name, type_, sig.Type)
+	}
+	return nil
+}
+
+// Builds the zone maps again from the block of the passed row on, the blocks before it are not
+// changed. Relations without zone maps are left out.
+func (rel *Relation) updateZones(from int) {
+	if rel.blockCount() == 0 {
+		return
+	}
+	block := from / zoneBlockSize
+	for i := range rel.Columns {
+		col := &rel.Columns[i]
+		rows := make([]int, col.length()-block*zoneBlockSize)
+		for k := range rows {
+			rows[k] = block*zoneBlockSize + k
+		}
+		view := col.view(rows)
+		tail := view.materialize()
+		col.zones = append(col.zones[:block:block], tail.Data.zoneMap(tail.nulls)...)
+	}
+}
+
+// Deletes the rows and appends the columns with their new values. The relation has to be
+// locked for writing.
+func (rel *Relation) replaceRows(rows []int, cols []Column) {
+	rel.markDeleted(rows)
+	rel.appendDelta(cols)
+}
+
+// Adds the rows to the deleted rows of the relation. The delete bitmap is replaced, so
+// snapshots keep their deleted rows.
+func (rel *Relation) markDeleted(rows []int) {
+	if len(rows) == 0 {
+		return
+	}
+	deleted := &bitmap{}
+	for _, row := range rows {
+		deleted.add(row)
+	}
+	if rel.deleted != nil {
+		deleted = rel.deleted.or(deleted)
+	}
+	rel.deleted = deleted
+}
+
+// Reports if the relation has to be compacted after the passed numbers of rows are deleted
+// and appended, which is the case if the fraction of its deleted rows reaches the compaction
+// ratio and no transaction sees the relation.
+func (rel *Relation) compactionDue(deleted, appended int) bool {
+	if rel.pins > 0 || len(rel.Columns) == 0 {
+		return false
+	}
+	if rel.deleted != nil {
+		deleted += rel.deleted.cardinality()
+	}
+	return deleted > 0 && float64(deleted) >= compactionRatio*float64(rel.length()+appended)
+}
+
+// Compacts the relation if needed, e.g., once the transactions seeing it ended. The compaction
+// is logged, as it moves the rows.
+func (rel *Relation) compactIfNeeded() {
+	if rel.compactionDue(0, 0) {
+		rel.logChange(walRecord{Kind: walCompact})
+		rel.compact()
+	}
+}
+
+// Removes the deleted rows from the data, merges the delta into it and builds the indexes, zone
+// maps and statistics of the relation again. The relation has to be locked for writing.
+func (rel *Relation) compact() {
+	live := rel.gather(rel.liveRows())
+	zoned := rel.blockCount() > 0
+	cols := make([]Column, len(live))
+	for i := range live {
+		cols[i] = live[i].materialize()
+	}
+	// the columns are replaced, so a running merge is made again on them
+	rel.Columns, rel.delta = cols, nil
+	rel.deleted = nil
+	rel.ownsData = true
+	if zoned {
+		rel.buildZones()
+	}
+	if rel.stats != nil {
+		rel.collectStats()
+	}
+	for _, info := range rel.indexes {
+		col := &rel.Columns[findColumnIn(rel.Columns, AttrInfo{Name: info.column})]
+		col.buildIndex(info)
+		info.rows = col.length()
+	}
+}
+
+// Returns the positions of the rows that are not deleted.
+func (rel *Relation) liveRows() []int {
+	if len(rel.Columns) == 0 {
+		return make([]int, 0)
+	}
+	rows := allRows(rel.length())
+	if rel.deleted == nil {
+		return rows
+	}
+	return difference(rows, rel.deleted.rows())
+}
+
+// Returns the number of rows that are not deleted.
+func (rel *Relation) liveCount() int {
+	if len(rel.Columns) == 0 {
+		return 0
+	}
+	if rel.deleted == nil {
+		return rel.length()
+	}
+	return rel.length() - rel.deleted.cardinality()
+}
+
+// Removes the deleted rows from the positions, the order of the other positions is kept.
+func (rel *Relation) withoutDeleted(rows []int) []int {
+	if rel.deleted == nil {
+		return rows
+	}
+	result := make([]int, 0, len(rows))
+	for _, row := range rows {
+		if !rel.deleted.contains(row) {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+// Returns the relation without its deleted rows and with the rows of its delta. The columns of
+// the result are views on the columns of the relation without indexes, or copies if the delta
+// has rows. Relations without deleted rows and delta are returned as they are.
+func (rel *Relation) live() *Relation {
+	if rel.deleted == nil && len(rel.delta) == 0 {
+		return rel
+	}
+	return &Relation{Name: rel.Name, Columns: rel.gather(rel.liveRows()), stats: rel.stats}
+}
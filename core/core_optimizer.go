@@ -0,0 +1,337 @@
+package core
+
+/*
+	The rule based optimizer rewrites the logical plan of a query before it is executed. It
+	folds constant expressions, merges consecutive selections into one conjunction, pushes
+	predicates down to the inputs of joins and prunes the columns that are not needed above
+	a join. Multi-way joins are ordered after the predicates are pushed into their inputs and
+	the algorithms of the joins are chosen by the cost model afterwards. The rewritten
+	plan is executed by the same physical operators as the original one.
+*/
+
+/*
+-------------------------------------------------
+Optimizer rules
+-------------------------------------------------
+*/
+
+// Applies all rules to the plan with the passed root. The schema of the root is not changed.
+func optimize(root planNode) planNode {
+	root = foldConstants(root)
+	root = pushSelections(root)
+	root = useBitmapIndexes(root)
+	root = skipBlocks(root)
+	root = orderJoins(root)
+	root = chooseJoinAlgorithms(root)
+	return pruneColumns(root, nil)
+}
+
+// Replaces the constant subexpressions of all projections by their values.
+func foldConstants(node planNode) planNode {
+	node = withChildren(node, foldConstants)
+	if project, ok := node.(*projectNode); ok {
+		exprs := make([]NamedExpr, len(project.exprs))
+		for i, named := range project.exprs {
+			exprs[i] = NamedExpr{Name: named.Name, Expr: named.Expr.fold()}
+		}
+		return &projectNode{child: project.child, exprs: exprs}
+	}
+	return node
+}
+
+// Moves every selection as far down the plan as possible.
+func pushSelections(node planNode) planNode {
+	if sel, ok := node.(*selectNode); ok {
+		return pushPredicates(pushSelections(sel.child), conjuncts(sel.pred))
+	}
+	return withChildren(node, pushSelections)
+}
+
+// Places the conjunctive predicates on top of the node or pushes them into its inputs.
+func pushPredicates(node planNode, preds []Predicate) planNode {
+	if len(preds) == 0 {
+		return node
+	}
+	switch n := node.(type) {
+	case *selectNode:
+		// consecutive selections are merged into one conjunction
+		return pushPredicates(n.child, append(conjuncts(n.pred), preds...))
+	case *scanNode:
+		return &scanNode{child: pushPredicates(n.child, preds), cols: n.cols}
+	case *orderByNode:
+		// filtering keeps the order of the remaining rows, so less rows have to be sorted
+		return &orderByNode{child: pushPredicates(n.child, preds), col: n.col, descending: n.descending}
+	case *collateNode:
+		// predicates on the collated column have to see the new collation
+		below, above := make([]Predicate, 0), make([]Predicate, 0)
+		for _, pred := range preds {
+			if findAttr(pred.attrs(), n.col) == -1 {
+				below = append(below, pred)
+			} else {
+				above = append(above, pred)
+			}
+		}
+		collate := &collateNode{child: pushPredicates(n.child, below), col: n.col, coll: n.coll}
+		return selectOn(collate, above)
+	case *joinNode:
+		first, second, above := make([]Predicate, 0), make([]Predicate, 0), make([]Predicate, 0)
+		for _, pred := range preds {
+			switch predicateSide(n, pred) {
+			case 0:
+				first = append(first, pred)
+			case 1:
+				second = append(second, pred)
+			default:
+				above = append(above, pred)
+			}
+		}
+		if n.kind != INNER {
+			// the NULL values of unmatched rows do not meet the predicates on the second input
+			above = append(above, second...)
+			second = second[:0]
+		}
+		join := *n
+		join.first = pushPredicates(n.first, first)
+		join.second = pushPredicates(n.second, second)
+		return selectOn(&join, above)
+	case *multiJoinNode:
+		multi := &multiJoinNode{names: n.names, inputs: append([]planNode{}, n.inputs...), preds: n.preds}
+		inputPreds := make([][]Predicate, len(n.inputs))
+		above := make([]Predicate, 0)
+		for _, pred := range preds {
+			if i := multi.inputOf(pred.attrs()); i != -1 {
+				inputPreds[i] = append(inputPreds[i], pred)
+			} else if joinPred, ok := multi.joinPredicate(pred); ok {
+				// comparisons of columns of two inputs are used as join predicates
+				multi.preds = append(append([]multiJoinPredicate{}, multi.preds...), joinPred)
+			} else {
+				above = append(above, pred)
+			}
+		}
+		for i := range multi.inputs {
+			multi.inputs[i] = pushPredicates(multi.inputs[i], inputPreds[i])
+		}
+		return selectOn(multi, above)
+	}
+	return selectOn(node, preds)
+}
+
+// Replaces the conjuncts of selections directly on relations that can be evaluated on the bitmap
+// indexes of the relation by an index scan. The other conjuncts are still evaluated by a selection.
+func useBitmapIndexes(node planNode) planNode {
+	node = withChildren(node, useBitmapIndexes)
+	sel, ok := node.(*selectNode)
+	if !ok {
+		return node
+	}
+	source, ok := sel.child.(*relationNode)
+	if !ok {
+		return node
+	}
+	indexed, rest := make([]Predicate, 0), make([]Predicate, 0)
+	for _, pred := range conjuncts(sel.pred) {
+		if hasBitmaps(source.rel.Columns, pred) {
+			indexed = append(indexed, pred)
+		} else {
+			rest = append(rest, pred)
+		}
+	}
+	switch len(indexed) {
+	case 0:
+		return node
+	case 1:
+		return selectOn(&indexScanNode{child: source, pred: indexed[0]}, rest)
+	}
+	return selectOn(&indexScanNode{child: source, pred: &andPredicate{preds: indexed}}, rest)
+}
+
+// Lets the selections directly on relations with zone maps skip the blocks that can not meet
+// their predicates. The selection still filters the rows of the other blocks.
+func skipBlocks(node planNode) planNode {
+	node = withChildren(node, skipBlocks)
+	sel, ok := node.(*selectNode)
+	if !ok {
+		return node
+	}
+	if source, ok := sel.child.(*relationNode); ok && source.rel.blockCount() > 0 {
+		return &selectNode{child: &relationNode{rel: source.rel, blockFilter: sel.pred}, pred: sel.pred}
+	}
+	return node
+}
+
+// Removes the columns that are not needed by the operators above from the inputs of joins.
+// A nil list of needed columns keeps the schema of the node.
+func pruneColumns(node planNode, needed []AttrInfo) planNode {
+	switch n := node.(type) {
+	case *scanNode:
+		cols := n.cols
+		if needed != nil {
+			cols = restrictAttrs(n.cols, needed)
+		}
+		return &scanNode{child: pruneColumns(n.child, cols), cols: cols}
+	case *selectNode:
+		return &selectNode{child: pruneColumns(n.child, neededWith(needed, n.pred.attrs()...)), pred: n.pred}
+	case *orderByNode:
+		child := pruneColumns(n.child, neededWith(needed, n.col))
+		return &orderByNode{child: child, col: n.col, descending: n.descending}
+	case *collateNode:
+		return &collateNode{child: pruneColumns(n.child, neededWith(needed, n.col)), col: n.col, coll: n.coll}
+	case *projectNode:
+		// the projection only needs the columns used by its expressions
+		used := make([]AttrInfo, 0)
+		for _, named := range n.exprs {
+			used = append(used, named.Expr.attrs()...)
+		}
+		return &projectNode{child: pruneColumns(n.child, used), exprs: n.exprs}
+	case *makeIndexNode:
+		// the indexed relation keeps all columns
+		return &makeIndexNode{child: pruneColumns(n.child, nil), col: n.col, kind: n.kind}
+	case *indexScanNode:
+		return &indexScanNode{child: pruneColumns(n.child, nil), pred: n.pred}
+	case *joinNode:
+		join := *n
+		if needed == nil {
+			join.first = pruneColumns(n.first, nil)
+			join.second = pruneColumns(n.second, nil)
+			return &join
+		}
+		schema := n.schema()
+		firstLen := len(n.first.schema())
+		first, second := []AttrInfo{n.fattr}, []AttrInfo{n.sattr}
+		for _, attr := range needed {
+			idx := findAttr(schema, attr)
+			if idx == -1 {
+				continue
+			}
+			if idx < firstLen {
+				first = append(first, n.first.schema()[idx])
+			} else {
+				second = append(second, n.second.schema()[idx-firstLen])
+			}
+		}
+		join.first = scanOn(pruneColumns(n.first, first), first)
+		join.second = scanOn(pruneColumns(n.second, second), second)
+		if n.algorithm == indexNestedLoopJoinAlgorithm {
+			// the index of the build relation is used instead of a new one
+			if n.buildFirst {
+				join.first = pruneColumns(n.first, nil)
+			} else {
+				join.second = pruneColumns(n.second, nil)
+			}
+		}
+		return &join
+	}
+	return node
+}
+
+/*
+-------------------------------------------------
+Optimizer intern helper functions
+-------------------------------------------------
+*/
+
+// Returns a copy of the node with the rule applied to its inputs.
+func withChildren(node planNode, rule func(planNode) planNode) planNode {
+	switch n := node.(type) {
+	case *selectNode:
+		return &selectNode{child: rule(n.child), pred: n.pred}
+	case *scanNode:
+		return &scanNode{child: rule(n.child), cols: n.cols}
+	case *projectNode:
+		return &projectNode{child: rule(n.child), exprs: n.exprs}
+	case *collateNode:
+		return &collateNode{child: rule(n.child), col: n.col, coll: n.coll}
+	case *orderByNode:
+		return &orderByNode{child: rule(n.child), col: n.col, descending: n.descending}
+	case *makeIndexNode:
+		return &makeIndexNode{child: rule(n.child), col: n.col, kind: n.kind}
+	case *indexScanNode:
+		return &indexScanNode{child: rule(n.child), pred: n.pred}
+	case *joinNode:
+		join := *n
+		join.first, join.second = rule(n.first), rule(n.second)
+		return &join
+	case *multiJoinNode:
+		multi := &multiJoinNode{names: n.names, inputs: make([]planNode, len(n.inputs)), preds: n.preds}
+		for i, input := range n.inputs {
+			multi.inputs[i] = rule(input)
+		}
+		return multi
+	}
+	return node
+}
+
+// Splits nested conjunctions into their parts.
+func conjuncts(pred Predicate) []Predicate {
+	and, ok := pred.(*andPredicate)
+	if !ok {
+		return []Predicate{pred}
+	}
+	preds := make([]Predicate, 0, len(and.preds))
+	for _, part := range and.preds {
+		preds = append(preds, conjuncts(part)...)
+	}
+	return preds
+}
+
+// Places a selection with the conjunction of the predicates on top of the node.
+func selectOn(node planNode, preds []Predicate) planNode {
+	switch len(preds) {
+	case 0:
+		return node
+	case 1:
+		return &selectNode{child: node, pred: preds[0]}
+	}
+	return &selectNode{child: node, pred: &andPredicate{preds: preds}}
+}
+
+// Places a scan of the needed columns on top of the node if it produces other columns too.
+func scanOn(node planNode, needed []AttrInfo) planNode {
+	cols := restrictAttrs(node.schema(), needed)
+	if len(cols) == len(node.schema()) {
+		return node
+	}
+	return &scanNode{child: node, cols: cols}
+}
+
+// Returns the input of the join all columns of the predicate belong to: 0 for the first input,
+// 1 for the second input and -1 if the predicate uses both inputs or the renamed join columns.
+func predicateSide(join *joinNode, pred Predicate) int {
+	schema := join.schema()
+	first, second := join.first.schema(), join.second.schema()
+	side := -1
+	for _, attr := range pred.attrs() {
+		idx := findAttr(schema, attr)
+		attrSide, childIdx := 0, -1
+		if idx >= len(first) {
+			attrSide, childIdx = 1, findAttr(second, attr)+len(first)
+		} else if idx != -1 {
+			childIdx = findAttr(first, attr)
+		}
+		// the column must be found at the same position inside the input
+		if idx == -1 || childIdx != idx || (side != -1 && side != attrSide) {
+			return -1
+		}
+		side = attrSide
+	}
+	return side
+}
+
+// Returns the signatures of the schema whose names are part of the needed columns.
+func restrictAttrs(schema []AttrInfo, needed []AttrInfo) []AttrInfo {
+	cols := make([]AttrInfo, 0, len(schema))
+	for _, sig := range schema {
+		if findAttr(needed, sig) != -1 {
+			cols = append(cols, sig)
+		}
+	}
+	return cols
+}
+
+// Adds the passed columns to the needed columns. All columns stay needed if needed is nil.
+func neededWith(needed []AttrInfo, attrs ...AttrInfo) []AttrInfo {
+	if needed == nil {
+		return nil
+	}
+	return append(append([]AttrInfo{}, needed...), attrs...)
+}
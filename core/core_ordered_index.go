@@ -0,0 +1,210 @@
+package core
+
+/*
+	Ordered indexes keep the rows of a column sorted by their values. Ranges are found by binary
+	search, so IndexScanWhere answers comparisons and between predicates and the index nested
+	loop join supports inequality comparisons. The rows of a range are returned in the order of
+	their values, which also serves OrderBy without sorting. Strings are sorted by the sort keys
+	of the collation of the column, NULL values are not part of the index.
+*/
+
+import (
+	"sort"
+)
+
+// The rangeIndex interface hides the key type of an ordered index.
+type rangeIndex interface {
+	// Returns the rows whose keys meet "key comp value" in the order of the keys.
+	lookup(comp Comparison, value interface{}) []int
+	// Returns the rows whose keys lie between lo and hi, both included, in the order of the keys.
+	between(lo, hi interface{}) []int
+	// Returns all rows in the order of their keys.
+	ordered() []int
+	// Returns the number of distinct keys.
+	keyCount() int
+	// Returns a copy of the index with the row added, the rows returned before stay unchanged.
+	insert(row int, key interface{}) rangeIndex
+}
+
+// The keys of the column in ascending order and the rows they belong to.
+type orderedIndex[T Value] struct {
+	keys []T
+	rows []int
+}
+
+// Builds the ordered index on the values. Rows with equal values keep their order.
+func newOrderedIndex[T Value](data []T, nulls []bool) *orderedIndex[T] {
+	rows := make([]int, 0, len(data))
+	for i := range data {
+		if nulls == nil || !nulls[i] {
+			rows = append(rows, i)
+		}
+	}
+	sort.SliceStable(rows, func(a, b int) bool { return data[rows[a]] < data[rows[b]] })
+	return &orderedIndex[T]{keys: gather(data, rows), rows: rows}
+}
+
+func (idx *orderedIndex[T]) lookup(comp Comparison, value interface{}) []int {
+	cmp, ok := keyComparator[T](value)
+	if !ok {
+		return []int{}
+	}
+	lower, upper := idx.search(cmp, false), idx.search(cmp, true)
+	switch comp {
+	case EQ:
+		return idx.rows[lower:upper]
+	case NEQ:
+		return append(append([]int{}, idx.rows[:lower]...), idx.rows[upper:]...)
+	case LT:
+		return idx.rows[:lower]
+	case LE:
+		return idx.rows[:upper]
+	case GT:
+		return idx.rows[upper:]
+	case GE:
+		return idx.rows[lower:]
+	}
+	error_("Comparison '%s' is not supported by ordered indexes.", comp)
+	return nil
+}
+
+func (idx *orderedIndex[T]) between(lo, hi interface{}) []int {
+	locmp, lok := keyComparator[T](lo)
+	hicmp, hok := keyComparator[T](hi)
+	if !lok || !hok {
+		return []int{}
+	}
+	lower, upper := idx.search(locmp, false), idx.search(hicmp, true)
+	if lower >= upper {
+		return []int{}
+	}
+	return idx.rows[lower:upper]
+}
+
+func (idx *orderedIndex[T]) ordered() []int {
+	return idx.rows
+}
+
+func (idx *orderedIndex[T]) keyCount() int {
+	count := 0
+	for i := range idx.keys {
+		if i == 0 || idx.keys[i] != idx.keys[i-1] {
+			count++
+		}
+	}
+	return count
+}
+
+func (idx *orderedIndex[T]) insert(row int, key interface{}) rangeIndex {
+	value := key.(T)
+	// rows with equal keys stay in the order of the rows
+	pos := sort.Search(len(idx.keys), func(i int) bool { return idx.keys[i] > value })
+	keys := append(append(append(make([]T, 0, len(idx.keys)+1), idx.keys[:pos]...), value), idx.keys[pos:]...)
+	rows := append(append(append(make([]int, 0, len(idx.rows)+1), idx.rows[:pos]...), row), idx.rows[pos:]...)
+	return &orderedIndex[T]{keys: keys, rows: rows}
+}
+
+// Returns the position of the first key greater than or equal to the compared value, or greater
+// than the compared value if after is true. The comparator returns the order of a key and the value.
+func (idx *orderedIndex[T]) search(cmp func(T) int, after bool) int {
+	return sort.Search(len(idx.keys), func(i int) bool {
+		if after {
+			return cmp(idx.keys[i]) > 0
+		}
+		return cmp(idx.keys[i]) >= 0
+	})
+}
+
+// Returns a function comparing keys of type T with the value. Numbers of the other numeric type
+// are compared as floats. Returns false if the value can not be compared with the keys.
+func keyComparator[T Value](value interface{}) (func(T) int, bool) {
+	if v, ok := value.(T); ok {
+		return func(key T) int {
+			switch {
+			case key < v:
+				return -1
+			case key > v:
+				return 1
+			}
+			return 0
+		}, true
+	}
+	if _, ok := numericValue(value); !ok {
+		return nil, false
+	}
+	if _, ok := numericValue(*new(T)); !ok {
+		return nil, false
+	}
+	return func(key T) int {
+		order, _ := compareValues(key, value)
+		return order
+	}, true
+}
+
+// Builds the ordered index of the column if it has none.
+func (col *Column) createOrderedIndex() {
+	if col.ordered != nil {
+		return
+	}
+	dense := col.materialize()
+	col.ordered = dense.Data.keys(col.Signature.Collation).orderedIndex(dense.nulls)
+}
+
+// Returns the rows whose values meet "value comp key" from the ordered index or, for EQ, from the
+// hash index if the column has no ordered index.
+func (col *Column) indexLookup(comp Comparison, key interface{}) []int {
+	if col.ordered == nil && comp == EQ {
+		return col.IndexLookup(key)
+	}
+	if col.ordered == nil {
+		error_("The column '%s' has no ordered index for the comparison '%s'.", col.Signature.Name, comp)
+	}
+	return col.ordered.lookup(comp, col.indexKey(key))
+}
+
+// Returns the rows meeting the comparison or between predicate on the column from its indexes.
+func (col *Column) indexScan(pred Predicate) []int {
+	switch p := pred.(type) {
+	case *comparePredicate:
+		if p.comp == NEQ {
+			error_("The column '%s' needs a BITMAP index for the comparison '%s'.", col.Signature.Name, p.comp)
+		}
+		return col.indexLookup(p.comp, p.compVal)
+	case *betweenPredicate:
+		if col.ordered == nil {
+			error_("The column '%s' has no ordered index for the between predicate.", col.Signature.Name)
+		}
+		return col.ordered.between(col.indexKey(p.lo), col.indexKey(p.hi))
+	}
+	error_("The predicate on '%s' needs BITMAP indexes on all its columns.", attrNames(pred.attrs()))
+	return nil
+}
+
+// Checks if the hash, ordered or bitmap indexes of the columns can find the rows of the predicate.
+func indexedPredicate(cols []Column, pred Predicate) bool {
+	return columnIndexed(cols, pred) || hasBitmaps(cols, pred)
+}
+
+// Checks if the hash or ordered index of the column of a comparison or between predicate can
+// find its rows.
+func columnIndexed(cols []Column, pred Predicate) bool {
+	idx := columnIndex(cols, pred.attrs()[0])
+	switch p := pred.(type) {
+	case *comparePredicate:
+		return cols[idx].hasIndexFor(p.comp)
+	case *betweenPredicate:
+		return cols[idx].ordered != nil
+	}
+	return false
+}
+
+// Checks if an index of the column can find the rows of the comparison.
+func (col *Column) hasIndexFor(comp Comparison) bool {
+	switch comp {
+	case EQ:
+		return col.Index != nil || col.ordered != nil
+	case LT, LE, GT, GE:
+		return col.ordered != nil
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package core
+
+/*
+	Pattern comparisons for STRING columns. Compiled patterns are cached, so a pattern used by
+	several queries is only compiled once. The cache keeps the most recently used patterns only,
+	so queries with ever new patterns do not fill the memory. A query matches every distinct
+	value of a column only once.
+*/
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The number of compiled patterns kept in the cache.
+const patternCacheSize = 256
+
+var (
+	// The compiled patterns by their expressions, the elements of patternCacheOrder.
+	patternCache = make(map[string]*list.Element)
+	// The cached patterns from the most to the least recently used one.
+	patternCacheOrder = list.New()
+	patternCacheMutex sync.Mutex
+)
+
+// A compiled pattern of the cache.
+type cachedPattern struct {
+	expr string
+	re   *regexp.Regexp
+}
+
+// Checks if the passed comparison is a pattern comparison.
+func isPatternComparison(comp Comparison) bool {
+	return comp == LIKE || comp == ILIKE || comp == STARTS_WITH || comp == CONTAINS || comp == REGEXP
+}
+
+// Returns a function matching strings against the passed pattern or an error if the pattern
+// is invalid.
+func patternMatcher(comp Comparison, pattern string) (func(string) bool, error) {
+	switch comp {
+	case STARTS_WITH:
+		return func(a string) bool { return strings.HasPrefix(a, pattern) }, nil
+	case CONTAINS:
+		return func(a string) bool { return strings.Contains(a, pattern) }, nil
+	case LIKE, ILIKE:
+		expr, err := likeToRegexp(pattern)
+		if err != nil {
+			return nil, err
+		}
+		flags := "(?s)"
+		if comp == ILIKE {
+			flags = "(?is)"
+		}
+		re, err := compilePattern(flags + "^" + expr + "$")
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	case REGEXP:
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s': %s", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+	return nil, fmt.Errorf("'%s' is not a pattern comparison", comp)
+}
+
+// The results of a pattern comparison for the distinct values of its column. They are kept as
+// long as the predicate, so every distinct value is matched once per query and not per batch.
+type patternMemo struct {
+	mu sync.Mutex
+	// the results by the collation of the column and the value
+	known map[Collation]map[string]bool
+}
+
+func newPatternMemo() *patternMemo {
+	return &patternMemo{known: make(map[Collation]map[string]bool)}
+}
+
+// Returns the positions out of the candidates whose values match. The values are matched as
+// sort keys of the collation, values matched before are looked up.
+func (m *patternMemo) filter(col Column, candidates []int, coll Collation, match func(string) bool) []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	known, ok := m.known[coll]
+	if !ok {
+		known = make(map[string]bool)
+		m.known[coll] = known
+	}
+	key := collationKey(coll)
+	return filterRows(col, candidates, func(a string) bool {
+		matched, ok := known[a]
+		if !ok {
+			matched = match(key(a))
+			known[a] = matched
+		}
+		return matched
+	})
+}
+
+// Returns the compiled regular expression from the cache or compiles and caches it. The least
+// recently used pattern is removed if the cache is full.
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	patternCacheMutex.Lock()
+	defer patternCacheMutex.Unlock()
+
+	if elem, ok := patternCache[expr]; ok {
+		patternCacheOrder.MoveToFront(elem)
+		return elem.Value.(*cachedPattern).re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patternCache[expr] = patternCacheOrder.PushFront(&cachedPattern{expr: expr, re: re})
+	if patternCacheOrder.Len() > patternCacheSize {
+		oldest := patternCacheOrder.Back()
+		patternCacheOrder.Remove(oldest)
+		delete(patternCache, oldest.Value.(*cachedPattern).expr)
+	}
+	return re, nil
+}
+
+// Translates a LIKE pattern into a regular expression. A backslash escapes the following
+// character, so \% matches a percent sign, \_ an underscore and \\ a backslash.
+func likeToRegexp(pattern string) (string, error) {
+	var builder strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			builder.WriteString(".*")
+		case r == '_':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		return "", fmt.Errorf("LIKE pattern '%s' ends with the escape character", pattern)
+	}
+	return builder.String(), nil
+}
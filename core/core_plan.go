@@ -0,0 +1,505 @@
+package core
+
+/*
+	Query plans. The operators of a Relationer do not compute their result, they return a Plan
+	recording the operator as a node on top of its input. The plan is only executed by sinks
+	like Print, Export or Materialize, which optimize it and pull the batches through the
+	iterators of the nodes.
+*/
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+	A Plan is a Relationer whose rows are computed on demand.
+*/
+type Plan struct {
+	root planNode
+	// the materialized result, nil until a sink needs all rows at once
+	result *Relation
+	// guards the result, plans can be used by several goroutines
+	mu sync.Mutex
+}
+
+// The physical algorithms of a join.
+type joinAlgorithm int
+
+const (
+	autoJoinAlgorithm joinAlgorithm = iota // chosen by the optimizer
+	nestedLoopJoinAlgorithm
+	indexNestedLoopJoinAlgorithm
+	hashJoinAlgorithm
+	parallelHashJoinAlgorithm
+)
+
+// The planNode interface is implemented by all operators of a plan.
+type planNode interface {
+	// Returns the name used for the materialized result.
+	name() string
+	// Returns the signatures of the produced columns.
+	schema() []AttrInfo
+	// Creates the iterator executing the node.
+	iterator() Iterator
+}
+
+type relationNode struct {
+	rel *Relation
+	// the predicate of the selection on top, blocks whose zones can not meet it are skipped
+	blockFilter Predicate
+}
+
+type selectNode struct {
+	child planNode
+	pred  Predicate
+}
+
+type scanNode struct {
+	child planNode
+	cols  []AttrInfo
+}
+
+type projectNode struct {
+	child planNode
+	exprs []NamedExpr
+}
+
+type collateNode struct {
+	child planNode
+	col   AttrInfo
+	coll  Collation
+}
+
+type orderByNode struct {
+	child      planNode
+	col        AttrInfo
+	descending bool
+}
+
+type makeIndexNode struct {
+	child planNode
+	col   AttrInfo
+	kind  IndexKind
+}
+
+// The predicate is a comparison or a between predicate on one column.
+type indexScanNode struct {
+	child planNode
+	pred  Predicate
+}
+
+// The first and second input are the inputs in the order of the columns of the result. The join
+// keeps the rows where "second comp first" is true. The kind refers to the first input as left one.
+type joinNode struct {
+	label      string
+	algorithm  joinAlgorithm
+	kind       JoinKind
+	first      planNode
+	second     planNode
+	fattr      AttrInfo
+	sattr      AttrInfo
+	comp       Comparison
+	coll       Collation
+	buildFirst bool       // the hash table or index is built on the first input instead of the second one
+	renameKeys bool       // the join columns get the suffixes " (first)" and " (second)"
+	collisions []AttrInfo // otherwise the columns of the second input named like a column of the first one get the suffix " (right)"
+	cost       float64
+}
+
+func (n *relationNode) name() string {
+	return n.rel.Name
+}
+
+func (n *relationNode) schema() []AttrInfo {
+	return signatures(n.rel.Columns)
+}
+
+func (n *relationNode) iterator() Iterator {
+	return &relationIterator{rel: n.rel, blockFilter: n.blockFilter}
+}
+
+func (n *selectNode) name() string {
+	return "select from " + n.child.name()
+}
+
+func (n *selectNode) schema() []AttrInfo {
+	return n.child.schema()
+}
+
+func (n *selectNode) iterator() Iterator {
+	return &selectIterator{child: n.child.iterator(), pred: n.pred}
+}
+
+func (n *scanNode) name() string {
+	return "scan on " + n.child.name()
+}
+
+func (n *projectNode) name() string {
+	return "projection of " + n.child.name()
+}
+
+func (n *projectNode) iterator() Iterator {
+	return &projectIterator{child: n.child.iterator(), exprs: n.exprs}
+}
+
+func (n *collateNode) name() string {
+	return n.child.name()
+}
+
+func (n *orderByNode) name() string {
+	return "order by on " + n.child.name()
+}
+
+func (n *orderByNode) schema() []AttrInfo {
+	return n.child.schema()
+}
+
+func (n *makeIndexNode) name() string {
+	return n.child.name()
+}
+
+func (n *makeIndexNode) schema() []AttrInfo {
+	return n.child.schema()
+}
+
+func (n *indexScanNode) name() string {
+	return "IndexScan on " + n.child.name()
+}
+
+// Returns the column of the predicate of the index scan.
+func (n *indexScanNode) col() AttrInfo {
+	return n.pred.attrs()[0]
+}
+
+// Checks if the indexes of the relation can find the rows of the predicate.
+func (n *indexScanNode) indexed(rel *Relation) bool {
+	return indexedPredicate(rel.Columns, n.pred)
+}
+
+func (n *indexScanNode) schema() []AttrInfo {
+	return n.child.schema()
+}
+
+func (n *joinNode) name() string {
+	return n.label
+}
+
+func (n *scanNode) schema() []AttrInfo {
+	return n.cols
+}
+
+func (n *scanNode) iterator() Iterator {
+	child := n.child.iterator()
+	indices := make([]int, len(n.cols))
+	for i, col := range n.cols {
+		indices[i] = columnIndex(schemaColumns(n.child.schema()), col)
+	}
+	return &scanIterator{child: child, indices: indices, schema: n.cols}
+}
+
+func (n *projectNode) schema() []AttrInfo {
+	return n.iterator().Schema()
+}
+
+func (n *collateNode) schema() []AttrInfo {
+	return n.iterator().Schema()
+}
+
+func (n *collateNode) iterator() Iterator {
+	return &collateIterator{child: n.child.iterator(), col: n.col, coll: n.coll}
+}
+
+func (n *orderByNode) iterator() Iterator {
+	return &orderByIterator{child: n.child.iterator(), col: n.col, descending: n.descending}
+}
+
+func (n *makeIndexNode) iterator() Iterator {
+	return &makeIndexIterator{child: n.child.iterator(), name: n.child.name(), col: n.col, kind: n.kind}
+}
+
+func (n *indexScanNode) iterator() Iterator {
+	return &indexScanIterator{child: n.child.iterator(), name: n.child.name(), pred: n.pred}
+}
+
+func (n *joinNode) schema() []AttrInfo {
+	first, second := n.first.schema(), n.second.schema()
+	schema := make([]AttrInfo, 0, len(first)+len(second))
+	for _, sig := range first {
+		if n.renameKeys && sig.Name == n.fattr.Name {
+			sig.Name += " (first)"
+		}
+		schema = append(schema, sig)
+	}
+	if n.kind == SEMI || n.kind == ANTI {
+		return schema
+	}
+	for _, sig := range second {
+		if n.renameKeys && sig.Name == n.sattr.Name {
+			sig.Name += " (second)"
+		} else if !n.renameKeys && findAttr(n.collisions, sig) != -1 {
+			sig.Name += " (right)"
+		}
+		schema = append(schema, sig)
+	}
+	return schema
+}
+
+func (n *joinNode) iterator() Iterator {
+	probe, build := n.first, n.second
+	if n.buildFirst {
+		probe, build = n.second, n.first
+	}
+	return &joinIterator{node: n, probe: probe.iterator(), buildInput: build.iterator(), schema: n.schema()}
+}
+
+/*
+-------------------------------------------------
+Relationer implementation of plans
+-------------------------------------------------
+*/
+
+func (p *Plan) Scan(colList []AttrInfo) Relationer {
+	schema := p.root.schema()
+	cols := make([]AttrInfo, 0, len(colList))
+	for _, sig := range colList {
+		idx := findAttr(schema, sig)
+		if idx != -1 {
+			cols = append(cols, schema[idx])
+		} else {
+			warn("Unable to find column '%s'; skipping this column.", sig.Name)
+		}
+	}
+	return &Plan{root: &scanNode{child: p.root, cols: cols}}
+}
+
+func (p *Plan) Select(col AttrInfo, comp Comparison, compVal interface{}) Relationer {
+	return p.SelectWhere(Compare(col, comp, compVal))
+}
+
+func (p *Plan) SelectWhere(pred Predicate) Relationer {
+	checkAttrs(p.root.schema(), pred.attrs())
+	return &Plan{root: &selectNode{child: p.root, pred: pred}}
+}
+
+func (p *Plan) OrderBy(col AttrInfo, descending bool) Relationer {
+	checkAttrs(p.root.schema(), []AttrInfo{col})
+	return &Plan{root: &orderByNode{child: p.root, col: col, descending: descending}}
+}
+
+func (p *Plan) Project(exprs []NamedExpr) Relationer {
+	result, err := p.ProjectChecked(exprs)
+	if err != nil {
+		error_("Invalid projection: %s", err)
+	}
+	return result
+}
+
+func (p *Plan) ProjectChecked(exprs []NamedExpr) (Relationer, error) {
+	// check all expressions before evaluating any row
+	if err := TypeCheck(p, exprs); err != nil {
+		return nil, err
+	}
+	return &Plan{root: &projectNode{child: p.root, exprs: exprs}}, nil
+}
+
+func (p *Plan) Collate(col AttrInfo, coll Collation) Relationer {
+	schema := p.root.schema()
+	checkAttrs(schema, []AttrInfo{col})
+	if schema[findAttr(schema, col)].Type != STRING {
+		error_("Collations are only supported for strings, '%s' is not a string column.", col.Name)
+	}
+	collationKey(coll) // exits for unknown collations
+	return &Plan{root: &collateNode{child: p.root, col: col, coll: coll}}
+}
+
+func (p *Plan) SetCollation(col AttrInfo, coll Collation) Relationer {
+	return p.materialized().SetCollation(col, coll)
+}
+
+func (p *Plan) Print() {
+	p.materialized().Print()
+}
+
+func (p *Plan) MakeIndex(indexCol AttrInfo, kind ...IndexKind) Relationer {
+	checkAttrs(p.root.schema(), []AttrInfo{indexCol})
+	return &Plan{root: &makeIndexNode{child: p.root, col: indexCol, kind: indexKind(kind)}}
+}
+
+func (p *Plan) IndexScan(col AttrInfo, key interface{}) Relationer {
+	checkAttrs(p.root.schema(), []AttrInfo{col})
+	return &Plan{root: &indexScanNode{child: p.root, pred: Compare(col, EQ, key)}}
+}
+
+func (p *Plan) IndexScanWhere(pred Predicate) Relationer {
+	checkIndexPredicate(pred)
+	checkAttrs(p.root.schema(), pred.attrs())
+	return &Plan{root: &indexScanNode{child: p.root, pred: pred}}
+}
+
+func (p *Plan) Materialize() Relationer {
+	return p.materialized()
+}
+
+func (p *Plan) Export(csvFile string, separator rune) {
+	export(p.Iterator(), csvFile, separator)
+}
+
+func (p *Plan) Iterator() Iterator {
+	return optimize(p.root).iterator()
+}
+
+func (p *Plan) columns() []Column {
+	return p.materialized().columns()
+}
+
+func (p *Plan) findColumn(col AttrInfo) int {
+	return findAttr(p.root.schema(), col)
+}
+
+func (p *Plan) rowCount() int {
+	return p.materialized().rowCount()
+}
+
+func (p *Plan) schema() []AttrInfo {
+	return p.root.schema()
+}
+
+// Executes the plan once and keeps the result.
+func (p *Plan) materialized() *Relation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.result == nil {
+		p.result = materialize(p.root.name(), p.Iterator())
+	}
+	return p.result
+}
+
+/*
+-------------------------------------------------
+Plan intern helper functions
+-------------------------------------------------
+*/
+
+// Returns the root node of a plan for the passed relationer.
+func planOf(rel Relationer) planNode {
+	switch r := rel.(type) {
+	case *Plan:
+		return r.root
+	case *Relation:
+		return &relationNode{rel: r.snapshot()}
+	}
+	error_("Unknown relation type '%T'.", rel)
+	return nil
+}
+
+// Exits if the predicate can not be evaluated by an index scan.
+func checkIndexPredicate(pred Predicate) {
+	switch p := pred.(type) {
+	case *comparePredicate:
+		if !indexComparison(p.comp) && p.comp != NEQ {
+			error_("Comparison '%s' is not supported by index scans.", p.comp)
+		}
+	case *betweenPredicate, *inPredicate, *isNullPredicate, *matchPredicate:
+	case *andPredicate:
+		for _, part := range p.preds {
+			checkIndexPredicate(part)
+		}
+	case *orPredicate:
+		for _, part := range p.preds {
+			checkIndexPredicate(part)
+		}
+	case *notPredicate:
+		checkIndexPredicate(p.pred)
+	default:
+		error_("Index scans do not support comparisons of columns.")
+	}
+}
+
+// Returns the kind of index passed to MakeIndex, HASH by default.
+func indexKind(kinds []IndexKind) IndexKind {
+	if len(kinds) == 0 {
+		return HASH
+	}
+	if len(kinds) > 1 || (kinds[0] != HASH && kinds[0] != ORDERED && kinds[0] != BITMAP && kinds[0] != FULLTEXT) {
+		error_("Expected one index kind, got %v.", kinds)
+	}
+	return kinds[0]
+}
+
+// Checks if indexes can find the rows of the comparison.
+func indexComparison(comp Comparison) bool {
+	switch comp {
+	case EQ, LT, LE, GT, GE:
+		return true
+	}
+	return false
+}
+
+// Returns the index of the signature with the name of the passed attribute or -1.
+func findAttr(schema []AttrInfo, attr AttrInfo) int {
+	for idx, sig := range schema {
+		if sig.Name == attr.Name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Exits if one of the attributes is not part of the schema.
+func checkAttrs(schema []AttrInfo, attrs []AttrInfo) {
+	for _, attr := range attrs {
+		if findAttr(schema, attr) == -1 {
+			error_("Unknown column name '%s'.", attr.Name)
+		}
+	}
+}
+
+// Writes all rows produced by the iterator into a csv file. NULL values are written as empty fields.
+func export(it Iterator, csvFile string, separator rune) {
+	file, err := os.Create(csvFile)
+	checkError(err)
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Comma = separator
+
+	header := make([]string, len(it.Schema()))
+	for i, sig := range it.Schema() {
+		header[i] = sig.Name
+	}
+	checkError(writer.Write(header))
+
+	it.Open()
+	defer it.Close()
+	for batch := it.Next(); batch != nil; batch = it.Next() {
+		for row := 0; row < batch.RowCount(); row++ {
+			record := make([]string, len(batch.Columns))
+			for col := range batch.Columns {
+				if value := batch.Value(col, row); value != nil {
+					record[col] = formatValue(value)
+				}
+			}
+			checkError(writer.Write(record))
+		}
+	}
+	writer.Flush()
+	checkError(writer.Error())
+}
+
+// Returns the textual representation of a value. Floats always contain a decimal point, so
+// Load detects their type again.
+func formatValue(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		text := strconv.FormatFloat(f, 'f', -1, 64)
+		if !strings.Contains(text, ".") {
+			text += ".0"
+		}
+		return text
+	}
+	return fmt.Sprint(value)
+}
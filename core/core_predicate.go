@@ -0,0 +1,474 @@
+package core
+
+/*
+	Predicates that can be evaluated by Relation.SelectWhere. A predicate filters a list of
+	candidate rows (a selection vector) and returns the candidates whose rows meet it, so
+	combined predicates only look at the rows that are still relevant.
+*/
+
+import "fmt"
+
+/*
+	The Predicate interface is implemented by all filter conditions.
+*/
+type Predicate interface {
+	// Returns the positions out of the sorted candidates whose rows meet the predicate.
+	filter(cols []Column, candidates []int) []int
+	// Returns the positions out of the sorted candidates whose rows neither meet nor fail the
+	// predicate, because a compared value is NULL.
+	unknown(cols []Column, candidates []int) []int
+	// Returns the columns used by the predicate.
+	attrs() []AttrInfo
+	// Returns an error if a column is unknown or a value is not of the type of its column.
+	check(cols []Column) error
+}
+
+type comparePredicate struct {
+	col     AttrInfo
+	comp    Comparison
+	compVal interface{}
+	memo    *patternMemo // the results of pattern comparisons
+}
+
+type columnComparePredicate struct {
+	left  AttrInfo
+	comp  Comparison
+	right AttrInfo
+}
+
+type inPredicate struct {
+	col    AttrInfo
+	values []interface{}
+}
+
+type betweenPredicate struct {
+	col AttrInfo
+	lo  interface{}
+	hi  interface{}
+}
+
+type isNullPredicate struct {
+	col AttrInfo
+}
+
+type andPredicate struct {
+	preds []Predicate
+}
+
+type orPredicate struct {
+	preds []Predicate
+}
+
+type notPredicate struct {
+	pred Predicate
+}
+
+type matchPredicate struct {
+	col   AttrInfo
+	query string
+	terms matchQuery
+}
+
+/*
+	Compares every value of a column with a constant value, e.g., Compare(AttrInfo{Name: "ID"}, LT, 10).
+*/
+func Compare(col AttrInfo, comp Comparison, compVal interface{}) Predicate {
+	pred := &comparePredicate{col: col, comp: comp, compVal: compVal}
+	if isPatternComparison(comp) {
+		pred.memo = newPatternMemo()
+	}
+	return pred
+}
+
+/*
+	Compares the values of two columns of the same relation row by row.
+*/
+func CompareColumns(left AttrInfo, comp Comparison, right AttrInfo) Predicate {
+	return &columnComparePredicate{left: left, comp: comp, right: right}
+}
+
+/*
+	Checks if the value of a column is one of the passed values.
+*/
+func In(col AttrInfo, values ...interface{}) Predicate {
+	return &inPredicate{col: col, values: values}
+}
+
+/*
+	Checks if the value of a column lies between lo and hi, both inclusive.
+*/
+func Between(col AttrInfo, lo, hi interface{}) Predicate {
+	return &betweenPredicate{col: col, lo: lo, hi: hi}
+}
+
+/*
+	Checks if the value of a column is NULL.
+*/
+func IsNull(col AttrInfo) Predicate {
+	return &isNullPredicate{col: col}
+}
+
+/*
+	Conjunction of the passed predicates. Stops as soon as no candidate is left.
+*/
+func And(preds ...Predicate) Predicate {
+	return &andPredicate{preds: preds}
+}
+
+/*
+	Disjunction of the passed predicates. Rows that already matched are not checked again.
+*/
+func Or(preds ...Predicate) Predicate {
+	return &orPredicate{preds: preds}
+}
+
+/*
+	Negation of the passed predicate. Like in SQL, comparisons with NULL values are neither true
+	nor false, so the rows whose compared values are NULL are not returned, e.g.,
+	Not(Compare(AttrInfo{Name: "Alter"}, GT, 20)) does not return rows without "Alter".
+*/
+func Not(pred Predicate) Predicate {
+	return &notPredicate{pred: pred}
+}
+
+/*
+	Checks if the value of a STRING column matches the full-text query, e.g., Match(AttrInfo{Name: "Text"},
+	"rot grün OR \"hell blau\""). Terms separated by white space all have to be found, OR separates
+	alternatives and terms in double quotes are phrases. Columns with a FULLTEXT index are searched
+	with its tokenizer, the values of other columns are split by the DefaultTokenizer.
+*/
+func Match(col AttrInfo, query string) Predicate {
+	return &matchPredicate{col: col, query: query, terms: parseMatchQuery(query)}
+}
+
+func (p *comparePredicate) filter(cols []Column, candidates []int) []int {
+	col := cols[columnIndex(cols, p.col)]
+	if isPatternComparison(p.comp) {
+		if !col.isString() {
+			error_("Pattern comparison '%s' is only supported for strings, '%s' is not a string column.", p.comp, p.col.Name)
+		}
+		// regular expressions are matched against the values, the other patterns against the sort keys
+		coll, pattern := col.Signature.Collation, asString(p.compVal)
+		if p.comp == REGEXP {
+			coll = BINARY
+		} else {
+			pattern = col.collate(pattern)
+		}
+		match, err := patternMatcher(p.comp, pattern)
+		if err != nil {
+			error_("Invalid pattern comparison on '%s': %s", p.col.Name, err)
+		}
+		return p.memo.filter(col, candidates, coll, match)
+	}
+	if col.isString() && col.Signature.Collation != BINARY {
+		return filterRows(col, candidates, collated(col.Signature.Collation, comparator(p.comp, col.collate(asString(p.compVal)))))
+	}
+	return getRelevantRows(p.comp, p.compVal, col, candidates)
+}
+
+func (p *columnComparePredicate) filter(cols []Column, candidates []int) []int {
+	left := cols[columnIndex(cols, p.left)]
+	right := cols[columnIndex(cols, p.right)]
+	if left.Signature.Type != right.Signature.Type {
+		error_("Not matching types for comparing '%s' and '%s'.", p.left.Name, p.right.Name)
+	}
+	coll := commonCollation(left.Signature, right.Signature)
+	return getRelevantPairs(p.comp, left, right, left.Data.keys(coll), right.Data.keys(coll), candidates)
+}
+
+func (p *inPredicate) filter(cols []Column, candidates []int) []int {
+	col := cols[columnIndex(cols, p.col)]
+	if col.isString() && col.Signature.Collation != BINARY {
+		return filterRows(col, candidates, collated(col.Signature.Collation, inSet(p.values, col.collateValue)))
+	}
+	return col.Data.in(p.values, col.rows, col.nulls, candidates, make([]int, 0))
+}
+
+func (p *betweenPredicate) filter(cols []Column, candidates []int) []int {
+	return And(Compare(p.col, GE, p.lo), Compare(p.col, LE, p.hi)).filter(cols, candidates)
+}
+
+func (p *isNullPredicate) filter(cols []Column, candidates []int) []int {
+	col := cols[columnIndex(cols, p.col)]
+	selection := make([]int, 0)
+	for _, i := range candidates {
+		if col.isNull(i) {
+			selection = append(selection, i)
+		}
+	}
+	return selection
+}
+
+func (p *andPredicate) filter(cols []Column, candidates []int) []int {
+	for _, pred := range p.preds {
+		if len(candidates) == 0 {
+			break
+		}
+		candidates = pred.filter(cols, candidates)
+	}
+	return candidates
+}
+
+func (p *orPredicate) filter(cols []Column, candidates []int) []int {
+	matched := make([]int, 0)
+	for _, pred := range p.preds {
+		if len(candidates) == 0 {
+			break
+		}
+		found := pred.filter(cols, candidates)
+		matched = union(matched, found)
+		candidates = difference(candidates, found)
+	}
+	return matched
+}
+
+func (p *notPredicate) filter(cols []Column, candidates []int) []int {
+	return difference(candidates, union(p.pred.filter(cols, candidates), p.pred.unknown(cols, candidates)))
+}
+
+func (p *matchPredicate) filter(cols []Column, candidates []int) []int {
+	col := cols[columnIndex(cols, p.col)]
+	if !col.isString() {
+		error_("Match is only supported for strings, '%s' is not a string column.", p.col.Name)
+	}
+	if col.fulltext != nil && col.rows == nil {
+		return intersect(candidates, col.fulltext.search(p.terms))
+	}
+	return filterRows(col, candidates, func(value string) bool { return DefaultTokenizer.matches(p.terms, value) })
+}
+
+func (p *comparePredicate) unknown(cols []Column, candidates []int) []int {
+	return IsNull(p.col).filter(cols, candidates)
+}
+
+func (p *columnComparePredicate) unknown(cols []Column, candidates []int) []int {
+	return union(IsNull(p.left).filter(cols, candidates), IsNull(p.right).filter(cols, candidates))
+}
+
+func (p *inPredicate) unknown(cols []Column, candidates []int) []int {
+	return IsNull(p.col).filter(cols, candidates)
+}
+
+func (p *betweenPredicate) unknown(cols []Column, candidates []int) []int {
+	return IsNull(p.col).filter(cols, candidates)
+}
+
+func (p *isNullPredicate) unknown(cols []Column, candidates []int) []int {
+	return make([]int, 0)
+}
+
+// A conjunction is unknown if none of its predicates is false and one is unknown.
+func (p *andPredicate) unknown(cols []Column, candidates []int) []int {
+	possible := candidates
+	for _, pred := range p.preds {
+		if len(possible) == 0 {
+			break
+		}
+		possible = union(pred.filter(cols, possible), pred.unknown(cols, possible))
+	}
+	return difference(possible, p.filter(cols, possible))
+}
+
+// A disjunction is unknown if none of its predicates is true and one is unknown.
+func (p *orPredicate) unknown(cols []Column, candidates []int) []int {
+	rest := difference(candidates, p.filter(cols, candidates))
+	unknown := make([]int, 0)
+	for _, pred := range p.preds {
+		unknown = union(unknown, pred.unknown(cols, rest))
+	}
+	return unknown
+}
+
+func (p *notPredicate) unknown(cols []Column, candidates []int) []int {
+	return p.pred.unknown(cols, candidates)
+}
+
+func (p *matchPredicate) unknown(cols []Column, candidates []int) []int {
+	return IsNull(p.col).filter(cols, candidates)
+}
+
+func (p *comparePredicate) check(cols []Column) error {
+	sig, err := predicateColumn(cols, p.col)
+	if err != nil {
+		return err
+	}
+	if isPatternComparison(p.comp) && sig.Type != STRING {
+		return fmt.Errorf("pattern comparison '%s' on the %s column '%s'", p.comp, sig.Type, sig.Name)
+	}
+	if err := valueError(sig, p.compVal); err != nil || !isPatternComparison(p.comp) {
+		return err
+	}
+	_, err = patternMatcher(p.comp, asString(p.compVal))
+	return err
+}
+
+func (p *columnComparePredicate) check(cols []Column) error {
+	left, err := predicateColumn(cols, p.left)
+	if err != nil {
+		return err
+	}
+	right, err := predicateColumn(cols, p.right)
+	if err != nil {
+		return err
+	}
+	if left.Type != right.Type {
+		return fmt.Errorf("comparison of the %s column '%s' with the %s column '%s'", left.Type, left.Name, right.Type, right.Name)
+	}
+	return nil
+}
+
+func (p *inPredicate) check(cols []Column) error {
+	sig, err := predicateColumn(cols, p.col)
+	if err != nil {
+		return err
+	}
+	for _, value := range p.values {
+		if err := valueError(sig, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *betweenPredicate) check(cols []Column) error {
+	return And(Compare(p.col, GE, p.lo), Compare(p.col, LE, p.hi)).check(cols)
+}
+
+func (p *isNullPredicate) check(cols []Column) error {
+	_, err := predicateColumn(cols, p.col)
+	return err
+}
+
+func (p *andPredicate) check(cols []Column) error { return checkPredicates(cols, p.preds) }
+func (p *orPredicate) check(cols []Column) error  { return checkPredicates(cols, p.preds) }
+func (p *notPredicate) check(cols []Column) error { return p.pred.check(cols) }
+
+func (p *matchPredicate) check(cols []Column) error {
+	sig, err := predicateColumn(cols, p.col)
+	if err == nil && sig.Type != STRING {
+		err = fmt.Errorf("match on the %s column '%s'", sig.Type, sig.Name)
+	}
+	return err
+}
+
+func (p *comparePredicate) attrs() []AttrInfo       { return []AttrInfo{p.col} }
+func (p *columnComparePredicate) attrs() []AttrInfo { return []AttrInfo{p.left, p.right} }
+func (p *inPredicate) attrs() []AttrInfo            { return []AttrInfo{p.col} }
+func (p *betweenPredicate) attrs() []AttrInfo       { return []AttrInfo{p.col} }
+func (p *isNullPredicate) attrs() []AttrInfo        { return []AttrInfo{p.col} }
+func (p *andPredicate) attrs() []AttrInfo           { return predicateAttrs(p.preds) }
+func (p *orPredicate) attrs() []AttrInfo            { return predicateAttrs(p.preds) }
+func (p *notPredicate) attrs() []AttrInfo           { return p.pred.attrs() }
+func (p *matchPredicate) attrs() []AttrInfo         { return []AttrInfo{p.col} }
+
+/*
+-------------------------------------------------
+Predicate intern helper functions
+-------------------------------------------------
+*/
+
+// Returns the index of the column with the passed name and exits if there is none.
+func columnIndex(cols []Column, attr AttrInfo) int {
+	for idx, col := range cols {
+		if col.Signature.Name == attr.Name {
+			return idx
+		}
+	}
+	error_("Unknown column name '%s'.", attr.Name)
+	return -1 // Dead code ...
+}
+
+// Returns the signature of the column used by a predicate or an error if it is unknown.
+func predicateColumn(cols []Column, attr AttrInfo) (AttrInfo, error) {
+	idx := findColumnIn(cols, attr)
+	if idx == -1 {
+		return attr, fmt.Errorf("unknown column '%s'", attr.Name)
+	}
+	return cols[idx].Signature, nil
+}
+
+// Checks the passed predicates and returns the first error found.
+func checkPredicates(cols []Column, preds []Predicate) error {
+	for _, pred := range preds {
+		if err := pred.check(cols); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the columns used by all passed predicates.
+func predicateAttrs(preds []Predicate) []AttrInfo {
+	attrs := make([]AttrInfo, 0)
+	for _, pred := range preds {
+		attrs = append(attrs, pred.attrs()...)
+	}
+	return attrs
+}
+
+// Returns a function checking if a value is one of the passed values.
+func inSet[T Value](values []interface{}, cast func(interface{}) T) func(T) bool {
+	set := make(map[T]struct{}, len(values))
+	for _, val := range values {
+		set[cast(val)] = struct{}{}
+	}
+	return func(a T) bool {
+		_, ok := set[a]
+		return ok
+	}
+}
+
+// Returns the positions of the candidates that are not part of the removed positions.
+// Both arrays have to be sorted.
+func difference(candidates, removed []int) []int {
+	result := make([]int, 0, len(candidates))
+	j := 0
+	for _, pos := range candidates {
+		for j < len(removed) && removed[j] < pos {
+			j++
+		}
+		if j < len(removed) && removed[j] == pos {
+			continue
+		}
+		result = append(result, pos)
+	}
+	return result
+}
+
+// Merges two sorted arrays of positions into one sorted array without duplicates.
+func union(a, b []int) []int {
+	result := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if j == len(b) || (i < len(a) && a[i] < b[j]) {
+			result = append(result, a[i])
+			i++
+		} else if i == len(a) || b[j] < a[i] {
+			result = append(result, b[j])
+			j++
+		} else {
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// Returns the positions that are part of both sorted arrays.
+func intersect(a, b []int) []int {
+	result := make([]int, 0, minimum(len(a), len(b)))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
@@ -16,6 +16,7 @@ func (col *Column) CreateIndex() bool {
 }
 
 func (col *Column) IndexInsert(key interface{}, i int) {
+    key = col.indexKey(key)
     if col.Index[key] == nil {
         col.Index[key] = make([]int, 1)
         col.Index[key][0] = i
@@ -25,7 +26,15 @@ func (col *Column) IndexInsert(key interface{}, i int) {
 }
 
 func (col *Column) IndexLookup(key interface{}) []int {
-    return col.Index[key]
+    return col.Index[col.indexKey(key)]
+}
+
+// Returns the key stored inside the index, strings are stored with the sort key of their collation.
+func (col *Column) indexKey(key interface{}) interface{} {
+    if col.isString() && col.Signature.Collation != BINARY {
+        return col.collateValue(key)
+    }
+    return key
 }
 
 func (col *Column) isInt() bool {
@@ -41,52 +50,139 @@ func (col *Column) isString() bool {
 }
 
 func (col *Column) intAt(i int) int {
-    return col.Data.([]int)[i]
+    return values[int](col.Data)[col.row(i)]
 }
 
 func (col *Column) floatAt(i int) float64 {
-    return col.Data.([]float64)[i]
+    return values[float64](col.Data)[col.row(i)]
 }
 
 func (col *Column) stringAt(i int) string {
-    return col.Data.([]string)[i]
+    return values[string](col.Data)[col.row(i)]
 }
 
-func (rel *Relation) Scan(colList []AttrInfo) Relationer {
-	var rs *Relation = new(Relation)
-
-	for _, sig := range colList {
-		var col_idx = rel.findColumn(sig)
-		if col_idx != -1 {
-			rs.Columns = append(rs.Columns, rel.Columns[col_idx])
-		} else {
-			warn("Unable to find column '%s'; skipping this column.", sig.Name)
-		}
-	}
+// Returns the value of the i-th row.
+func (col *Column) valueAt(i int) interface{} {
+    return col.Data.At(col.row(i))
+}
+
+// Returns the position inside the data for the i-th row of the column.
+func (col *Column) row(i int) int {
+    if col.rows == nil {
+        return i
+    }
+    return col.rows[i]
+}
+
+// Returns the number of rows of the column.
+func (col *Column) length() int {
+    if col.rows != nil {
+        return len(col.rows)
+    }
+    if col.Data == nil {
+        error_("Unknown or unset column type.")
+    }
+    return col.Data.Len()
+}
+
+// Checks if the i-th row of the column is NULL.
+func (col *Column) isNull(i int) bool {
+    return col.nulls != nil && col.nulls[col.row(i)]
+}
+
+// Returns the positions out of the passed positions whose rows are NULL.
+func (col *Column) nullRows(positions []int) []int {
+    result := make([]int, 0)
+    if col.nulls == nil {
+        return result
+    }
+    for _, pos := range positions {
+        if col.isNull(pos) {
+            result = append(result, pos)
+        }
+    }
+    return result
+}
+
+// Marks the i-th row of a materialized column with n rows as NULL.
+func (col *Column) setNull(i int, n int) {
+    if col.nulls == nil {
+        col.nulls = make([]bool, n)
+    }
+    col.nulls[i] = true
+}
 
-	return rs
+// Copies the j-th value of the source column into the i-th row of a materialized column.
+func (col *Column) set(i int, src Column, j int) {
+    if col.nulls != nil {
+        col.nulls[i] = false
+    }
+    col.Data.Set(i, src.valueAt(j))
+}
+
+// Copies the rows of the source column to the passed positions of a materialized column with n rows.
+func (col *Column) scatter(src Column, positions []int, n int) {
+    for k, pos := range positions {
+        if src.isNull(k) {
+            col.setNull(pos, n)
+        } else {
+            col.set(pos, src, k)
+        }
+    }
+}
+
+// Creates a column that only contains the rows at the passed positions. The data is shared
+// with this column, the index is dropped since its positions are no longer valid.
+func (col *Column) view(selection []int) Column {
+    rows := selection
+    if rows == nil {
+        rows = make([]int, 0)
+    }
+    if col.rows != nil {
+        rows = make([]int, len(selection))
+        for i, pos := range selection {
+            rows[i] = col.rows[pos]
+        }
+    }
+    return Column{Signature: col.Signature, Data: col.Data, rows: rows, nulls: col.nulls}
+}
+
+// Copies the rows of the selection vector into a new data array. Columns without a selection
+// vector are returned as they are.
+func (col *Column) materialize() Column {
+    if col.rows == nil {
+        return *col
+    }
+    result := Column{Signature: col.Signature}
+    if col.nulls != nil {
+        result.nulls = gather(col.nulls, col.rows)
+    }
+    result.Data = col.Data.Gather(col.rows)
+    return result
+}
+
+func (rel *Relation) Scan(colList []AttrInfo) Relationer {
+	return rel.plan().Scan(colList)
 }
 
 func (rel *Relation) Select(col AttrInfo, comp Comparison, compVal interface{}) Relationer {
-	relevantCol := rel.findColumn(col)
-
-	rs := new(Relation)
-	rs.Name = "select from " + rel.Name
-	// gets the columns for the created relation
-	if rel.columns()[relevantCol].isInt() {
-		rs.Columns = getRelevantRows(comp, asInt(compVal), rel.columns(), relevantCol)
-	} else if rel.columns()[relevantCol].isFloat() {
-		rs.Columns = getRelevantRows(comp, asFloat(compVal), rel.columns(), relevantCol)
-	} else if rel.columns()[relevantCol].isString() {
-		rs.Columns = getRelevantRows(comp, asString(compVal), rel.columns(), relevantCol)
-	} else {
-		return nil // unknown type
-	}
+	return rel.SelectWhere(Compare(col, comp, compVal))
+}
 
-	return rs
+func (rel *Relation) SelectWhere(pred Predicate) Relationer {
+	return rel.plan().SelectWhere(pred)
+}
+
+func (rel *Relation) Project(exprs []NamedExpr) Relationer {
+	return rel.plan().Project(exprs)
+}
+
+func (rel *Relation) ProjectChecked(exprs []NamedExpr) (Relationer, error) {
+	return rel.plan().ProjectChecked(exprs)
 }
 
 func (rel *Relation) Print() {
+	rel = rel.snapshot().live()
 	// create configs for the table
 	configs := make([]table.ColumnConfig, len(rel.Columns))
 	for i := range configs {
@@ -111,30 +207,16 @@ func (rel *Relation) Print() {
 	t.Render()
 }
 
-func (rel *Relation) MakeIndex(indexCol AttrInfo) Relationer {
-	colIdx := rel.findColumn(indexCol)
+func (rel *Relation) MakeIndex(indexCol AttrInfo, kind ...IndexKind) Relationer {
+	rel.lockForWrite()
+	defer rel.unlockAfterChange()
+	colIdx := findColumnIn(rel.Columns, indexCol)
 
     if colIdx == -1 {
         error_("Unknown column name ", indexCol.Name)
     }
 
-    if !rel.columns()[colIdx].CreateIndex() {
-        return rel
-    }
-
-
-    for i := 0; i < rel.rowCount(); i++ {
-		if rel.columns()[colIdx].isInt() {
-            data := rel.Columns[colIdx].intAt(i)
-            rel.Columns[colIdx].IndexInsert(data, i)
-		} else if rel.columns()[colIdx].isFloat() {
-            data := rel.Columns[colIdx].floatAt(i)
-            rel.Columns[colIdx].IndexInsert(data, i)
-		} else if rel.columns()[colIdx].isString() {
-            data := rel.Columns[colIdx].stringAt(i)
-            rel.Columns[colIdx].IndexInsert(data, i)
-		}
-    }
+    rel.ensureIndex(colIdx, indexKind(kind))
 	return rel
 }
 
@@ -145,62 +227,66 @@ func (rel *Relation) IndexScan(col AttrInfo, key interface{}) Relationer {
         error_("Unknown column name ", col.Name)
     }
 
-    rel.Columns[colIdx].CreateIndex()
+	return &Plan{root: &indexScanNode{child: rel.plan().root, pred: Compare(col, EQ, key)}}
+}
 
-    result := new(Relation)
-    result.Name = "IndexScan on " + rel.Name
-    result.Columns = make([]Column, len(rel.Columns))
-    for i := range result.Columns {
-        result.Columns[i].Signature = rel.columns()[i].Signature
-        if result.Columns[i].isInt() {
-            result.Columns[i].Data = make([]int, 0)
-        } else if result.Columns[i].isFloat() {
-            result.Columns[i].Data = make([]float64, 0)
-        } else if result.Columns[i].isString() {
-            result.Columns[i].Data = make([]string, 0)
-        }
-    }
+func (rel *Relation) IndexScanWhere(pred Predicate) Relationer {
+	return rel.plan().IndexScanWhere(pred)
+}
 
-    for _, rowIdx := range rel.Columns[colIdx].IndexLookup(key) {
-        for i := 0; i < len(result.Columns); i++ {
-            if rel.columns()[i].isInt() {
-                result.Columns[i].Data = append(result.Columns[i].Data.([]int), rel.Columns[i].intAt(rowIdx))
-            } else if rel.columns()[i].isFloat() {
-                result.Columns[i].Data = append(result.Columns[i].Data.([]float64), rel.Columns[i].floatAt(rowIdx))
-            } else if rel.columns()[i].isString() {
-                result.Columns[i].Data = append(result.Columns[i].Data.([]string), rel.Columns[i].stringAt(rowIdx))
-            }
-        }
-    }
+func (rel *Relation) OrderBy(col AttrInfo, descending bool) Relationer {
+	return rel.plan().OrderBy(col, descending)
+}
 
-	return result
+func (rel *Relation) Collate(col AttrInfo, coll Collation) Relationer {
+	return rel.plan().Collate(col, coll)
+}
+
+func (rel *Relation) SetCollation(col AttrInfo, coll Collation) Relationer {
+	rel.lockForWrite()
+	defer rel.unlockAfterChange()
+	colIdx := columnIndex(rel.Columns, col)
+	if !rel.Columns[colIdx].isString() {
+		error_("Collations are only supported for strings, '%s' is not a string column.", col.Name)
+	}
+	collationKey(coll) // exits for unknown collations
+
+	rel.logChange(walRecord{Kind: walCollate, Column: col.Name, Collation: coll})
+	rel.collate(colIdx, coll)
+	return rel
+}
+
+func (rel *Relation) Materialize() Relationer {
+	return rel
+}
+
+func (rel *Relation) Export(csvFile string, separator rune) {
+	export(rel.Iterator(), csvFile, separator)
+}
+
+func (rel *Relation) Iterator() Iterator {
+	return &relationIterator{rel: rel.snapshot()}
 }
 
 func (rel *Relation) columns() []Column {
+	rel.mu.RLock()
+	defer rel.mu.RUnlock()
 	return rel.Columns
 }
 
 // Returns the index of the column with the passed name.
 func (rel *Relation) findColumn(attr AttrInfo) int {
-	for idx, col := range rel.Columns {
-		if col.Signature.Name == attr.Name {
-			return idx
-		}
-	}
-	return -1
+	return findColumnIn(rel.columns(), attr)
 }
 
 func (rel *Relation) rowCount() int {
-	if rel.Columns[0].isInt() {
-		return len(rel.Columns[0].Data.([]int))
-	} else if rel.Columns[0].isFloat() {
-		return len(rel.Columns[0].Data.([]float64))
-	} else if rel.Columns[0].isString() {
-		return len(rel.Columns[0].Data.([]string))
-	} else {
-        error_("Unknown or unset column type.")
-        return -1 // Dead code ...
-    }
+	rel.mu.RLock()
+	defer rel.mu.RUnlock()
+	return rel.length()
+}
+
+func (rel *Relation) schema() []AttrInfo {
+	return signatures(rel.columns())
 }
 
 /*
@@ -209,6 +295,52 @@ Relation intern helper functions
 -------------------------------------------------
 */
 
+// Returns a plan reading the relation, the operators of the relation are recorded on top of it.
+func (rel *Relation) plan() *Plan {
+	return &Plan{root: planOf(rel)}
+}
+
+// Returns a copy of the relation sharing its columns, statistics, indexes, deleted rows and delta.
+// Changes of the relation replace them, so the snapshot is not changed by them.
+func (rel *Relation) snapshot() *Relation {
+	rel.mu.RLock()
+	defer rel.mu.RUnlock()
+	return &Relation{
+		Name: rel.Name, Columns: rel.Columns, stats: rel.stats, indexes: copyIndexes(rel.indexes), source: rel,
+		deleted: rel.deleted, delta: rel.delta, lsn: rel.lsn,
+	}
+}
+
+// Locks the relation for a change and copies its columns, the changes are made on the copies
+// so the snapshots of running queries keep their columns. A running merge of the delta is made
+// again on the new columns. Changes of the rows only replace the delta and the deleted rows and
+// lock the relation without copying its columns. The caller unlocks the relation.
+func (rel *Relation) lockForWrite() {
+	rel.mu.Lock()
+	rel.Columns = append(make([]Column, 0, len(rel.Columns)), rel.Columns...)
+}
+
+// Sets the collation of the column and builds its indexes again with the sort keys of the
+// collation. The relation has to be locked for writing.
+func (rel *Relation) collate(colIdx int, coll Collation) {
+	rel.Columns[colIdx].Signature.Collation = coll
+	if rel.delta != nil {
+		rel.delta = append([]Column{}, rel.delta...)
+		rel.delta[colIdx].Signature.Collation = coll
+	}
+	rel.rebuildIndexes(colIdx)
+}
+
+// Returns the index of the column with the passed name inside the columns or -1.
+func findColumnIn(cols []Column, attr AttrInfo) int {
+	for idx, col := range cols {
+		if col.Signature.Name == attr.Name {
+			return idx
+		}
+	}
+	return -1
+}
+
 // Helper for getting the column names
 func (rel *Relation) getHeader() table.Row {
 	header := make(table.Row, len(rel.Columns))
@@ -237,15 +369,11 @@ func (rel *Relation) getRows() []table.Row {
 		row := make(table.Row, col_nums)
 		// iterate over each column and get the entry at the current row
 		for j, col := range rel.Columns {
-			if col.isInt() {
-				row[j] = col.intAt(i)
-			} else if col.isFloat() {
-				row[j] = col.floatAt(i)
-			} else if col.isString() {
-				row[j] = col.stringAt(i)
+			if col.isNull(i) {
+				row[j] = "NULL"
 			} else {
-                error_("Unknown or unset column type.")
-            }
+				row[j] = col.valueAt(i)
+			}
 		}
 		rows[i] = row
 	}
@@ -0,0 +1,457 @@
+package core
+
+/*
+	Statistics describe the values of the columns of a relation. They are collected when a
+	relation is loaded or analyzed and used by the cost model to estimate the selectivity of
+	predicates and the size of joins. Small columns count their distinct values exactly, larger
+	ones estimate them with a HyperLogLog sketch in a single pass. An equi-depth histogram
+	describes the distribution of the values for range predicates and the most common values
+	improve the estimates of equality predicates on skewed columns, for larger columns both are
+	taken from a sample of the values.
+*/
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+const (
+	exactDistinctRows = 10000 // columns with more values estimate their distinct values
+	histogramBuckets  = 10
+	mostCommonValues  = 5
+	hllPrecision      = 14 // the sketches have 2^hllPrecision registers
+)
+
+// The statistics of the values of a column. The values are compared in byte order.
+type columnStats struct {
+	rows       int
+	nulls      int
+	min        interface{} // nil if all values are NULL
+	max        interface{}
+	distinct   float64
+	exact      bool          // the distinct values are counted instead of estimated
+	bounds     []interface{} // the upper bounds of the histogram buckets, every bucket has the same number of values
+	mostCommon []valueCount  // sorted by descending count
+}
+
+// A value of a column and the number of its occurrences.
+type valueCount struct {
+	value interface{}
+	count int
+}
+
+// A HyperLogLog sketch estimating the number of distinct hashed values.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+/*
+	Collects the statistics of all columns and returns them as a relation with one row per
+	column. The optimizer uses them until the relation is analyzed again.
+*/
+func (rel *Relation) Analyze() Relationer {
+	rel.lockForWrite()
+	defer rel.mu.Unlock()
+	rel.analyze()
+
+	sigs := []AttrInfo{
+		{Name: "Column", Type: STRING},
+		{Name: "Type", Type: STRING},
+		{Name: "Rows", Type: INT},
+		{Name: "Nulls", Type: INT},
+		{Name: "Min", Type: STRING},
+		{Name: "Max", Type: STRING},
+		{Name: "Distinct", Type: INT},
+		{Name: "Exact", Type: STRING},
+		{Name: "Histogram", Type: STRING},
+		{Name: "MostCommon", Type: STRING},
+	}
+	result := &Relation{Name: "statistics of " + rel.Name, Columns: make([]Column, len(sigs))}
+	for i, sig := range sigs {
+		result.Columns[i] = Column{Signature: sig, Data: newColumnData(sig.Type, len(rel.Columns))}
+	}
+	for row, col := range rel.Columns {
+		stats := rel.stats[col.Signature.Name]
+		values := []interface{}{
+			col.Signature.Name, col.Signature.Type.String(), stats.rows, stats.nulls, stats.min, stats.max,
+			int(math.Round(stats.distinct)), fmt.Sprint(stats.exact), formatValues(stats.bounds), formatValueCounts(stats.mostCommon),
+		}
+		for i, value := range values {
+			if value == nil {
+				// columns without values have no minimum and maximum
+				result.Columns[i].setNull(row, len(rel.Columns))
+			} else if sigs[i].Type == STRING {
+				result.Columns[i].Data.Set(row, formatValue(value))
+			} else {
+				result.Columns[i].Data.Set(row, value)
+			}
+		}
+	}
+	return result
+}
+
+func (p *Plan) Analyze() Relationer {
+	return p.materialized().Analyze()
+}
+
+// Collects the statistics and builds the zone maps of all columns of the relation.
+func (rel *Relation) analyze() {
+	rel.collectStats()
+	rel.buildZones()
+}
+
+// Collects the statistics of all columns of the relation.
+func (rel *Relation) collectStats() {
+	rel.stats = make(map[string]*columnStats, len(rel.Columns))
+	// deleted rows are left out
+	for _, col := range rel.live().Columns {
+		dense := col.materialize()
+		rel.stats[col.Signature.Name] = dense.Data.statistics(dense.nulls)
+	}
+}
+
+// Collects the statistics of the values. NULL values are only counted. Larger columns are read
+// once without sorting them, a HyperLogLog sketch estimates their distinct values and the
+// histogram and the most common values are taken from a sample of the values.
+func collectStats[T Value](data []T, nulls []bool) *columnStats {
+	stats := &columnStats{rows: len(data)}
+	for i := range data {
+		if nulls != nil && nulls[i] {
+			stats.nulls++
+		}
+	}
+	values := len(data) - stats.nulls
+	if values <= exactDistinctRows {
+		sorted := make([]T, 0, values)
+		for i, val := range data {
+			if nulls == nil || !nulls[i] {
+				sorted = append(sorted, val)
+			}
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		counts := countSorted(sorted)
+		stats.distinct, stats.exact = float64(len(counts)), true
+		if len(sorted) > 0 {
+			stats.min, stats.max = sorted[0], sorted[len(sorted)-1]
+			describeValues(stats, sorted, counts, 1)
+		}
+		return stats
+	}
+
+	sketch := newHyperLogLog()
+	hash := statsHash[T]()
+	// every step-th value is sampled on average, the rows are chosen by their hashed position,
+	// so periodic values are sampled evenly
+	step := uint64((values + exactDistinctRows - 1) / exactDistinctRows)
+	sample := make([]T, 0, exactDistinctRows)
+	var min, max T
+	seen := 0
+	for i, val := range data {
+		if nulls != nil && nulls[i] {
+			continue
+		}
+		if seen == 0 || val < min {
+			min = val
+		}
+		if seen == 0 || val > max {
+			max = val
+		}
+		if mix64(uint64(i))%step == 0 {
+			sample = append(sample, val)
+		}
+		seen++
+		sketch.add(hash(val))
+	}
+	stats.min, stats.max, stats.distinct = min, max, sketch.estimate()
+	if len(sample) == 0 {
+		return stats
+	}
+	sort.Slice(sample, func(i, j int) bool { return sample[i] < sample[j] })
+	describeValues(stats, sample, countSorted(sample), float64(values)/float64(len(sample)))
+	// the last bucket ends at the maximum, also if it is not sampled
+	stats.bounds[len(stats.bounds)-1] = max
+	return stats
+}
+
+// Returns the distinct values of the sorted values with their number of occurrences.
+func countSorted[T Value](sorted []T) []valueCount {
+	// equal values are next to each other after sorting
+	counts := make([]valueCount, 0)
+	for i, val := range sorted {
+		if i == 0 || val != sorted[i-1] {
+			counts = append(counts, valueCount{value: val})
+		}
+		counts[len(counts)-1].count++
+	}
+	return counts
+}
+
+// Sets the histogram and the most common values from the sorted values and their counts. The
+// counts are multiplied by the scale, so a sample describes all values of the column.
+func describeValues[T Value](stats *columnStats, sorted []T, counts []valueCount, scale float64) {
+	buckets := minimum(histogramBuckets, len(sorted))
+	for b := 1; b <= buckets; b++ {
+		stats.bounds = append(stats.bounds, sorted[b*len(sorted)/buckets-1])
+	}
+
+	// values occurring once are not more common than the others
+	sort.SliceStable(counts, func(i, j int) bool { return counts[i].count > counts[j].count })
+	for _, entry := range counts {
+		if len(stats.mostCommon) == mostCommonValues || entry.count < 2 {
+			break
+		}
+		entry.count = int(math.Round(float64(entry.count) * scale))
+		stats.mostCommon = append(stats.mostCommon, entry)
+	}
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// Adds a hashed value. The first bits choose the register, which keeps the highest position of
+// the first set bit of the remaining bits.
+func (h *hyperLogLog) add(hash uint64) {
+	register := hash >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[register] {
+		h.registers[register] = rank
+	}
+}
+
+// Returns the estimated number of distinct values, small numbers are estimated by linear counting.
+func (h *hyperLogLog) estimate() float64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, rank := range h.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return estimate
+}
+
+// Returns a 64 bit hash function for values of the passed type whose bits are evenly distributed.
+func statsHash[T Value]() func(T) uint64 {
+	return typeOf[T]().statsHash
+}
+
+// The finalizer of splitmix64, every bit of the input changes half of the output bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+/*
+-------------------------------------------------
+Estimates from statistics
+-------------------------------------------------
+*/
+
+// Returns the statistics of the column produced by the node or nil if there are none.
+func columnStatsOf(node planNode, attr AttrInfo) *columnStats {
+	switch n := node.(type) {
+	case *relationNode:
+		idx := n.rel.findColumn(attr)
+		// the statistics compare the values in byte order
+		if idx == -1 || n.rel.Columns[idx].Signature.Collation != BINARY {
+			return nil
+		}
+		return n.rel.stats[n.rel.Columns[idx].Signature.Name]
+	case *selectNode:
+		return columnStatsOf(n.child, attr)
+	case *scanNode:
+		return columnStatsOf(n.child, attr)
+	case *orderByNode:
+		return columnStatsOf(n.child, attr)
+	case *makeIndexNode:
+		return columnStatsOf(n.child, attr)
+	case *indexScanNode:
+		return columnStatsOf(n.child, attr)
+	case *collateNode:
+		if n.col.Name == attr.Name {
+			return nil
+		}
+		return columnStatsOf(n.child, attr)
+	case *projectNode:
+		for _, named := range n.exprs {
+			if named.Name != attr.Name {
+				continue
+			}
+			// computed columns have no statistics
+			if ref, ok := named.Expr.(*columnExpr); ok {
+				return columnStatsOf(n.child, ref.col)
+			}
+			return nil
+		}
+	case *joinNode, *multiJoinNode:
+		idx := findAttr(node.schema(), attr)
+		if idx == -1 {
+			return nil
+		}
+		// the columns of the inputs keep their positions, but may be renamed
+		for _, input := range planInputs(node) {
+			schema := input.schema()
+			if idx < len(schema) {
+				return columnStatsOf(input, schema[idx])
+			}
+			idx -= len(schema)
+		}
+	}
+	return nil
+}
+
+// Returns the estimated fraction of the rows of the node meeting the comparison with the value.
+// Returns false if the column has no statistics or the value can not be compared.
+func (s *columnStats) compareFraction(comp Comparison, value interface{}) (float64, bool) {
+	if s.rows == 0 {
+		return 0, true
+	}
+	if s.min == nil {
+		// only NULL values, which never meet a comparison
+		return 0, true
+	}
+	if _, ok := compareValues(s.min, value); !ok {
+		return 0, false
+	}
+	nonNull := float64(s.rows-s.nulls) / float64(s.rows)
+	equal := s.equalFraction(value)
+	var fraction float64
+	switch comp {
+	case EQ:
+		fraction = equal
+	case NEQ:
+		fraction = 1 - equal
+	case LT:
+		fraction = s.fractionBelow(value)
+	case LE:
+		fraction = s.fractionBelow(value) + equal
+	case GT:
+		fraction = 1 - s.fractionBelow(value) - equal
+	case GE:
+		fraction = 1 - s.fractionBelow(value)
+	default:
+		return 0, false
+	}
+	return math.Max(0, math.Min(1, fraction)) * nonNull, true
+}
+
+// Returns the estimated fraction of the non NULL values equal to the value.
+func (s *columnStats) equalFraction(value interface{}) float64 {
+	nonNull := float64(s.rows - s.nulls)
+	if lower, _ := compareValues(value, s.min); lower < 0 {
+		return 0
+	}
+	if higher, _ := compareValues(value, s.max); higher > 0 {
+		return 0
+	}
+	common := 0
+	for _, entry := range s.mostCommon {
+		if cmp, _ := compareValues(entry.value, value); cmp == 0 {
+			return float64(entry.count) / nonNull
+		}
+		common += entry.count
+	}
+	// the other values are expected to occur equally often
+	others := s.distinct - float64(len(s.mostCommon))
+	if others < 1 {
+		return 0
+	}
+	return (nonNull - float64(common)) / others / nonNull
+}
+
+// Returns the estimated fraction of the non NULL values lower than the value. Inside a bucket of
+// the histogram the values are expected to be evenly distributed.
+func (s *columnStats) fractionBelow(value interface{}) float64 {
+	if cmp, _ := compareValues(value, s.min); cmp <= 0 {
+		return 0
+	}
+	if cmp, _ := compareValues(value, s.max); cmp > 0 {
+		return 1
+	}
+	buckets := len(s.bounds)
+	b := sort.Search(buckets, func(i int) bool {
+		cmp, _ := compareValues(s.bounds[i], value)
+		return cmp >= 0
+	})
+	lower := s.min
+	if b > 0 {
+		lower = s.bounds[b-1]
+	}
+	within := 0.5
+	lo, lok := numericValue(lower)
+	hi, hok := numericValue(s.bounds[b])
+	val, _ := numericValue(value)
+	if lok && hok && hi > lo {
+		within = (val - lo) / (hi - lo)
+	}
+	return (float64(b) + within) / float64(buckets)
+}
+
+// Returns the estimated number of distinct values of the column, at most the number of rows.
+func (s *columnStats) distinctValues(rows float64) float64 {
+	return math.Max(1, math.Min(s.distinct, rows))
+}
+
+// Compares two values of a column in byte order, ints and floats are compared as numbers. Returns
+// false if the values can not be compared.
+func compareValues(a, b interface{}) (int, bool) {
+	if x, ok := numericValue(a); ok {
+		y, ok := numericValue(b)
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	x, xok := a.(string)
+	y, yok := b.(string)
+	if !xok || !yok {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+// Returns the value as float if it is a number.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// Returns the comma separated values.
+func formatValues(values []interface{}) string {
+	texts := make([]string, len(values))
+	for i, value := range values {
+		texts[i] = formatValue(value)
+	}
+	return strings.Join(texts, ", ")
+}
+
+// Returns the comma separated values with their counts.
+func formatValueCounts(counts []valueCount) string {
+	texts := make([]string, len(counts))
+	for i, entry := range counts {
+		texts[i] = fmt.Sprintf("%s (%d)", formatValue(entry.value), entry.count)
+	}
+	return strings.Join(texts, ", ")
+}
@@ -0,0 +1,425 @@
+package core
+
+/*
+	The on-disk format of the Column Store. Save writes every relation into its own file inside
+	a directory, Open reads them back. A relation file contains the data, the NULL marks and the
+	zone maps of the columns as well as the indexes of the catalog, so opened relations can use
+	their indexes immediately instead of building them again. Every index records the version
+	of its format and the checksum of the column data it was built on. Indexes with another
+	version or checksum are stale and are rebuilt when the relation is opened. The statistics
+	are collected again from the opened data. Opening a directory also starts the write-ahead
+	log of the store, see core_wal.go.
+*/
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"hash/fnv"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// The version of the format of relation files.
+const storageVersion = 1
+
+// The version of the format of stored indexes, stored indexes of other versions are rebuilt.
+const indexFormatVersion = 1
+
+// The file extension of relation files.
+const relationFileExt = ".rel"
+
+// The contents of a relation file.
+type storedRelation struct {
+	Version int
+	Name    string
+	Columns []storedColumn
+	Indexes []storedIndex
+	// The deleted rows that are not removed by a compaction yet.
+	Deleted []int
+	// The LSN of the last change contained in the file, later changes are replayed from the log.
+	LSN int64
+}
+
+// The data of a column, only the slice of the type of the column is set.
+type storedColumn struct {
+	Signature AttrInfo
+	Ints      []int
+	Floats    []float64
+	Strings   []string
+	Nulls     []bool
+	Zones     []storedZone
+}
+
+type storedZone struct {
+	Min   interface{}
+	Max   interface{}
+	Nulls int
+	Rows  int
+}
+
+// An index of the catalog. Only the fields of the kind of the index are set.
+type storedIndex struct {
+	Name     string
+	Column   string
+	Kind     IndexKind
+	Version  int
+	Checksum uint64 // the checksum of the column data when the index was saved
+	// HASH: the keys and their rows
+	Keys [][]int
+	// ORDERED: the rows in the order of their values
+	Ordered []int
+	// BITMAP: the keys with their bitmaps and the bitmap of the NULL rows
+	Bitmaps []storedBitmap
+	Nulls   storedBitmap
+	// The keys of HASH and BITMAP indexes in the order of Keys and Bitmaps
+	KeyValues []interface{}
+	// FULLTEXT: the tokenizer, the tokens with their posting lists and the number of indexed rows
+	Tokenizer Tokenizer
+	Tokens    []string
+	Postings  []storedPostings
+	Rows      int
+}
+
+// The rows of a token and the positions of the token inside every row.
+type storedPostings struct {
+	Rows      []int
+	Positions [][]int
+}
+
+// The chunks of a bitmap, every chunk is either stored as array or as bitset.
+type storedBitmap struct {
+	Keys   []uint32
+	Arrays [][]uint16
+	Bits   [][]uint64
+}
+
+/*
+	Writes all relations of the store into the directory, one file per relation. Existing files
+	of relations with the same names are replaced. Saving into the opened directory of the
+	store writes a checkpoint, which also removes the saved changes from the log.
+*/
+func (cs *ColumnStore) Save(dir string) {
+	checkError(os.MkdirAll(dir, 0755))
+	cs.mu.RLock()
+	log := cs.log
+	relations := make([]*Relation, 0, len(cs.relations))
+	for _, rel := range cs.relations {
+		relations = append(relations, rel.(*Relation))
+	}
+	cs.mu.RUnlock()
+	if log != nil && filepath.Clean(log.dir) == filepath.Clean(dir) {
+		log.checkpointing.Lock()
+		defer log.checkpointing.Unlock()
+		log.checkpoint()
+		return
+	}
+	for _, rel := range relations {
+		saveRelation(rel, dir, nil)
+	}
+}
+
+/*
+	Reads all relations saved in the directory into the store and replays the changes logged
+	after they were saved, so a crash loses no completed change. Relations with the same names
+	are replaced. Stale indexes are rebuilt.
+	From then on the changes of the relations of the store are logged in the directory, the
+	other relations of the store are added to it. The directory is created if it does not exist.
+*/
+func (cs *ColumnStore) Open(dir string) {
+	checkError(os.MkdirAll(dir, 0755))
+	removeTempFiles(dir)
+	files, err := filepath.Glob(filepath.Join(dir, "*"+relationFileExt))
+	checkError(err)
+	opened := make(map[string]*Relation, len(files))
+	for _, file := range files {
+		rel := openRelation(file)
+		opened[rel.Name] = rel
+	}
+
+	log, records := openLog(cs, dir)
+	replayed := make(map[*Relation]bool)
+	for _, rec := range records {
+		if rec.LSN >= log.nextLSN {
+			log.nextLSN = rec.LSN + 1
+		}
+		for _, change := range rec.changes() {
+			rel := opened[change.Relation]
+			switch {
+			case change.Kind == walCreate:
+				if rel == nil || rel.lsn < change.LSN {
+					rel = change.Created.relation()
+					rel.lsn = change.LSN
+					opened[change.Relation] = rel
+				}
+			case rel == nil:
+				error_("The log of '%s' changes the unknown relation '%s'.", dir, change.Relation)
+			case rel.lsn < change.LSN:
+				rel.replay(change)
+				replayed[rel] = true
+			}
+		}
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.relations == nil {
+		cs.relations = make(map[string]Relationer)
+	}
+	if cs.log != nil {
+		cs.log.file.Close()
+	}
+	cs.log = log
+	for name, rel := range opened {
+		if replayed[rel] {
+			// the statistics are collected from the replayed rows
+			rel.mergeDelta()
+			rel.collectStats()
+		}
+		if rel.lsn >= log.nextLSN {
+			log.nextLSN = rel.lsn + 1
+		}
+		if old, ok := cs.relations[name]; ok {
+			old.(*Relation).detach()
+		}
+		rel.log = log
+		rel.track(cs.historyLocked())
+		cs.relations[name] = rel
+	}
+	for name, r := range cs.relations {
+		if _, ok := opened[name]; !ok {
+			r.(*Relation).attach(log)
+		}
+	}
+}
+
+/*
+-------------------------------------------------
+Storage intern helper functions
+-------------------------------------------------
+*/
+
+// Writes the relation into its file inside the directory through the log, which may be nil.
+// The file is replaced at once, so a failed write never leaves a partial file. Returns the LSN
+// of the last change contained in the file.
+func saveRelation(rel *Relation, dir string, log *writeAheadLog) int64 {
+	rel.mergeDelta()
+	rel = rel.snapshot()
+	var content bytes.Buffer
+	checkError(gob.NewEncoder(&content).Encode(storeRelation(rel)))
+	tmp := log.writeTemp(dir, content.Bytes())
+	defer os.Remove(tmp)
+	log.rename(tmp, relationFile(dir, rel.Name))
+	return rel.lsn
+}
+
+// Returns the stored form of the relation, which must not be changed meanwhile. Rows inserted
+// into the delta meanwhile are stored in the main columns.
+func storeRelation(rel *Relation) *storedRelation {
+	if len(rel.delta) > 0 {
+		rel = rel.merged(false)
+	}
+	stored := &storedRelation{Version: storageVersion, Name: rel.Name, LSN: rel.lsn}
+	for i := range rel.Columns {
+		stored.Columns = append(stored.Columns, storeColumn(rel.Columns[i].materialize()))
+	}
+	for _, info := range rel.indexes {
+		col := rel.Columns[findColumnIn(rel.Columns, AttrInfo{Name: info.column})]
+		stored.Indexes = append(stored.Indexes, storeIndex(info, col))
+	}
+	if rel.deleted != nil {
+		stored.Deleted = rel.deleted.rows()
+	}
+	return stored
+}
+
+// Reads the relation from the file and rebuilds its stale indexes.
+func openRelation(file string) *Relation {
+	f, err := os.Open(file)
+	checkError(err)
+	defer f.Close()
+	var stored storedRelation
+	checkError(gob.NewDecoder(f).Decode(&stored))
+	if stored.Version != storageVersion {
+		error_("The relation file '%s' has the unsupported version %d.", file, stored.Version)
+	}
+	return stored.relation()
+}
+
+// Returns the stored relation with its indexes, stale indexes are rebuilt.
+func (stored *storedRelation) relation() *Relation {
+	rel := &Relation{Name: stored.Name, Columns: make([]Column, len(stored.Columns)), ownsData: true, lsn: stored.LSN}
+	for i, sc := range stored.Columns {
+		rel.Columns[i] = sc.column()
+	}
+	rel.markDeleted(stored.Deleted)
+	rel.collectStats()
+	if len(rel.Columns) > 0 && len(rel.Columns[0].zones) != (rel.rowCount()+zoneBlockSize-1)/zoneBlockSize {
+		rel.buildZones()
+	}
+	for _, si := range stored.Indexes {
+		colIdx := rel.findColumn(AttrInfo{Name: si.Column})
+		if colIdx == -1 {
+			continue
+		}
+		col := &rel.Columns[colIdx]
+		info := &indexInfo{name: si.Name, column: si.Column, kind: si.Kind, rows: col.length(), tokenizer: si.Tokenizer}
+		if si.Version != indexFormatVersion || si.Checksum != col.checksum() {
+			// the data changed since the index was saved
+			col.clearIndex(si.Kind)
+			col.buildIndex(info)
+		} else {
+			si.restore(col)
+		}
+		rel.indexes = append(rel.indexes, info)
+	}
+	return rel
+}
+
+// Returns the path of the file of the relation. The name is escaped, since names of loaded
+// relations contain the path of their csv file.
+func relationFile(dir, name string) string {
+	return filepath.Join(dir, url.PathEscape(name)+relationFileExt)
+}
+
+func storeColumn(col Column) storedColumn {
+	sc := storedColumn{Signature: col.Signature, Nulls: col.nulls}
+	switch data := col.Data.(type) {
+	case *TypedColumn[int]:
+		sc.Ints = data.Values
+	case *TypedColumn[float64]:
+		sc.Floats = data.Values
+	case *TypedColumn[string]:
+		sc.Strings = data.Values
+	}
+	for _, z := range col.zones {
+		sc.Zones = append(sc.Zones, storedZone{Min: z.min, Max: z.max, Nulls: z.nulls, Rows: z.rows})
+	}
+	return sc
+}
+
+// Returns the column with the stored data.
+func (sc storedColumn) column() Column {
+	col := Column{Signature: sc.Signature, nulls: sc.Nulls}
+	switch sc.Signature.Type {
+	case INT:
+		col.Data = &TypedColumn[int]{Values: nonNil(sc.Ints)}
+	case FLOAT:
+		col.Data = &TypedColumn[float64]{Values: nonNil(sc.Floats)}
+	case STRING:
+		col.Data = &TypedColumn[string]{Values: nonNil(sc.Strings)}
+	}
+	for _, z := range sc.Zones {
+		col.zones = append(col.zones, zone{min: z.Min, max: z.Max, nulls: z.Nulls, rows: z.Rows})
+	}
+	return col
+}
+
+// Returns an empty slice instead of nil, gob decodes empty slices as nil.
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return make([]T, 0)
+	}
+	return values
+}
+
+func storeIndex(info *indexInfo, col Column) storedIndex {
+	si := storedIndex{Name: info.name, Column: info.column, Kind: info.kind, Version: indexFormatVersion, Checksum: col.checksum()}
+	switch info.kind {
+	case HASH:
+		for key, rows := range col.Index {
+			si.KeyValues = append(si.KeyValues, key)
+			si.Keys = append(si.Keys, rows)
+		}
+	case ORDERED:
+		si.Ordered = col.ordered.ordered()
+	case BITMAP:
+		for key, rows := range col.bitmaps.values {
+			si.KeyValues = append(si.KeyValues, key)
+			si.Bitmaps = append(si.Bitmaps, storeBitmap(rows))
+		}
+		si.Nulls = storeBitmap(col.bitmaps.nulls)
+	case FULLTEXT:
+		si.Tokenizer, si.Rows = info.tokenizer, col.fulltext.rows
+		for token, list := range col.fulltext.postings {
+			si.Tokens = append(si.Tokens, token)
+			si.Postings = append(si.Postings, storedPostings{Rows: list.rows, Positions: list.positions})
+		}
+	}
+	return si
+}
+
+// Sets the stored index on the column.
+func (si storedIndex) restore(col *Column) {
+	switch si.Kind {
+	case HASH:
+		col.Index = make(map[interface{}][]int, len(si.Keys))
+		for i, rows := range si.Keys {
+			col.Index[si.KeyValues[i]] = rows
+		}
+	case ORDERED:
+		dense := col.materialize()
+		col.ordered = dense.Data.keys(col.Signature.Collation).sortedIndex(nonNil(si.Ordered))
+	case BITMAP:
+		col.bitmaps = &bitmapIndex{values: make(map[interface{}]*bitmap, len(si.Bitmaps)), nulls: si.Nulls.bitmap()}
+		for i, rows := range si.Bitmaps {
+			col.bitmaps.values[si.KeyValues[i]] = rows.bitmap()
+		}
+	case FULLTEXT:
+		col.fulltext = &fulltextIndex{tokenizer: si.Tokenizer, postings: make(map[string]*postingList, len(si.Tokens)), rows: si.Rows}
+		for i, token := range si.Tokens {
+			col.fulltext.postings[token] = &postingList{rows: si.Postings[i].Rows, positions: si.Postings[i].Positions}
+		}
+	}
+}
+
+func storeBitmap(b *bitmap) storedBitmap {
+	sb := storedBitmap{Keys: b.keys}
+	for _, chunk := range b.chunks {
+		sb.Arrays = append(sb.Arrays, chunk.array)
+		sb.Bits = append(sb.Bits, chunk.bits)
+	}
+	return sb
+}
+
+// Returns the stored bitmap, chunks without bitset are arrays.
+func (sb storedBitmap) bitmap() *bitmap {
+	b := &bitmap{keys: sb.Keys}
+	for i := range sb.Keys {
+		chunk := &bitmapChunk{array: sb.Arrays[i]}
+		if len(sb.Bits[i]) > 0 {
+			chunk = &bitmapChunk{bits: sb.Bits[i]}
+		}
+		b.chunks = append(b.chunks, chunk.compact())
+	}
+	return b
+}
+
+// Returns the FNV-1a checksum of the values, the NULL marks and the collation of the column.
+func (col *Column) checksum() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(col.Signature.Collation))
+	var buf [8]byte
+	for i := 0; i < col.length(); i++ {
+		if col.isNull(i) {
+			h.Write([]byte{0})
+			continue
+		}
+		h.Write([]byte{1})
+		switch value := col.valueAt(i).(type) {
+		case int:
+			binary.LittleEndian.PutUint64(buf[:], uint64(value))
+			h.Write(buf[:])
+		case float64:
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(value))
+			h.Write(buf[:])
+		case string:
+			binary.LittleEndian.PutUint64(buf[:], uint64(len(value)))
+			h.Write(buf[:])
+			h.Write([]byte(value))
+		}
+	}
+	return h.Sum64()
+}
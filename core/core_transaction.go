@@ -0,0 +1,245 @@
+package core
+
+/*
+	Transactions with snapshot isolation. A transaction sees the relations of the store as they
+	were at its start: Begin takes a snapshot of every relation, later changes replace the
+	columns and delete bitmaps of the relations and leave the snapshots unchanged. The rows
+	changed by the transaction are only changed in its snapshots, where its own queries see them.
+
+	Commit writes the changes into the relations of the store at once. The rows of a relation
+	keep their positions while transactions see it, as it is only compacted when they ended, so
+	the rows deleted by the transaction are deleted at the same positions in the relation and
+	its inserted rows are appended. If another transaction or a change outside of transactions
+	deleted or updated one of the rows deleted or updated by the transaction since its start,
+	or the relation was replaced, the commit fails with a conflict and the transaction is rolled
+	back. Inserts never conflict.
+
+	The deleted rows are the older versions of the rows. They stay in the relations as long as
+	transactions started before their deletion run and are removed by the compaction afterwards.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/*
+	The error returned by Commit if a transaction changed rows that were changed by another
+	transaction after its start.
+*/
+var ErrConflict = errors.New("the transaction conflicts with a concurrent change")
+
+/*
+	A Transaction changes the rows of the relations of a store with snapshot isolation. It is
+	started by ColumnStore.Begin and ended by Commit or Rollback.
+*/
+type Transaction struct {
+	store *ColumnStore
+	// The relations of the store at the start of the transaction by their names.
+	relations map[string]*txRelation
+	// Guards the relations and the end of the transaction, so it can be shared by goroutines.
+	mu    sync.Mutex
+	ended bool
+}
+
+// A relation of the store as seen by a transaction.
+type txRelation struct {
+	// The relation of the store, it is not compacted until the transaction ended.
+	source *Relation
+	// The snapshot of the relation seen by the transaction, changed by its changes.
+	rel *Relation
+	// The number of rows and the deleted rows at the start of the transaction.
+	rows    int
+	deleted *bitmap
+}
+
+/*
+	Starts a transaction that sees the relations of the store as they are now. Relations created
+	later are not seen by it.
+*/
+func (cs *ColumnStore) Begin() *Transaction {
+	// commits are made completely before or after the snapshots are taken
+	cs.commitMu.RLock()
+	defer cs.commitMu.RUnlock()
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	tx := &Transaction{store: cs, relations: make(map[string]*txRelation, len(cs.relations))}
+	for name, r := range cs.relations {
+		source := r.(*Relation)
+		rel := source.pin()
+		tx.relations[name] = &txRelation{source: source, rel: rel, rows: rel.length(), deleted: rel.deleted}
+	}
+	return tx
+}
+
+/*
+	Returns the relation with the passed name as seen by the transaction. Its rows are changed by
+	Insert, InsertColumns, Update and Delete for the transaction only until it is committed.
+	Indexes and collations of the relation are changed for the transaction only and are not
+	committed.
+*/
+func (tx *Transaction) GetRelation(relName string) Relationer {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.checkRunning()
+	txRel, ok := tx.relations[relName]
+	if !ok {
+		error_("No relation with name '%s' in the transaction", relName)
+	}
+	return txRel.rel
+}
+
+/*
+	Writes the changes of the transaction into the relations of the store and ends it. Returns
+	an error wrapping ErrConflict if rows deleted or updated by the transaction were changed
+	since its start, then no change is written and the transaction is rolled back.
+*/
+func (tx *Transaction) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.checkRunning()
+	defer tx.end()
+	return tx.store.commit(tx.changed())
+}
+
+/*
+	Ends the transaction without writing its changes.
+*/
+func (tx *Transaction) Rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.checkRunning()
+	tx.end()
+}
+
+/*
+-------------------------------------------------
+Transaction intern helper functions
+-------------------------------------------------
+*/
+
+// Exits if the transaction already ended.
+func (tx *Transaction) checkRunning() {
+	if tx.ended {
+		error_("The transaction already ended.")
+	}
+}
+
+// Ends the transaction, the relations can be compacted again. The caller holds tx.mu.
+func (tx *Transaction) end() {
+	tx.ended = true
+	for _, txRel := range tx.relations {
+		txRel.source.unpin()
+	}
+}
+
+// Returns the relations changed by the transaction ordered by their names.
+func (tx *Transaction) changed() []*txRelation {
+	changed := make([]*txRelation, 0)
+	for _, txRel := range tx.relations {
+		txRel.rel.mu.RLock()
+		if txRel.rel.length() != txRel.rows || txRel.rel.deleted != txRel.deleted {
+			changed = append(changed, txRel)
+		}
+		txRel.rel.mu.RUnlock()
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].source.Name < changed[j].source.Name })
+	return changed
+}
+
+// Writes the changes of the relations into the relations of the store, which are locked in the
+// order of their names. Returns an error if a change conflicts. The checkpoint of a grown log
+// is written when the transaction ends.
+func (cs *ColumnStore) commit(changed []*txRelation) error {
+	if len(changed) == 0 {
+		return nil
+	}
+	cs.commitMu.Lock()
+	defer cs.commitMu.Unlock()
+	// relations are not replaced during the commit
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	for _, txRel := range changed {
+		if current, ok := cs.relations[txRel.source.Name]; !ok || current != txRel.source {
+			return fmt.Errorf("%w: the relation '%s' was replaced", ErrConflict, txRel.source.Name)
+		}
+	}
+
+	for _, txRel := range changed {
+		txRel.source.mu.Lock()
+		defer txRel.source.mu.Unlock()
+	}
+	changes := make([]walRecord, len(changed))
+	for i, txRel := range changed {
+		changes[i] = txRel.change()
+		for _, row := range changes[i].Rows {
+			if txRel.source.deleted != nil && txRel.source.deleted.contains(row) {
+				return fmt.Errorf("%w: rows of '%s' were changed by another transaction", ErrConflict, txRel.source.Name)
+			}
+		}
+	}
+
+	// one record, so a crash loses either all or no changes of the transaction
+	var lsn int64
+	if cs.log != nil {
+		lsn = cs.log.append(walRecord{Kind: walCommit, Changes: changes})
+	}
+	rels := make([]*Relation, len(changed))
+	for i, txRel := range changed {
+		txRel.source.replaceRows(changes[i].Rows, storedColumns(changes[i].Columns))
+		if cs.log != nil {
+			txRel.source.lsn = lsn
+		}
+		txRel.source.scheduleMerge()
+		rels[i] = txRel.source
+	}
+	// the changed relations are one version of the history
+	cs.history.record(rels...)
+	return nil
+}
+
+// Returns the change of the relation made by the transaction as UPDATE record: the rows it
+// deleted and the rows it inserted, updated rows are contained in both.
+func (txRel *txRelation) change() walRecord {
+	rel := txRel.rel
+	rel.mu.RLock()
+	defer rel.mu.RUnlock()
+	deleted := make([]int, 0)
+	if rel.deleted != nil {
+		for _, row := range rel.deleted.rows() {
+			if row < txRel.rows && (txRel.deleted == nil || !txRel.deleted.contains(row)) {
+				deleted = append(deleted, row)
+			}
+		}
+	}
+	inserted := make([]int, 0, rel.length()-txRel.rows)
+	for row := txRel.rows; row < rel.length(); row++ {
+		inserted = append(inserted, row)
+	}
+	cols := rel.gather(rel.withoutDeleted(inserted))
+	return walRecord{Kind: walUpdate, Relation: rel.Name, Rows: deleted, Columns: storeColumns(cols)}
+}
+
+// Returns a snapshot of the relation for a transaction. The relation is not compacted until
+// unpin is called, so the positions of the rows of the snapshot stay the positions of the
+// rows of the relation. The snapshot can be changed by the transaction, it is not compacted
+// either and builds its indexes on its own.
+func (rel *Relation) pin() *Relation {
+	rel.mu.Lock()
+	rel.pins++
+	rel.mu.Unlock()
+	snapshot := rel.snapshot()
+	snapshot.source = nil
+	snapshot.pins = 1
+	return snapshot
+}
+
+// Ends a transaction seeing the relation and compacts the relation if needed.
+func (rel *Relation) unpin() {
+	rel.mu.Lock()
+	defer rel.unlockAfterChange()
+	rel.pins--
+	rel.compactIfNeeded()
+}
@@ -0,0 +1,313 @@
+package core
+
+/*
+	The typed representation of the data of a column. Every operator is written once against
+	the generic TypedColumn and reaches it through the ColumnData interface. The behaviour that
+	depends on the Go type of the values, like casting, parsing and hashing, is registered once
+	per data type in dataTypes, so a new data type is added to the Value constraint and
+	dataTypes instead of a branch in every operator. Only the conversions of CAST between the
+	data types and the file format of stored relations name the data types themselves.
+*/
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+)
+
+/*
+	The Go types that can be stored inside a column.
+*/
+type Value interface {
+	int | float64 | string
+}
+
+/*
+	The ColumnData interface hides the type of the values of a column. The exported methods
+	give access to single values, the package intern methods run the typed kernels of the
+	operators.
+*/
+type ColumnData interface {
+	// Returns the data type of the values.
+	Type() DataTypes
+	// Returns the number of values.
+	Len() int
+	// Returns the i-th value.
+	At(i int) interface{}
+	// Sets the i-th value, the value has to be of the type of the column.
+	Set(i int, value interface{})
+	// Parses the textual representation of a value and sets it as the i-th value.
+	Parse(i int, text string) error
+	// Returns a new array containing the values at the passed positions.
+	Gather(positions []int) ColumnData
+
+	// Returns the data with strings replaced by their sort keys for the passed collation.
+	keys(coll Collation) ColumnData
+	// Appends the candidates whose value meets "value comp compVal" to out.
+	compare(comp Comparison, compVal interface{}, rows []int, nulls []bool, candidates []int, out []int) []int
+	// Appends the candidates whose value is one of the passed values to out.
+	in(values []interface{}, rows []int, nulls []bool, candidates []int, out []int) []int
+	// Appends the candidates where "value comp other value" is true to out. Both columns are dense.
+	compareColumns(comp Comparison, other ColumnData, candidates []int, out []int) []int
+	// Sorts the positions by the values of a column with the passed selection vector.
+	sortRows(positions []int, rows []int, descending bool)
+	// Joins all values with the values of the right data where "right comp left" is true.
+	nestedLoopJoin(comp Comparison, right ColumnData, lnulls, rnulls []bool, result *joinResult)
+	// Joins all values with the rows of the index of the right column.
+	indexNestedLoopJoin(comp Comparison, lnulls []bool, rcol Column, result *joinResult)
+	// Builds a hash table on the values, rows marked as NULL are left out.
+	hashTable(nulls []bool) joinTable
+	// Returns the data with the values of the other data appended.
+	appendAll(other ColumnData) ColumnData
+	// Collects the statistics of the values, the NULL marks may be nil.
+	statistics(nulls []bool) *columnStats
+	// Builds the zone map of the values, the NULL marks may be nil.
+	zoneMap(nulls []bool) []zone
+	// Builds an ordered index on the values, the NULL marks may be nil.
+	orderedIndex(nulls []bool) rangeIndex
+	// Returns the ordered index of the rows that are already sorted by their values.
+	sortedIndex(rows []int) rangeIndex
+}
+
+/*
+	The typed array of the values of a column.
+*/
+type TypedColumn[T Value] struct {
+	Values []T
+}
+
+// A data type independent of the Go type of its values.
+type dataType interface {
+	// Returns the data type.
+	dataType() DataTypes
+	// Returns the name of the data type.
+	name() string
+	// Creates an array with n values of the data type.
+	newData(n int) ColumnData
+	// Checks if the passed value has the Go type of the data type.
+	holds(value interface{}) bool
+	// Casts the passed value to the Go type of the data type and exits if the cast fails.
+	castAny(value interface{}) interface{}
+}
+
+// The behaviour of a data type with values of the Go type T.
+type valueType[T Value] struct {
+	type_ DataTypes
+	name_ string
+	// Casts a value and exits if the cast fails.
+	cast func(value interface{}) T
+	// Parses the textual representation of a value.
+	parse func(text string) (T, error)
+	// Hashes a value for hash joins, equal values have equal hashes.
+	hash func(value T) int
+	// Hashes a value for statistics, the bits of the hashes are evenly distributed.
+	statsHash func(value T) uint64
+}
+
+// The registered data types.
+var dataTypes = []dataType{
+	&valueType[int]{
+		type_: INT, name_: "INT", cast: asInt, parse: strconv.Atoi,
+		hash:      func(in int) int { return in },
+		statsHash: func(in int) uint64 { return mix64(uint64(in)) },
+	},
+	&valueType[float64]{
+		type_: FLOAT, name_: "FLOAT", cast: asFloat,
+		parse:     func(text string) (float64, error) { return strconv.ParseFloat(text, 64) },
+		hash:      func(in float64) int { return int(math.Round(in)) },
+		statsHash: func(in float64) uint64 { return mix64(math.Float64bits(in)) },
+	},
+	&valueType[string]{
+		type_: STRING, name_: "STRING", cast: asString,
+		parse:     func(text string) (string, error) { return text, nil },
+		hash:      func(in string) int { return int(hashString(in)) },
+		statsHash: func(in string) uint64 { return mix64(hashString(in)) },
+	},
+}
+
+func (t *valueType[T]) dataType() DataTypes {
+	return t.type_
+}
+
+func (t *valueType[T]) name() string {
+	return t.name_
+}
+
+func (t *valueType[T]) newData(n int) ColumnData {
+	return &TypedColumn[T]{Values: make([]T, n)}
+}
+
+func (t *valueType[T]) holds(value interface{}) bool {
+	_, ok := value.(T)
+	return ok
+}
+
+func (t *valueType[T]) castAny(value interface{}) interface{} {
+	return t.cast(value)
+}
+
+// Returns the registered data type of the values of the Go type T.
+func typeOf[T Value]() *valueType[T] {
+	for _, t := range dataTypes {
+		if vt, ok := t.(*valueType[T]); ok {
+			return vt
+		}
+	}
+	error_("The Go type %T is not registered as a data type.", *new(T))
+	return nil
+}
+
+// Returns the registered data type or nil if the data type is unknown.
+func lookupType(type_ DataTypes) dataType {
+	for _, t := range dataTypes {
+		if t.dataType() == type_ {
+			return t
+		}
+	}
+	return nil
+}
+
+// Returns the registered data type of the passed value or nil if it has no supported Go type.
+func typeOfValue(value interface{}) dataType {
+	for _, t := range dataTypes {
+		if t.holds(value) {
+			return t
+		}
+	}
+	return nil
+}
+
+// Returns the FNV-1a hash of the string.
+func hashString(in string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(in))
+	return h.Sum64()
+}
+
+/*
+	Creates a new column data array from the passed values.
+*/
+func NewTypedColumn[T Value](values []T) *TypedColumn[T] {
+	return &TypedColumn[T]{Values: values}
+}
+
+// Creates a new array with n values of the passed data type.
+func newColumnData(type_ DataTypes, n int) ColumnData {
+	t := lookupType(type_)
+	if t == nil {
+		error_("Unknown or unset column type.")
+	}
+	return t.newData(n)
+}
+
+// Returns the typed values of the column data.
+func values[T Value](data ColumnData) []T {
+	return data.(*TypedColumn[T]).Values
+}
+
+// Casts the passed value to the type T and exits if the cast fails.
+func castValue[T Value](value interface{}) T {
+	return typeOf[T]().cast(value)
+}
+
+func (c *TypedColumn[T]) Type() DataTypes {
+	return typeOf[T]().type_
+}
+
+func (c *TypedColumn[T]) Len() int {
+	return len(c.Values)
+}
+
+func (c *TypedColumn[T]) At(i int) interface{} {
+	return c.Values[i]
+}
+
+func (c *TypedColumn[T]) Set(i int, value interface{}) {
+	c.Values[i] = castValue[T](value)
+}
+
+func (c *TypedColumn[T]) Parse(i int, text string) error {
+	value, err := typeOf[T]().parse(text)
+	if err != nil {
+		return err
+	}
+	c.Values[i] = value
+	return nil
+}
+
+func (c *TypedColumn[T]) Gather(positions []int) ColumnData {
+	return &TypedColumn[T]{Values: gather(c.Values, positions)}
+}
+
+func (c *TypedColumn[T]) keys(coll Collation) ColumnData {
+	texts, ok := any(c.Values).([]string)
+	if !ok || coll == BINARY {
+		return c
+	}
+	key := collationKey(coll)
+	keys := make([]string, len(texts))
+	for i, elm := range texts {
+		keys[i] = key(elm)
+	}
+	return &TypedColumn[string]{Values: keys}
+}
+
+func (c *TypedColumn[T]) compare(comp Comparison, compVal interface{}, rows []int, nulls []bool, candidates []int, out []int) []int {
+	return compareKernel(comp, castValue[T](compVal), c.Values, rows, nulls, candidates, out)
+}
+
+func (c *TypedColumn[T]) in(values []interface{}, rows []int, nulls []bool, candidates []int, out []int) []int {
+	return predicateKernel(inSet(values, castValue[T]), c.Values, rows, nulls, candidates, out)
+}
+
+func (c *TypedColumn[T]) compareColumns(comp Comparison, other ColumnData, candidates []int, out []int) []int {
+	return compareColumnsKernel(comp, c.Values, values[T](other), candidates, out)
+}
+
+func (c *TypedColumn[T]) sortRows(positions []int, rows []int, descending bool) {
+	row := func(i int) int {
+		if rows == nil {
+			return i
+		}
+		return rows[i]
+	}
+	sort.SliceStable(positions, func(a, b int) bool {
+		if descending {
+			return c.Values[row(positions[a])] > c.Values[row(positions[b])]
+		}
+		return c.Values[row(positions[a])] < c.Values[row(positions[b])]
+	})
+}
+
+func (c *TypedColumn[T]) nestedLoopJoin(comp Comparison, right ColumnData, lnulls, rnulls []bool, result *joinResult) {
+	nestedLoopJoin(comp, c.Values, values[T](right), lnulls, rnulls, result)
+}
+
+func (c *TypedColumn[T]) indexNestedLoopJoin(comp Comparison, lnulls []bool, rcol Column, result *joinResult) {
+	indexNestedLoopJoin(comp, c.Values, lnulls, rcol, result)
+}
+
+func (c *TypedColumn[T]) hashTable(nulls []bool) joinTable {
+	return newHashTable(c.Values, nulls)
+}
+
+func (c *TypedColumn[T]) appendAll(other ColumnData) ColumnData {
+	return &TypedColumn[T]{Values: append(c.Values, values[T](other)...)}
+}
+
+func (c *TypedColumn[T]) statistics(nulls []bool) *columnStats {
+	return collectStats(c.Values, nulls)
+}
+
+func (c *TypedColumn[T]) zoneMap(nulls []bool) []zone {
+	return buildZones(c.Values, nulls)
+}
+
+func (c *TypedColumn[T]) orderedIndex(nulls []bool) rangeIndex {
+	return newOrderedIndex(c.Values, nulls)
+}
+
+func (c *TypedColumn[T]) sortedIndex(rows []int) rangeIndex {
+	return &orderedIndex[T]{keys: gather(c.Values, rows), rows: rows}
+}
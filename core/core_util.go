@@ -9,15 +9,12 @@ import (
 	"os"
 )
 
-// Creates a new array for the passed data type.
-func arrayForType(type_ DataTypes, len int) interface{} {
-	if type_ == INT {
-		return make([]int, len)
-	} else if type_ == FLOAT {
-		return make([]float64, len)
-	} else {
-		return make([]string, len)
+// Returns the name of the data type.
+func (type_ DataTypes) String() string {
+	if t := lookupType(type_); t != nil {
+		return t.name()
 	}
+	return "UNKNOWN"
 }
 
 // Returns a comparator function using the passed comparison with the passed value.
@@ -38,35 +35,71 @@ func comparator[T int | float64 | string](comp Comparison, compVal T) func(T) bo
 	return nil
 }
 
-func getRelevantRows[T int | string | float64](comp Comparison, cmpVal T, cols []Column, relCol int) []Column {
-	comparator := comparator(comp, cmpVal)  // function to compare the values
-	relevantData := cols[relCol].Data.([]T) // the data of the colum to use for selecting
-	resultCols := make([]Column, len(cols)) // the resulting (filtered) columns
-	// init the columns
-	for idx := range cols {
-		resultCols[idx].Signature = cols[idx].Signature
-		resultCols[idx].Data = arrayForType(cols[idx].Signature.Type, 0)
+// Returns the positions out of the candidates whose rows inside the passed column meet the condition.
+// The positions can be used as a selection vector for all columns of the same relation.
+func getRelevantRows(comp Comparison, cmpVal interface{}, col Column, candidates []int) []int {
+	return col.Data.compare(comp, cmpVal, col.rows, col.nulls, candidates, make([]int, 0, len(candidates)))
+}
+
+// Returns the positions out of the candidates whose rows inside the passed column match the predicate.
+// NULL values never match.
+func filterRows[T Value](col Column, candidates []int, predicate func(T) bool) []int {
+	return predicateKernel(predicate, values[T](col.Data), col.rows, col.nulls, candidates, make([]int, 0))
+}
+
+// Returns the positions out of the candidates where the comparison of the values of both columns is true.
+// The data arrays are the data of both columns or the sort keys of their strings.
+func getRelevantPairs(comp Comparison, left, right Column, leftData, rightData ColumnData, candidates []int) []int {
+	if left.rows != nil {
+		leftData = leftData.Gather(left.rows)
+	}
+	if right.rows != nil {
+		rightData = rightData.Gather(right.rows)
 	}
+	selection := leftData.compareColumns(comp, rightData, candidates, make([]int, 0))
+	if left.nulls != nil || right.nulls != nil {
+		selection = difference(selection, append(left.nullRows(selection), right.nullRows(selection)...))
+	}
+	return selection
+}
+
+// Returns the positions of all rows of a relation with the passed number of rows.
+func allRows(rowCount int) []int {
+	rows := make([]int, rowCount)
+	for i := range rows {
+		rows[i] = i
+	}
+	return rows
+}
 
-	for row, elm := range relevantData {
-		// checks for every element inside the relevant column whether it meets the condition
-		if comparator(elm) {
-			// if so -> copy the data inside this row
-			for col_idx, column := range cols {
-				if column.isInt() {
-					resultCols[col_idx].Data = append(resultCols[col_idx].Data.([]int), column.intAt(row))
-				} else if column.isFloat() {
-					resultCols[col_idx].Data = append(resultCols[col_idx].Data.([]float64), column.floatAt(row))
-				} else if column.isString() {
-					resultCols[col_idx].Data = append(resultCols[col_idx].Data.([]string), column.stringAt(row))
-				} else {
-                    error_("Unknown or unset column type.")
-                }
-			}
+// Creates views for all passed columns that only contain the rows at the passed positions.
+// The data of the columns is shared and not copied.
+func selectColumns(cols []Column, selection []int) []Column {
+	result := make([]Column, len(cols))
+	// columns sharing a selection vector also share the composed one
+	composed := make(map[*int][]int)
+	for i := range cols {
+		if len(cols[i].rows) == 0 {
+			result[i] = cols[i].view(selection)
+			continue
 		}
+		rows, ok := composed[&cols[i].rows[0]]
+		if !ok {
+			rows = cols[i].view(selection).rows
+			composed[&cols[i].rows[0]] = rows
+		}
+		result[i] = Column{Signature: cols[i].Signature, Data: cols[i].Data, rows: rows, nulls: cols[i].nulls}
 	}
+	return result
+}
 
-	return resultCols
+// Copies the elements at the passed positions into a new array.
+func gather[T any](data []T, positions []int) []T {
+	result := make([]T, len(positions))
+	for i, pos := range positions {
+		result[i] = data[pos]
+	}
+	return result
 }
 
 // Casts the passed value to an interger and exits if the cast fails.
@@ -129,6 +162,20 @@ func allMatch[T any](array []T, predicate func(T) bool) bool {
 	return true
 }
 
+func minimum(a, b int) int {
+    if a < b {
+        return a
+    }
+    return b
+}
+
+func maximum(a, b int) int {
+    if a > b {
+        return a
+    }
+    return b
+}
+
 func abs(x int) int {
     if x < 0 {
         return -x
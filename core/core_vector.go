@@ -0,0 +1,217 @@
+package core
+
+/*
+	Vectorized kernels used by the operators. The kernels process the rows in batches of
+	batchSize values and are specialised per type and per comparison, so the hot loops contain
+	neither type assertions nor switches on the comparison.
+*/
+
+// The number of values processed by a kernel at once.
+const batchSize = 1024
+
+// Returns the comparison with swapped operands, i.e. a comp b == b flip(comp) a.
+func flip(comp Comparison) Comparison {
+	switch comp {
+	case LT:
+		return GT
+	case GT:
+		return LT
+	case LE:
+		return GE
+	case GE:
+		return LE
+	}
+	return comp
+}
+
+// Appends the candidates whose value meets "value comp compVal" to out. The candidates are
+// positions of a column with the passed selection vector (nil for a dense column) and NULL marks.
+func compareKernel[T Value](comp Comparison, compVal T, data []T, rows []int, nulls []bool, candidates []int, out []int) []int {
+	return batched(candidates, rows, nulls, out, func(batch, phys []int, out []int) []int {
+		return compareBatch(comp, compVal, data, batch, phys, out)
+	})
+}
+
+// Appends the candidates whose value matches the predicate to out. Used for conditions that have
+// no specialised kernel, e.g., IN lists or patterns.
+func predicateKernel[T Value](predicate func(T) bool, data []T, rows []int, nulls []bool, candidates []int, out []int) []int {
+	return batched(candidates, rows, nulls, out, func(batch, phys []int, out []int) []int {
+		for k, p := range phys {
+			if predicate(data[p]) {
+				out = append(out, batch[k])
+			}
+		}
+		return out
+	})
+}
+
+// Splits the candidates into batches and translates every batch into positions inside the data
+// before passing it to the kernel. Candidates with NULL values are removed from the kernel output.
+func batched(candidates []int, rows []int, nulls []bool, out []int, kernel func(batch, phys []int, out []int) []int) []int {
+	var positions []int
+	if rows != nil {
+		positions = make([]int, minimum(batchSize, len(candidates)))
+	}
+	for start := 0; start < len(candidates); start += batchSize {
+		batch := candidates[start:minimum(start+batchSize, len(candidates))]
+		phys := batch
+		if rows != nil {
+			phys = positions[:len(batch)]
+			for k, pos := range batch {
+				phys[k] = rows[pos]
+			}
+		}
+
+		from := len(out)
+		out = kernel(batch, phys, out)
+		if nulls != nil {
+			out = append(out[:from], dropNulls(out[from:], rows, nulls)...)
+		}
+	}
+	return out
+}
+
+// Appends the positions of the batch whose value meets "value comp compVal" to out. The
+// positions inside the data are passed as phys.
+func compareBatch[T Value](comp Comparison, compVal T, data []T, batch, phys []int, out []int) []int {
+	switch comp {
+	case EQ:
+		for k, p := range phys {
+			if data[p] == compVal {
+				out = append(out, batch[k])
+			}
+		}
+	case NEQ:
+		for k, p := range phys {
+			if data[p] != compVal {
+				out = append(out, batch[k])
+			}
+		}
+	case LT:
+		for k, p := range phys {
+			if data[p] < compVal {
+				out = append(out, batch[k])
+			}
+		}
+	case GT:
+		for k, p := range phys {
+			if data[p] > compVal {
+				out = append(out, batch[k])
+			}
+		}
+	case LE:
+		for k, p := range phys {
+			if data[p] <= compVal {
+				out = append(out, batch[k])
+			}
+		}
+	case GE:
+		for k, p := range phys {
+			if data[p] >= compVal {
+				out = append(out, batch[k])
+			}
+		}
+	default:
+		error_("Unknown comparison '%s'.", comp)
+	}
+	return out
+}
+
+// Appends the candidates where "left comp right" is true for the values of both columns to out.
+func compareColumnsKernel[T Value](comp Comparison, left, right []T, candidates []int, out []int) []int {
+	switch comp {
+	case EQ:
+		for _, i := range candidates {
+			if left[i] == right[i] {
+				out = append(out, i)
+			}
+		}
+	case NEQ:
+		for _, i := range candidates {
+			if left[i] != right[i] {
+				out = append(out, i)
+			}
+		}
+	case LT:
+		for _, i := range candidates {
+			if left[i] < right[i] {
+				out = append(out, i)
+			}
+		}
+	case GT:
+		for _, i := range candidates {
+			if left[i] > right[i] {
+				out = append(out, i)
+			}
+		}
+	case LE:
+		for _, i := range candidates {
+			if left[i] <= right[i] {
+				out = append(out, i)
+			}
+		}
+	case GE:
+		for _, i := range candidates {
+			if left[i] >= right[i] {
+				out = append(out, i)
+			}
+		}
+	default:
+		error_("Unknown comparison '%s'.", comp)
+	}
+	return out
+}
+
+// Removes the positions whose rows are NULL, the array is filtered in place.
+func dropNulls(positions []int, rows []int, nulls []bool) []int {
+	result := positions[:0]
+	for _, pos := range positions {
+		p := pos
+		if rows != nil {
+			p = rows[pos]
+		}
+		if !nulls[p] {
+			result = append(result, pos)
+		}
+	}
+	return result
+}
+
+// Applies an arithmetic operator to all values of both arrays.
+func arithmeticKernel[T int | float64](op byte, left, right, out []T) {
+	switch op {
+	case '+':
+		for i := range out {
+			out[i] = left[i] + right[i]
+		}
+	case '-':
+		for i := range out {
+			out[i] = left[i] - right[i]
+		}
+	case '*':
+		for i := range out {
+			out[i] = left[i] * right[i]
+		}
+	case '/':
+		for i := range out {
+			if right[i] != 0 {
+				out[i] = left[i] / right[i]
+			}
+		}
+	}
+}
+
+// Returns the hash function for values of the passed type.
+func hashFunction[T Value]() func(T) int {
+	return typeOf[T]().hash
+}
+
+// Returns the dense values of a column, strings are replaced by their sort keys of the passed collation.
+func joinKeys(col Column, coll Collation) ColumnData {
+	return col.materialize().Data.keys(coll)
+}
+
+// Returns the dense NULL marks of a column or nil if it has no NULL values.
+func nullMarks(col Column) []bool {
+	return col.materialize().nulls
+}
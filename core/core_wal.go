@@ -0,0 +1,375 @@
+package core
+
+/*
+	The write-ahead log of a store directory. Once a directory is opened, every change of the
+	relations of the store is appended to the log and synced to disk before it is made: created
+	and loaded relations, inserted, updated and deleted rows, collations and created and dropped
+	indexes. Rows are logged with their positions, so replaying the changes in their order
+	gives the same relations as making them.
+
+	Every record has a log sequence number (LSN) and is framed by its length and checksum, a
+	record torn by a crash fails the checksum and ends the log. Checkpoints write all relations
+	into their files together with the LSN of their last change and drop the records contained
+	in the files from the log. Open reads the relation files and replays the records of the log
+	that are newer than the files, so a crash at any write leaves the store in the state after
+	the last completed change.
+*/
+
+import (
+	"ColumnStore/internal/crashtest"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The name of the log file inside the store directory.
+const logFileName = "wal.log"
+
+// The size of the log at which a checkpoint is written.
+const checkpointLogSize = 16 << 20
+
+// The prefix of the temporary files written by checkpoints.
+const tempFilePrefix = "tmp-"
+
+// The kinds of changes recorded in the log.
+type walRecordKind string
+
+const (
+	walCreate      walRecordKind = "CREATE"
+	walInsert      walRecordKind = "INSERT"
+	walUpdate      walRecordKind = "UPDATE"
+	walDelete      walRecordKind = "DELETE"
+	walCollate     walRecordKind = "COLLATE"
+	walCreateIndex walRecordKind = "CREATE INDEX"
+	walDropIndex   walRecordKind = "DROP INDEX"
+	walCompact     walRecordKind = "COMPACT"
+	walCommit      walRecordKind = "COMMIT"
+)
+
+// A change of a relation. Only the fields of the kind of the change are set.
+type walRecord struct {
+	LSN      int64
+	Kind     walRecordKind
+	Relation string
+	// CREATE: the relation with its rows and indexes
+	Created *storedRelation
+	// INSERT and UPDATE: the appended rows
+	Columns []storedColumn
+	// DELETE and UPDATE: the positions of the deleted rows and if the relation is compacted afterwards
+	Rows    []int
+	Compact bool
+	// COLLATE: the column and its new collation
+	Column    string
+	Collation Collation
+	// CREATE INDEX and DROP INDEX: the index, the column of CREATE INDEX is stored in Column
+	Index     string
+	IndexKind IndexKind
+	Tokenizer Tokenizer
+	// COMMIT: the changes of the relations written by a transaction as UPDATE records
+	Changes []walRecord
+}
+
+// The log of a store directory.
+type writeAheadLog struct {
+	store *ColumnStore
+	dir   string
+	// Guards the log file, its size and the next LSN.
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	nextLSN int64
+	// Held while a checkpoint is written.
+	checkpointing sync.Mutex
+	// The tests of the module simulated a crash, all later writes fail.
+	crashed bool
+	// Guards the simulated crash, writes of checkpoints are not guarded by mu.
+	crashMu sync.Mutex
+}
+
+/*
+-------------------------------------------------
+Write-ahead log intern helper functions
+-------------------------------------------------
+*/
+
+// Reads the log of the directory and returns it with its complete records. A torn record at
+// the end of the log is cut off.
+func openLog(cs *ColumnStore, dir string) (*writeAheadLog, []walRecord) {
+	path := filepath.Join(dir, logFileName)
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		checkError(err)
+	}
+	records, valid := decodeRecords(content)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	checkError(err)
+	if valid < len(content) {
+		// the changes of torn records were never made
+		checkError(file.Truncate(int64(valid)))
+		checkError(file.Sync())
+	}
+	return &writeAheadLog{store: cs, dir: dir, file: file, size: int64(valid), nextLSN: 1}, records
+}
+
+// Returns the records of the log content and the length of the part holding them. Decoding
+// stops at the first incomplete or damaged record.
+func decodeRecords(content []byte) ([]walRecord, int) {
+	records := make([]walRecord, 0)
+	pos := 0
+	for len(content)-pos >= 8 {
+		length := int(binary.LittleEndian.Uint32(content[pos:]))
+		checksum := binary.LittleEndian.Uint32(content[pos+4:])
+		if len(content)-pos-8 < length {
+			break
+		}
+		payload := content[pos+8 : pos+8+length]
+		if crc32.ChecksumIEEE(payload) != checksum {
+			break
+		}
+		var rec walRecord
+		if gob.NewDecoder(bytes.NewReader(payload)).Decode(&rec) != nil {
+			break
+		}
+		records = append(records, rec)
+		pos += 8 + length
+	}
+	return records, pos
+}
+
+// Returns the record framed by its length and checksum.
+func encodeRecord(rec walRecord) []byte {
+	var payload bytes.Buffer
+	checkError(gob.NewEncoder(&payload).Encode(&rec))
+	frame := make([]byte, 8, 8+payload.Len())
+	binary.LittleEndian.PutUint32(frame, uint32(payload.Len()))
+	binary.LittleEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(payload.Bytes()))
+	return append(frame, payload.Bytes()...)
+}
+
+// Appends the record to the log and syncs it to disk. Returns the LSN of the record.
+func (w *writeAheadLog) append(rec walRecord) int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	rec.LSN = w.nextLSN
+	frame := encodeRecord(rec)
+	w.write(w.file, frame)
+	checkError(w.file.Sync())
+	w.nextLSN++
+	w.size += int64(len(frame))
+	return rec.LSN
+}
+
+// Writes a checkpoint if the log grew too large. Only one checkpoint is written at a time.
+func (w *writeAheadLog) checkpointIfNeeded() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	due := w.size >= checkpointLogSize
+	w.mu.Unlock()
+	if due && !w.hasCrashed() && w.checkpointing.TryLock() {
+		defer w.checkpointing.Unlock()
+		w.checkpoint()
+	}
+}
+
+// Writes all relations of the store into their files and removes the records contained in
+// them from the log. Changes made meanwhile stay in the log. The caller holds checkpointing.
+func (w *writeAheadLog) checkpoint() {
+	w.store.mu.RLock()
+	relations := make([]*Relation, 0, len(w.store.relations))
+	for _, rel := range w.store.relations {
+		relations = append(relations, rel.(*Relation))
+	}
+	w.store.mu.RUnlock()
+	saved := make(map[string]int64, len(relations))
+	for _, rel := range relations {
+		saved[rel.Name] = saveRelation(rel, w.dir, w)
+	}
+	syncDir(w.dir)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	content, err := os.ReadFile(filepath.Join(w.dir, logFileName))
+	checkError(err)
+	records, _ := decodeRecords(content[:w.size])
+	var kept bytes.Buffer
+	for _, rec := range records {
+		if rec.unsaved(saved) {
+			kept.Write(encodeRecord(rec))
+		}
+	}
+	path := filepath.Join(w.dir, logFileName)
+	tmp := w.writeTemp(w.dir, kept.Bytes())
+	w.rename(tmp, path)
+	syncDir(w.dir)
+	checkError(w.file.Close())
+	w.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	checkError(err)
+	w.size = int64(kept.Len())
+}
+
+// Reports if the record changes a relation whose file does not contain the change yet.
+func (rec walRecord) unsaved(saved map[string]int64) bool {
+	for _, change := range rec.changes() {
+		if lsn, ok := saved[change.Relation]; !ok || change.LSN > lsn {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the changes of a single relation the record consists of. Commits consist of the
+// changes of the relations written by their transaction, which get the LSN of the commit.
+func (rec walRecord) changes() []walRecord {
+	if rec.Kind != walCommit {
+		return []walRecord{rec}
+	}
+	changes := make([]walRecord, len(rec.Changes))
+	for i, change := range rec.Changes {
+		change.LSN = rec.LSN
+		changes[i] = change
+	}
+	return changes
+}
+
+// Writes the data into a new temporary file of the directory and syncs it. Returns the path.
+// Works without log as well, then no crash is simulated.
+func (w *writeAheadLog) writeTemp(dir string, data []byte) string {
+	tmp, err := os.CreateTemp(dir, tempFilePrefix+"*")
+	checkError(err)
+	w.write(tmp, data)
+	checkError(tmp.Sync())
+	checkError(tmp.Close())
+	return tmp.Name()
+}
+
+// Writes the data into the file, a simulated crash tears the write.
+func (w *writeAheadLog) write(file *os.File, data []byte) {
+	if w.crashes() {
+		file.Write(data[:len(data)/2])
+		w.crash()
+	}
+	_, err := file.Write(data)
+	checkError(err)
+}
+
+// Renames the file, a simulated crash happens before the file is renamed.
+func (w *writeAheadLog) rename(from, to string) {
+	if w.crashes() {
+		w.crash()
+	}
+	checkError(os.Rename(from, to))
+}
+
+// Counts a write and reports if a crash simulated by the tests of the module happens at it.
+func (w *writeAheadLog) crashes() bool {
+	if w == nil {
+		return false
+	}
+	w.crashMu.Lock()
+	defer w.crashMu.Unlock()
+	if !w.crashed {
+		w.crashed = crashtest.Crashes(w.dir)
+	}
+	return w.crashed
+}
+
+// Reports if the simulated crash already happened.
+func (w *writeAheadLog) hasCrashed() bool {
+	w.crashMu.Lock()
+	defer w.crashMu.Unlock()
+	return w.crashed
+}
+
+// Stops the store like a crash: the log file is closed without writing anything else.
+func (w *writeAheadLog) crash() {
+	w.file.Close()
+	panic(crashtest.ErrCrashed)
+}
+
+// Syncs the directory, so renamed files survive a crash.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	checkError(err)
+	defer d.Close()
+	checkError(d.Sync())
+}
+
+// Removes the temporary files left in the directory by a crash during a checkpoint.
+func removeTempFiles(dir string) {
+	files, err := os.ReadDir(dir)
+	checkError(err)
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), tempFilePrefix) {
+			checkError(os.Remove(filepath.Join(dir, file.Name())))
+		}
+	}
+}
+
+// Writes the change into the log of the store of the relation before it is made and records
+// its LSN. Relations of stores without directory are not logged. The relation has to be
+// locked for writing.
+func (rel *Relation) logChange(rec walRecord) {
+	if rel.log == nil {
+		return
+	}
+	rec.Relation = rel.Name
+	rel.lsn = rel.log.append(rec)
+}
+
+// Unlocks the relation after a logged change and writes a checkpoint if the log grew too large.
+func (rel *Relation) unlockAfterChange() {
+	log := rel.log
+	rel.mu.Unlock()
+	log.checkpointIfNeeded()
+}
+
+// Makes the logged change on the relation, the relation has to be locked for writing.
+func (rel *Relation) replay(rec walRecord) {
+	switch rec.Kind {
+	case walInsert:
+		rel.appendDelta(storedColumns(rec.Columns))
+	case walUpdate:
+		rel.replaceRows(rec.Rows, storedColumns(rec.Columns))
+	case walDelete:
+		rel.markDeleted(rec.Rows)
+	case walCompact:
+		rel.compact()
+	case walCollate:
+		rel.collate(columnIndex(rel.Columns, AttrInfo{Name: rec.Column}), rec.Collation)
+	case walCreateIndex:
+		rel.addIndex(rec.Index, columnIndex(rel.Columns, AttrInfo{Name: rec.Column}), rec.IndexKind, rec.Tokenizer)
+	case walDropIndex:
+		rel.dropIndex(rec.Index)
+	default:
+		error_("Unknown log record '%s'.", rec.Kind)
+	}
+	if rec.Compact {
+		rel.compact()
+	}
+	rel.lsn = rec.LSN
+}
+
+// Returns the stored columns of the columns.
+func storeColumns(cols []Column) []storedColumn {
+	result := make([]storedColumn, len(cols))
+	for i := range cols {
+		result[i] = storeColumn(cols[i].materialize())
+	}
+	return result
+}
+
+// Returns the columns of the stored columns.
+func storedColumns(stored []storedColumn) []Column {
+	result := make([]Column, len(stored))
+	for i, sc := range stored {
+		result[i] = sc.column()
+	}
+	return result
+}
@@ -0,0 +1,156 @@
+package core
+
+/*
+	Zone maps split the data of a column into blocks of zoneBlockSize rows and record the
+	minimum, the maximum and the number of NULL values of every block. A selection directly on
+	a relation skips the blocks whose zones show that none of their rows can meet the
+	predicate. This pays off for sorted or clustered columns like IDs, where range comparisons
+	only touch a few blocks. The zone maps are built together with the statistics.
+*/
+
+// The number of rows of a block of a zone map.
+const zoneBlockSize = 1 << 16
+
+// The metadata of a block of a column. The values are compared in byte order.
+type zone struct {
+	min   interface{} // nil if all values of the block are NULL
+	max   interface{}
+	nulls int
+	rows  int
+}
+
+// Builds the zone map of the values.
+func buildZones[T Value](data []T, nulls []bool) []zone {
+	zones := make([]zone, 0, (len(data)+zoneBlockSize-1)/zoneBlockSize)
+	for start := 0; start < len(data); start += zoneBlockSize {
+		end := minimum(start+zoneBlockSize, len(data))
+		z := zone{rows: end - start}
+		var lo, hi T
+		for i := start; i < end; i++ {
+			if nulls != nil && nulls[i] {
+				z.nulls++
+				continue
+			}
+			if z.nulls == i-start || data[i] < lo {
+				lo = data[i]
+			}
+			if z.nulls == i-start || data[i] > hi {
+				hi = data[i]
+			}
+		}
+		if z.nulls < z.rows {
+			z.min, z.max = lo, hi
+		}
+		zones = append(zones, z)
+	}
+	return zones
+}
+
+// Builds the zone maps of all columns of the relation. Views have no zone maps of their own.
+func (rel *Relation) buildZones() {
+	for i := range rel.Columns {
+		col := &rel.Columns[i]
+		col.zones = nil
+		if col.rows == nil {
+			col.zones = col.Data.zoneMap(col.nulls)
+		}
+	}
+}
+
+// Returns the number of blocks of the relation, 0 if its columns have no zone maps.
+func (rel *Relation) blockCount() int {
+	for _, col := range rel.Columns {
+		if col.zones != nil {
+			return len(col.zones)
+		}
+	}
+	return 0
+}
+
+// Returns the number of blocks that are skipped by a selection with the predicate.
+func (rel *Relation) skippedBlocks(pred Predicate) int {
+	skipped := 0
+	for block := 0; block < rel.blockCount(); block++ {
+		if rel.excludes(block, pred) {
+			skipped++
+		}
+	}
+	return skipped
+}
+
+// Checks if the zones of the block show that none of its rows meet the predicate.
+func (rel *Relation) excludes(block int, pred Predicate) bool {
+	switch p := pred.(type) {
+	case *comparePredicate:
+		z, ok := rel.zone(p.col, block)
+		return ok && z.excludes(p.comp, p.compVal)
+	case *betweenPredicate:
+		z, ok := rel.zone(p.col, block)
+		return ok && (z.excludes(GE, p.lo) || z.excludes(LE, p.hi))
+	case *inPredicate:
+		z, ok := rel.zone(p.col, block)
+		if !ok {
+			return false
+		}
+		for _, value := range p.values {
+			if !z.excludes(EQ, value) {
+				return false
+			}
+		}
+		return true
+	case *isNullPredicate:
+		z, ok := rel.zone(p.col, block)
+		return ok && z.nulls == 0
+	case *andPredicate:
+		for _, part := range p.preds {
+			if rel.excludes(block, part) {
+				return true
+			}
+		}
+	case *orPredicate:
+		for _, part := range p.preds {
+			if !rel.excludes(block, part) {
+				return false
+			}
+		}
+		return len(p.preds) > 0
+	}
+	return false
+}
+
+// Returns the zone of the block of the column. Columns compared with a collation have no usable zones.
+func (rel *Relation) zone(attr AttrInfo, block int) (zone, bool) {
+	idx := rel.findColumn(attr)
+	if idx == -1 || rel.Columns[idx].Signature.Collation != BINARY || block >= len(rel.Columns[idx].zones) {
+		return zone{}, false
+	}
+	return rel.Columns[idx].zones[block], true
+}
+
+// Checks if no value of the zone meets "value comp compVal". NULL values never meet a comparison.
+func (z zone) excludes(comp Comparison, compVal interface{}) bool {
+	if z.min == nil {
+		return true
+	}
+	lower, lok := compareValues(z.min, compVal)
+	upper, uok := compareValues(z.max, compVal)
+	if !lok || !uok {
+		return false
+	}
+	switch comp {
+	case EQ:
+		return lower > 0 || upper < 0
+	case NEQ:
+		return lower == 0 && upper == 0
+	case LT:
+		return lower >= 0
+	case LE:
+		return lower > 0
+	case GT:
+		return upper <= 0
+	case GE:
+		return upper < 0
+	}
+	// pattern comparisons
+	return false
+}
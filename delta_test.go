@@ -0,0 +1,145 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"sort"
+	"sync"
+	"testing"
+)
+
+var (
+	artikelID    = core.AttrInfo{Name: "ID", Type: core.INT}
+	artikelName  = core.AttrInfo{Name: "Name", Type: core.STRING}
+	artikelPreis = core.AttrInfo{Name: "Preis", Type: core.INT}
+)
+
+// Returns the values of the INT column with the passed position in the order of the rows.
+func intValues(rel core.Relationer, col int) []int {
+	it := rel.Iterator()
+	it.Open()
+	defer it.Close()
+	values := make([]int, 0)
+	for batch := it.Next(); batch != nil; batch = it.Next() {
+		for row := 0; row < batch.RowCount(); row++ {
+			values = append(values, batch.Value(col, row).(int))
+		}
+	}
+	return values
+}
+
+// Creates the relation "artikel" with indexes on all columns, the names are split with stemming.
+func createArtikel(cs *core.ColumnStore) core.Relationer {
+	artikel := cs.CreateRelation("artikel", []core.AttrInfo{artikelID, artikelName, artikelPreis})
+	artikel.CreateIndex("artikel_id", artikelID, core.HASH)
+	artikel.CreateIndex("artikel_preis", artikelPreis, core.ORDERED)
+	artikel.CreateFullTextIndex("artikel_name", artikelName, core.Tokenizer{Split: core.WORDS, Lowercase: true, Stemming: true})
+	return artikel
+}
+
+// Checks that queries see the inserted rows in the delta and after they were merged into the
+// main columns, and that the rows of the delta can be changed.
+func TestDeltaQueries(t *testing.T) {
+	cs := new(core.ColumnStore)
+	artikel := createArtikel(cs)
+	names := []string{"Haus", "Häuser", "Garten", "Baum"}
+	for i := 1; i <= 40; i++ {
+		artikel.Insert([][]interface{}{{i, names[i%len(names)], (i * 37) % 50}})
+	}
+
+	check := func(state string, rows int) {
+		t.Helper()
+		if got := countRows(artikel); got != rows {
+			t.Fatalf("%s: the scan returned %d rows instead of %d.", state, got, rows)
+		}
+		preise := intValues(artikel.IndexScanWhere(core.Compare(artikelPreis, core.GE, 10)), 2)
+		if !sort.IntsAreSorted(preise) {
+			t.Fatalf("%s: the index scan returned the rows out of order: %v", state, preise)
+		}
+		if expected := countRows(artikel.Select(artikelPreis, core.GE, 10)); len(preise) != expected {
+			t.Fatalf("%s: the index scan returned %d rows instead of %d.", state, len(preise), expected)
+		}
+		if got := countRows(artikel.IndexScan(artikelID, 40)); got != 1 {
+			t.Fatalf("%s: the index scan of the last row returned %d rows.", state, got)
+		}
+		// the stems of Haus and Häuser are the same
+		if got, expected := countRows(artikel.SelectWhere(core.Match(artikelName, "haus"))), rows/2; got != expected {
+			t.Fatalf("%s: Match returned %d rows instead of %d.", state, got, expected)
+		}
+		if preise := intValues(artikel.OrderBy(artikelPreis, false), 2); !sort.IntsAreSorted(preise) || len(preise) != rows {
+			t.Fatalf("%s: OrderBy returned %v.", state, preise)
+		}
+		if got := countRows(cs.HashJoin("artikel", artikelID, "artikel", artikelID, core.EQ)); got != rows {
+			t.Fatalf("%s: the join returned %d rows instead of %d.", state, got, rows)
+		}
+	}
+	check("delta", 40)
+	artikel.(*core.Relation).MergeDelta()
+	check("merged", 40)
+	// the merged rows are indexed, no rows are counted twice
+	if got := indexedRows(artikel, 2); got != 40 {
+		t.Fatalf("The index of the merged relation has %d rows instead of 40.", got)
+	}
+
+	artikel.Insert([][]interface{}{{41, "Gartenhaus", 5}, {42, "Haus", 3}})
+	artikel.Update(core.Compare(artikelID, core.EQ, 41), []core.NamedExpr{{Name: "Name", Expr: core.Const("Häuschen")}})
+	artikel.Delete(core.Compare(artikelID, core.EQ, 42))
+	if got := countRows(artikel.IndexScanWhere(core.Compare(artikelID, core.GT, 40))); got != 1 {
+		t.Fatalf("The changed rows of the delta returned %d rows instead of 1.", got)
+	}
+	if got := countRows(artikel.SelectWhere(core.Match(artikelName, "gartenhaus"))); got != 0 {
+		t.Fatalf("The updated row of the delta still matches its old name.")
+	}
+	// the rows of the delta are counted as covered by the indexes, including the deleted ones
+	if got := indexedRows(artikel, 0); got != 43 {
+		t.Fatalf("The index counts %d rows instead of 43.", got)
+	}
+}
+
+// Inserts rows while other goroutines query the relation and checks that every query sees a
+// consistent state: the index scans return the rows in order and no row disappears. Run with -race.
+func TestConcurrentDeltaInserts(t *testing.T) {
+	cs := new(core.ColumnStore)
+	artikel := createArtikel(cs)
+	const inserters, inserts = 3, 100
+
+	var wg sync.WaitGroup
+	for g := 0; g < inserters; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < inserts; i++ {
+				id := g*inserts + i
+				artikel.Insert([][]interface{}{{id, "Haus", id % 17}})
+			}
+		}(g)
+	}
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			seen := 0
+			for i := 0; i < 50; i++ {
+				preise := intValues(artikel.IndexScanWhere(core.Compare(artikelPreis, core.GE, 0)), 2)
+				if !sort.IntsAreSorted(preise) {
+					t.Errorf("The index scan returned the rows out of order.")
+					return
+				}
+				if len(preise) < seen {
+					t.Errorf("The index scan returned %d rows after %d rows.", len(preise), seen)
+					return
+				}
+				seen = len(preise)
+				artikel.SelectWhere(core.Match(artikelName, "häuser")).Materialize()
+				artikel.OrderBy(artikelPreis, true).Materialize()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := countRows(artikel.IndexScanWhere(core.Compare(artikelPreis, core.GE, 0))); got != inserters*inserts {
+		t.Fatalf("The index scan returned %d rows instead of %d.", got, inserters*inserts)
+	}
+	if got := countRows(artikel.SelectWhere(core.Match(artikelName, "haus"))); got != inserters*inserts {
+		t.Fatalf("Match returned %d rows instead of %d.", got, inserters*inserts)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"strings"
+	"testing"
+)
+
+// Checks that ill-typed expressions are rejected by ProjectChecked before any row is evaluated.
+func TestExpressionTypeErrors(t *testing.T) {
+	cs := new(core.ColumnStore)
+	students := cs.Load("students.csv", ',')
+	id, durchschnitt := core.AttrInfo{Name: "ID"}, core.AttrInfo{Name: "Durchschnitt"}
+
+	tests := []struct {
+		name  string
+		expr  core.Expr
+		error string
+	}{
+		{"unknown column", core.Col("Semester"), "unknown column 'Semester'"},
+		{"string arithmetic", core.Add(core.Col("Nachname"), core.Const(1)), "not defined for strings"},
+		{"upper of int", core.Upper(core.Col("ID")), "INT"},
+		{"case branch types", core.Case([]core.When{{Cond: core.Compare(id, core.LT, 3), Then: core.Const("klein")}}, core.Const(1)), "different types"},
+		{"case value type", core.Case([]core.When{{Cond: core.Compare(id, core.EQ, "one"), Then: core.Const(1)}}, nil), "value 'one' of column 'ID' is of type STRING instead of INT"},
+		{"case in types", core.Case([]core.When{{Cond: core.In(durchschnitt, 1.0, 2), Then: core.Const(1)}}, nil), "value '2' of column 'Durchschnitt'"},
+		{"case between types", core.Case([]core.When{{Cond: core.Between(id, 1, 2.5), Then: core.Const(1)}}, nil), "value '2.5' of column 'ID'"},
+		{"case nested types", core.Case([]core.When{{Cond: core.Not(core.Or(core.IsNull(id), core.Compare(durchschnitt, core.GT, "gut"))), Then: core.Const(1)}}, nil), "'Durchschnitt'"},
+		{"case invalid regular expression", core.Case([]core.When{{Cond: core.Compare(core.AttrInfo{Name: "Vorname"}, core.REGEXP, "(A"), Then: core.Const(1)}}, nil), "invalid regular expression '(A'"},
+		{"case LIKE ending with escape", core.Case([]core.When{{Cond: core.Compare(core.AttrInfo{Name: "Vorname"}, core.LIKE, `A%\`), Then: core.Const(1)}}, nil), "ends with the escape character"},
+		{"case pattern on int", core.Case([]core.When{{Cond: core.Compare(id, core.LIKE, "1%"), Then: core.Const(1)}}, nil), "pattern comparison"},
+		{"case column types", core.Case([]core.When{{Cond: core.CompareColumns(id, core.EQ, core.AttrInfo{Name: "Vorname"}), Then: core.Const(1)}}, nil), "comparison of the INT column 'ID'"},
+		{"case match on float", core.Case([]core.When{{Cond: core.Match(durchschnitt, "gut"), Then: core.Const(1)}}, nil), "match on the FLOAT column"},
+		{"case unknown column", core.Case([]core.When{{Cond: core.IsNull(core.AttrInfo{Name: "Semester"}), Then: core.Const(1)}}, nil), "unknown column 'Semester'"},
+	}
+	for _, test := range tests {
+		_, err := students.ProjectChecked([]core.NamedExpr{{Name: "Wert", Expr: test.expr}})
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: got the error %v instead of one containing %q.", test.name, err, test.error)
+		}
+	}
+
+	// well typed expressions are accepted and evaluated
+	projected, err := students.ProjectChecked([]core.NamedExpr{{Name: "Wert", Expr: core.Case([]core.When{
+		{Cond: core.And(core.Compare(id, core.LT, 3), core.Compare(durchschnitt, core.LE, 2.5)), Then: core.Const(1)},
+	}, core.Const(0))}})
+	if err != nil {
+		t.Fatalf("The well typed projection failed: %s", err)
+	}
+	expected := countRows(students.SelectWhere(core.And(core.Compare(id, core.LT, 3), core.Compare(durchschnitt, core.LE, 2.5))))
+	if got := countRows(projected.Select(core.AttrInfo{Name: "Wert"}, core.EQ, 1)); got != expected {
+		t.Fatalf("The case expression matched %d rows instead of %d.", got, expected)
+	}
+}
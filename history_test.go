@@ -0,0 +1,158 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Returns the commits of the versions of the relation listed by Snapshots.
+func snapshotCommits(cs *core.ColumnStore, relName string) []int {
+	commits := make([]int, 0)
+	it := cs.Snapshots().Iterator()
+	it.Open()
+	defer it.Close()
+	for batch := it.Next(); batch != nil; batch = it.Next() {
+		for row := 0; row < batch.RowCount(); row++ {
+			if batch.Value(0, row).(string) == relName {
+				commits = append(commits, batch.Value(1, row).(int))
+			}
+		}
+	}
+	return commits
+}
+
+// Checks that the versions of a relation are seen by time travel queries as they were at
+// their commits, also by joins with other versions, and after a compaction.
+func TestTimeTravel(t *testing.T) {
+	cs := new(core.ColumnStore)
+	konten := createKonten(cs, 4)
+	konten.CreateIndex("konten_id", kontoID, core.ORDERED)
+	created := time.Now()
+
+	tx := cs.Begin()
+	transfer(tx, 1, 2, 50)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("The commit failed: %s", err)
+	}
+	// most rows are deleted, so the relation is compacted
+	konten.Delete(core.Compare(kontoID, core.LE, 3))
+	commits := snapshotCommits(cs, "konten")
+	if len(commits) != 4 {
+		t.Fatalf("The history has the versions %v instead of 4 versions.", commits)
+	}
+
+	if got := balances(cs.GetRelationAsOf("konten", created)); len(got) != 4 || got[1] != 100 {
+		t.Fatalf("The relation as of its creation has the balances %v.", got)
+	}
+	transferred := cs.GetRelationAtCommit("konten", int64(commits[2]))
+	if got := balances(transferred); len(got) != 4 || got[1] != 50 || got[2] != 150 {
+		t.Fatalf("The relation after the transfer has the balances %v.", got)
+	}
+	if got := countRows(transferred.IndexScanWhere(core.Compare(kontoID, core.GE, 2))); got != 3 {
+		t.Fatalf("The index scan of the version returned %d rows instead of 3.", got)
+	}
+	if got := balances(cs.GetRelationAtCommit("konten", int64(commits[3]))); len(got) != 1 || got[4] != 100 {
+		t.Fatalf("The current version has the balances %v.", got)
+	}
+
+	// the versions before and after the transfer differ in the balances of two accounts
+	before := cs.GetRelationAtCommit("konten", int64(commits[1]))
+	changed := cs.Join(before, transferred, core.JoinCondition{Left: kontoID, Comp: core.EQ, Right: kontoID}, core.INNER).
+		SelectWhere(core.CompareColumns(kontoStand, core.NEQ, core.AttrInfo{Name: "Stand (right)"}))
+	if got := countRows(changed); got != 2 {
+		t.Fatalf("The join of the versions returned %d changed accounts instead of 2.", got)
+	}
+}
+
+// Checks that versions are removed once their successors are older than the retention.
+func TestHistoryRetention(t *testing.T) {
+	cs := new(core.ColumnStore)
+	cs.SetRetention(20 * time.Millisecond)
+	konten := createKonten(cs, 2)
+	konten.Delete(core.Compare(kontoID, core.EQ, 1))
+	if got := len(snapshotCommits(cs, "konten")); got != 3 {
+		t.Fatalf("The history has %d versions instead of 3.", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := len(snapshotCommits(cs, "konten")); got != 1 {
+		t.Fatalf("The history has %d versions after the retention instead of the current one.", got)
+	}
+	cs.SetRetention(0)
+	konten.Insert([][]interface{}{{3, 30}})
+	if got := balances(cs.GetRelationAsOf("konten", time.Now())); len(got) != 2 || got[3] != 30 {
+		t.Fatalf("The current version has the balances %v.", got)
+	}
+}
+
+// Checks that many changes within the retention keep at most the limit of versions, the newest
+// ones, and that the kept versions still have their rows.
+func TestHistoryVersionLimit(t *testing.T) {
+	cs := new(core.ColumnStore)
+	konten := createKonten(cs, 0)
+	for i := 1; i <= 2*core.DefaultMaxVersions; i++ {
+		konten.Insert([][]interface{}{{i, i}})
+	}
+	commits := snapshotCommits(cs, "konten")
+	if len(commits) != core.DefaultMaxVersions {
+		t.Fatalf("The history has %d versions instead of %d.", len(commits), core.DefaultMaxVersions)
+	}
+
+	cs.SetMaxVersions(5)
+	for i := 1; i <= 3; i++ {
+		konten.Delete(core.Compare(kontoID, core.EQ, i))
+	}
+	kept := snapshotCommits(cs, "konten")
+	if len(kept) != 5 || kept[4] != commits[len(commits)-1]+3 {
+		t.Fatalf("The history has the versions %v instead of the last 5 ones.", kept)
+	}
+	// the oldest kept version is the one after the last two inserts
+	if got := countRows(cs.GetRelationAtCommit("konten", int64(kept[0]))); got != 2*core.DefaultMaxVersions-1 {
+		t.Fatalf("The oldest kept version has %d rows instead of %d.", got, 2*core.DefaultMaxVersions-1)
+	}
+}
+
+// Reads versions of the relation while it is changed and checks that every version keeps its
+// rows. Run with -race.
+func TestConcurrentTimeTravel(t *testing.T) {
+	cs := new(core.ColumnStore)
+	// all versions of the changes below are kept
+	cs.SetMaxVersions(1000)
+	konten := createKonten(cs, 0)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 100; i++ {
+			konten.Insert([][]interface{}{{i, i}})
+			if i%10 == 0 {
+				konten.Delete(core.Compare(kontoID, core.LE, i-5))
+			}
+		}
+	}()
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				asOf := time.Now()
+				version := cs.GetRelationAsOf("konten", asOf)
+				rows := countRows(version)
+				time.Sleep(time.Millisecond)
+				if got := countRows(cs.GetRelationAsOf("konten", asOf)); got != rows {
+					t.Errorf("The version as of %s returned %d rows and then %d rows.", asOf, rows, got)
+					return
+				}
+				// indexes can be built on versions
+				version.MakeIndex(kontoID, core.ORDERED)
+				if got := countRows(version.IndexScanWhere(core.Compare(kontoID, core.GT, 0))); got != rows {
+					t.Errorf("The index scan of the version returned %d rows instead of %d.", got, rows)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Checks if the values are in ascending order, the values are ints, floats or strings.
+func ascending(values []interface{}) bool {
+	for i := 1; i < len(values); i++ {
+		switch v := values[i].(type) {
+		case int:
+			if v < values[i-1].(int) {
+				return false
+			}
+		case float64:
+			if v < values[i-1].(float64) {
+				return false
+			}
+		case string:
+			if v < values[i-1].(string) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Returns the values of the column with the passed position of the rows.
+func columnValues(rows [][]interface{}, col int) []interface{} {
+	values := make([]interface{}, len(rows))
+	for i, row := range rows {
+		values[i] = row[col]
+	}
+	return values
+}
+
+// Checks that the range scans of ordered indexes return the rows of Select in the order of the
+// values, and that the range joins on ordered indexes return the rows of nested loops.
+func TestOrderedIndexScans(t *testing.T) {
+	cs := new(core.ColumnStore)
+	messungen := createMessungen(cs)
+	for _, col := range []core.AttrInfo{messungID, messungWert, messungOrt} {
+		messungen.MakeIndex(col, core.ORDERED)
+	}
+
+	tests := []struct {
+		col   core.AttrInfo
+		pos   int
+		comp  core.Comparison
+		value interface{}
+	}{
+		{messungID, 0, core.EQ, 17},
+		{messungID, 0, core.LT, 10},
+		{messungID, 0, core.GE, 25},
+		{messungWert, 1, core.LE, 20.5},
+		{messungWert, 1, core.GT, 30.0},
+		{messungWert, 1, core.EQ, 14.5},
+		{messungOrt, 2, core.GE, "Köln"},
+		{messungOrt, 2, core.LT, "Hamburg"},
+		{messungOrt, 2, core.EQ, "Berlin"},
+	}
+	for _, test := range tests {
+		query := fmt.Sprintf("%s %s %v", test.col.Name, test.comp, test.value)
+		got := rowValues(messungen.IndexScanWhere(core.Compare(test.col, test.comp, test.value)))
+		expected := rowValues(messungen.Select(test.col, test.comp, test.value))
+		if !ascending(columnValues(got, test.pos)) {
+			t.Errorf("The index scan of %s returned the values %v out of order.", query, columnValues(got, test.pos))
+		}
+		if fmt.Sprint(sortedRows(got)) != fmt.Sprint(sortedRows(expected)) {
+			t.Errorf("The index scan of %s returned %v instead of %v.", query, got, expected)
+		}
+	}
+	between := rowValues(messungen.IndexScanWhere(core.Between(messungWert, 10.0, 25.5)))
+	if expected := rowValues(messungen.SelectWhere(core.Between(messungWert, 10.0, 25.5))); !ascending(columnValues(between, 1)) ||
+		fmt.Sprint(sortedRows(between)) != fmt.Sprint(sortedRows(expected)) {
+		t.Errorf("The index scan of Between returned %v instead of %v.", between, expected)
+	}
+
+	bestellungen, kunden := createBestellungen(cs, 4)
+	left, right := rowValues(bestellungen), rowValues(kunden)
+	kunden.MakeIndex(kundeLimit, core.ORDERED)
+	for _, comp := range []core.Comparison{core.EQ, core.LT, core.LE, core.GT, core.GE} {
+		// IndexRangeJoin joins the rows where "right value comp left value" holds
+		flipped := map[core.Comparison]core.Comparison{core.EQ: core.EQ, core.LT: core.GT, core.LE: core.GE, core.GT: core.LT, core.GE: core.LE}[comp]
+		got := sortedRows(rowValues(cs.IndexRangeJoin("bestellungen", bestellungBetrag, "kunden", kundeLimit, comp)))
+		expected := sortedRows(referenceJoin(left, right, 2, flipped, 1, core.INNER))
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("The range join on Limit %s Betrag returned %v instead of %v.", comp, got, expected)
+		}
+	}
+}
+
+// Checks that predicates on several columns with BITMAP indexes are evaluated on the bitmaps and
+// return the rows of SelectWhere, also after rows were changed, and the number of keys listed by Indexes.
+func TestBitmapIndexScans(t *testing.T) {
+	cs := new(core.ColumnStore)
+	geschlecht := core.AttrInfo{Name: "Geschlecht", Type: core.STRING}
+	stufe := core.AttrInfo{Name: "Stufe", Type: core.INT}
+	personen := cs.CreateRelation("personen", []core.AttrInfo{{Name: "ID", Type: core.INT}, geschlecht, stufe})
+	for i := 0; i < 500; i++ {
+		var g interface{} = []string{"w", "m", "d"}[i%3]
+		if i%11 == 0 {
+			g = nil
+		}
+		personen.Insert([][]interface{}{{i, g, i % 5}})
+	}
+	personen.(*core.Relation).MergeDelta()
+	personen.CreateIndex("personen_geschlecht", geschlecht, core.BITMAP)
+	personen.CreateIndex("personen_stufe", stufe, core.BITMAP)
+
+	preds := map[string]core.Predicate{
+		"comparison":    core.Compare(stufe, core.GE, 3),
+		"And":           core.And(core.Compare(geschlecht, core.EQ, "w"), core.Compare(stufe, core.LT, 2)),
+		"Or":            core.Or(core.Compare(geschlecht, core.EQ, "d"), core.In(stufe, 0, 4)),
+		"Not":           core.Not(core.Compare(geschlecht, core.EQ, "m")),
+		"IsNull":        core.And(core.IsNull(geschlecht), core.Compare(stufe, core.NEQ, 2)),
+		"nested":        core.Or(core.And(core.Not(core.In(geschlecht, "w", "m")), core.Compare(stufe, core.LE, 1)), core.Compare(stufe, core.EQ, 3)),
+		"unknown value": core.Compare(geschlecht, core.EQ, "x"),
+		"Not of And":    core.Not(core.And(core.Compare(geschlecht, core.EQ, "w"), core.Compare(stufe, core.GE, 2))),
+		"Not of Or":     core.Not(core.Or(core.Compare(geschlecht, core.NEQ, "d"), core.Compare(stufe, core.EQ, 1))),
+		"Not of Not":    core.Not(core.Not(core.In(geschlecht, "m", "d"))),
+	}
+	check := func(state string) {
+		t.Helper()
+		for name, pred := range preds {
+			scan := personen.IndexScanWhere(pred)
+			if plan := scan.Explain(); !strings.HasPrefix(plan, "IndexScan") || strings.Contains(plan, "no index") {
+				t.Errorf("%s: %s is not evaluated on the bitmaps:\n%s", state, name, plan)
+			}
+			checkRows(t, state+": "+name, rowValues(scan), rowValues(personen.SelectWhere(pred)))
+		}
+	}
+	check("indexed")
+	// the keys of the bitmap indexes are the distinct values without NULL
+	for _, row := range rowValues(personen.Indexes()) {
+		if keys := map[string]int{"Geschlecht": 3, "Stufe": 5}[row[1].(string)]; row[3] != keys {
+			t.Errorf("The index %s has %v keys instead of %d.", row[0], row[3], keys)
+		}
+	}
+
+	personen.Delete(core.Compare(stufe, core.EQ, 4))
+	personen.Insert([][]interface{}{{500, "x", 7}, {501, nil, 3}})
+	personen.Update(core.Compare(core.AttrInfo{Name: "ID"}, core.LT, 20), []core.NamedExpr{{Name: "Geschlecht", Expr: core.Const("d")}})
+	personen.(*core.Relation).MergeDelta()
+	check("changed")
+}
+
+// The stored form of a relation as written by Save, gob matches the fields by their names.
+type savedRelation struct {
+	Version int
+	Name    string
+	Columns []struct {
+		Signature core.AttrInfo
+		Ints      []int
+		Floats    []float64
+		Strings   []string
+		Nulls     []bool
+		Zones     []struct {
+			Min, Max    interface{}
+			Nulls, Rows int
+		}
+	}
+	Indexes []struct {
+		Name, Column string
+		Kind         core.IndexKind
+		Version      int
+		Checksum     uint64
+		Keys         [][]int
+		Ordered      []int
+		Bitmaps      []savedBitmap
+		Nulls        savedBitmap
+		KeyValues    []interface{}
+		Tokenizer    core.Tokenizer
+		Tokens       []string
+		Postings     []struct {
+			Rows      []int
+			Positions [][]int
+		}
+		Rows int
+	}
+	Deleted []int
+	LSN     int64
+}
+
+type savedBitmap struct {
+	Keys   []uint32
+	Arrays [][]uint16
+	Bits   [][]uint64
+}
+
+// Saves the store into a new directory, changes the stored relation with the passed function and
+// returns a store opened from the directory.
+func reopenChanged(t *testing.T, cs *core.ColumnStore, relName string, change func(*savedRelation)) *core.ColumnStore {
+	dir := t.TempDir()
+	cs.Save(dir)
+	file := filepath.Join(dir, relName+".rel")
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored savedRelation
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+	change(&stored)
+	var changed bytes.Buffer
+	if err := gob.NewEncoder(&changed).Encode(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, changed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opened := new(core.ColumnStore)
+	opened.Open(dir)
+	return opened
+}
+
+// Checks that opened indexes return the rows of Select, also if the stored data changed after
+// the indexes were saved or the indexes were saved in another format, so they have to be rebuilt.
+func TestStaleIndexesRebuiltOnOpen(t *testing.T) {
+	cs := new(core.ColumnStore)
+	messungen := createMessungen(cs)
+	messungen.CreateIndex("messungen_id", messungID, core.HASH)
+	messungen.CreateIndex("messungen_wert", messungWert, core.ORDERED)
+	messungen.CreateIndex("messungen_ort", messungOrt, core.BITMAP)
+	messungen.CreateIndex("messungen_ort_text", messungOrt, core.FULLTEXT)
+
+	tests := []struct {
+		name   string
+		change func(*savedRelation)
+	}{
+		{"unchanged", func(stored *savedRelation) {}},
+		{"changed data", func(stored *savedRelation) {
+			for i := range stored.Columns {
+				col := &stored.Columns[i]
+				for k := range col.Ints {
+					col.Ints[k] = len(col.Ints) - col.Ints[k]
+				}
+				for k := range col.Floats {
+					col.Floats[k] += float64(k % 3 * 10)
+				}
+				for k, s := range col.Strings {
+					if s == "Berlin" {
+						col.Strings[k] = "Bremen"
+					}
+				}
+				col.Zones = nil
+			}
+		}},
+		{"old index format", func(stored *savedRelation) {
+			for i := range stored.Indexes {
+				index := &stored.Indexes[i]
+				index.Version = 0
+				index.Keys, index.Ordered, index.Bitmaps, index.KeyValues, index.Tokens, index.Postings = nil, nil, nil, nil, nil, nil
+			}
+		}},
+	}
+	for _, test := range tests {
+		opened := reopenChanged(t, cs, "messungen", test.change).GetRelation("messungen")
+		if got := countRows(opened.Indexes()); got != 4 {
+			t.Errorf("%s: %d indexes are opened instead of 4.", test.name, got)
+		}
+		checks := []struct {
+			query     string
+			index     core.Relationer
+			reference core.Relationer
+		}{
+			{"HASH", opened.IndexScan(messungID, 5), opened.Select(messungID, core.EQ, 5)},
+			{"ORDERED", opened.IndexScanWhere(core.Compare(messungWert, core.GE, 20.0)), opened.Select(messungWert, core.GE, 20.0)},
+			{"BITMAP", opened.IndexScanWhere(core.Compare(messungOrt, core.EQ, "Bremen")), opened.Select(messungOrt, core.EQ, "Bremen")},
+			{"FULLTEXT", opened.SelectWhere(core.Match(messungOrt, "köln")), opened.Select(messungOrt, core.EQ, "Köln")},
+		}
+		for _, check := range checks {
+			if got, expected := sortedRows(rowValues(check.index)), sortedRows(rowValues(check.reference)); fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("%s: the %s index returned %v instead of %v.", test.name, check.query, got, expected)
+			}
+		}
+	}
+}
+
+// Checks the Match queries on FULLTEXT indexes against the ids of the matching texts and against
+// the same queries on a relation without index, also combined with other predicates.
+func TestFullTextIndex(t *testing.T) {
+	cs := new(core.ColumnStore)
+	id := core.AttrInfo{Name: "ID", Type: core.INT}
+	text := core.AttrInfo{Name: "Text", Type: core.STRING}
+	texte := []interface{}{
+		"Das rote Haus am See", "Die Häuser sind rot", "Ein blaues Boot, ein rotes Auto.",
+		"Rot-grün ist die Ampel", "hell blau und dunkel blau", "Blau hell", nil, "",
+	}
+	indexed := cs.CreateRelation("texte", []core.AttrInfo{id, text})
+	scanned := cs.CreateRelation("texte_ohne_index", []core.AttrInfo{id, text})
+	stemmed := cs.CreateRelation("texte_mit_stammformen", []core.AttrInfo{id, text})
+	for i, value := range texte {
+		for _, rel := range []core.Relationer{indexed, scanned, stemmed} {
+			rel.Insert([][]interface{}{{i + 1, value}})
+		}
+	}
+	indexed.CreateFullTextIndex("texte_text", text, core.DefaultTokenizer)
+	stemmed.CreateFullTextIndex("texte_text_stamm", text, core.Tokenizer{Split: core.WORDS, Lowercase: true, Stemming: true})
+
+	tests := []struct {
+		name     string
+		rel      core.Relationer
+		pred     core.Predicate
+		expected []int
+	}{
+		{"rot", indexed, core.Match(text, "rot"), []int{2, 4}},
+		{"rot grün", indexed, core.Match(text, "rot grün"), []int{4}},
+		{"HAUS OR boot", indexed, core.Match(text, "HAUS OR boot"), []int{1, 3}},
+		{`phrase "hell blau"`, indexed, core.Match(text, `"hell blau"`), []int{5}},
+		{`phrase "blau hell"`, indexed, core.Match(text, `"blau hell"`), []int{6}},
+		{"ein", indexed, core.Match(text, "ein"), []int{3}},
+		{"blau OR phrase", indexed, core.Match(text, `blau OR "rotes auto"`), []int{3, 5, 6}},
+		{"unknown token", indexed, core.Match(text, "fehlt"), []int{}},
+		{"And", indexed, core.And(core.Match(text, "blau"), core.Compare(id, core.GT, 5)), []int{6}},
+		{"Or", indexed, core.Or(core.Match(text, "haus"), core.Compare(id, core.EQ, 8)), []int{1, 8}},
+		{"Not", indexed, core.Not(core.Match(text, "blau OR rot")), []int{1, 3, 8}},
+		{"stemmed häuser", stemmed, core.Match(text, "häuser"), []int{1, 2}},
+		{"stemmed rote", stemmed, core.Match(text, "rote"), []int{1, 2, 3, 4}},
+	}
+	for _, test := range tests {
+		got := intValues(test.rel.SelectWhere(test.pred), 0)
+		if fmt.Sprint(got) != fmt.Sprint(test.expected) {
+			t.Errorf("%s returned the rows %v instead of %v.", test.name, got, test.expected)
+		}
+		if test.rel == indexed {
+			if reference := intValues(scanned.SelectWhere(test.pred), 0); fmt.Sprint(got) != fmt.Sprint(reference) {
+				t.Errorf("%s returned the rows %v with index and %v without index.", test.name, got, reference)
+			}
+		}
+	}
+	if plan := indexed.IndexScanWhere(core.Match(text, "rot")).Explain(); strings.Contains(plan, "no index") {
+		t.Errorf("The Match query does not use the FULLTEXT index:\n%s", plan)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+	Package crashtest simulates crashes of the stores of the module in its tests. Only packages
+	of the module can import it, so the stores of other programs never crash on purpose.
+*/
+package crashtest
+
+import (
+	"errors"
+	"sync"
+)
+
+/*
+	The panic value of a simulated crash.
+*/
+var ErrCrashed = errors.New("simulated crash of the store")
+
+// The crashes of the store directories that did not happen yet.
+var (
+	crashes   = make(map[string]*crash)
+	crashesMu sync.Mutex
+)
+
+// The write at which the store of a directory crashes and the writes counted so far.
+type crash struct {
+	after  int
+	writes int
+}
+
+/*
+	Makes the store of the directory crash after the passed number of writes to it. The last
+	write is torn after half of its bytes, then the store panics with ErrCrashed and fails all
+	later writes. Only the next crash is simulated, a store opening the directory afterwards
+	recovers it. 0 disables the crash.
+*/
+func AfterWrites(dir string, writes int) {
+	crashesMu.Lock()
+	defer crashesMu.Unlock()
+	delete(crashes, dir)
+	if writes > 0 {
+		crashes[dir] = &crash{after: writes}
+	}
+}
+
+/*
+	Counts a write to the directory and reports if the simulated crash happens at it.
+*/
+func Crashes(dir string) bool {
+	crashesMu.Lock()
+	defer crashesMu.Unlock()
+	c, ok := crashes[dir]
+	if !ok {
+		return false
+	}
+	c.writes++
+	if c.writes < c.after {
+		return false
+	}
+	delete(crashes, dir)
+	return true
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"testing"
+)
+
+// Checks that queries building indexes for themselves leave the catalog of the relations
+// unchanged and return the rows of the joins without indexes.
+func TestQueriesKeepCatalog(t *testing.T) {
+	cs := new(core.ColumnStore)
+	cs.Load("students.csv", ',')
+	cs.Load("noten.csv", ',')
+	noten := cs.GetRelation("noten")
+	durchschnitt, note := core.AttrInfo{Name: "Durchschnitt"}, core.AttrInfo{Name: "Note"}
+
+	for _, comp := range []core.Comparison{core.EQ, core.LE, core.GT} {
+		expected := countRows(cs.NestedLoopJoin("students", durchschnitt, "noten", note, comp))
+		if got := countRows(cs.IndexRangeJoin("students", durchschnitt, "noten", note, comp)); got != expected {
+			t.Errorf("The index nested loop join with %s returned %d rows instead of %d.", comp, got, expected)
+		}
+		if got := countRows(noten.Indexes()); got != 0 {
+			t.Fatalf("The join with %s added %d indexes to the catalog.", comp, got)
+		}
+	}
+
+	// indexes of the catalog are used and not added again
+	noten.CreateIndex("noten_note", note, core.ORDERED)
+	cs.IndexRangeJoin("students", durchschnitt, "noten", note, core.LE).Materialize()
+	cs.IndexNestedLoopJoin("students", durchschnitt, "noten", note).Materialize()
+	if got := countRows(noten.Indexes()); got != 1 {
+		t.Fatalf("The joins changed the catalog to %d indexes.", got)
+	}
+}
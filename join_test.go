@@ -2,6 +2,9 @@ package main
 
 import (
 	"ColumnStore/core"
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -10,7 +13,7 @@ func BenchmarkHashJoin_StudentsNoten(b *testing.B) {
     cs.Load("students.csv", ',')
     cs.Load("noten.csv", ',')
     for i := 0; i < b.N; i++ {
-        cs.HashJoin("students", core.AttrInfo{Name: "Durchschnitt"}, "noten", core.AttrInfo{Name: "Note"}, core.LE)
+        cs.HashJoin("students", core.AttrInfo{Name: "Durchschnitt"}, "noten", core.AttrInfo{Name: "Note"}, core.LE).Materialize()
     }
 }
 
@@ -19,7 +22,7 @@ func BenchmarkHashJoin_StudentsNamen(b *testing.B) {
     cs.Load("students.csv", ',')
     cs.Load("haeufige_namen.csv", ',')
     for i := 0; i < b.N; i++ {
-        cs.HashJoin("students", core.AttrInfo{Name: "Vorname"}, "haeufige_namen", core.AttrInfo{Name: "Vorname"}, core.EQ)
+        cs.HashJoin("students", core.AttrInfo{Name: "Vorname"}, "haeufige_namen", core.AttrInfo{Name: "Vorname"}, core.EQ).Materialize()
     }
 }
 
@@ -28,7 +31,7 @@ func BenchmarkHashJoin_VornamenNachnamen(b *testing.B) {
     cs.Load("vornamen.csv", ',')
     cs.Load("nachnamen.csv", ',')
     for i := 0; i < b.N; i++ {
-        cs.HashJoin("vornamen", core.AttrInfo{Name:"ID"}, "nachnamen", core.AttrInfo{Name:"ID"}, core.EQ)
+        cs.HashJoin("vornamen", core.AttrInfo{Name:"ID"}, "nachnamen", core.AttrInfo{Name:"ID"}, core.EQ).Materialize()
     }
 }
 
@@ -37,7 +40,7 @@ func BenchmarkParallelHashJoin_StudentsNoten(b *testing.B) {
     cs.Load("students.csv", ',')
     cs.Load("noten.csv", ',')
     for i := 0; i < b.N; i++ {
-        cs.ParallelHashJoin("students", core.AttrInfo{Name: "Durchschnitt"}, "noten", core.AttrInfo{Name: "Note"}, core.LE)
+        cs.ParallelHashJoin("students", core.AttrInfo{Name: "Durchschnitt"}, "noten", core.AttrInfo{Name: "Note"}, core.LE).Materialize()
     }
 }
 
@@ -46,7 +49,7 @@ func BenchmarkParallelHashJoin_StudentsNamen(b *testing.B) {
     cs.Load("students.csv", ',')
     cs.Load("haeufige_namen.csv", ',')
     for i := 0; i < b.N; i++ {
-        cs.ParallelHashJoin("students", core.AttrInfo{Name: "Vorname"}, "haeufige_namen", core.AttrInfo{Name: "Vorname"}, core.EQ)
+        cs.ParallelHashJoin("students", core.AttrInfo{Name: "Vorname"}, "haeufige_namen", core.AttrInfo{Name: "Vorname"}, core.EQ).Materialize()
     }
 }
 
@@ -55,6 +58,253 @@ func BenchmarkParallelHashJoin_VornamenNachnamen(b *testing.B) {
     cs.Load("vornamen.csv", ',')
     cs.Load("nachnamen.csv", ',')
     for i := 0; i < b.N; i++ {
-        cs.ParallelHashJoin("vornamen", core.AttrInfo{Name:"ID"}, "nachnamen", core.AttrInfo{Name:"ID"}, core.EQ)
+        cs.ParallelHashJoin("vornamen", core.AttrInfo{Name:"ID"}, "nachnamen", core.AttrInfo{Name:"ID"}, core.EQ).Materialize()
     }
 }
+
+func BenchmarkMultiJoin_StudentsVornamenNoten(b *testing.B) {
+	var cs = new(core.ColumnStore)
+    relations := map[string]core.Relationer{
+        "students": cs.Load("students.csv", ','),
+        "vornamen": cs.Load("vornamen.csv", ','),
+        "noten":    cs.Load("noten.csv", ','),
+    }
+    preds := []core.JoinPredicate{
+        {LeftRelation: "students", Left: core.AttrInfo{Name: "ID"}, Comp: core.EQ, RightRelation: "vornamen", Right: core.AttrInfo{Name: "ID"}},
+        {LeftRelation: "noten", Left: core.AttrInfo{Name: "Note"}, Comp: core.LT, RightRelation: "students", Right: core.AttrInfo{Name: "Durchschnitt"}},
+    }
+    for i := 0; i < b.N; i++ {
+        cs.MultiJoin(relations, preds).Materialize()
+    }
+}
+
+func BenchmarkIndexRangeJoin_StudentsNoten(b *testing.B) {
+	var cs = new(core.ColumnStore)
+    cs.Load("students.csv", ',')
+    cs.Load("noten.csv", ',')
+    for i := 0; i < b.N; i++ {
+        cs.IndexRangeJoin("students", core.AttrInfo{Name: "Durchschnitt"}, "noten", core.AttrInfo{Name: "Note"}, core.LE).Materialize()
+    }
+}
+
+var (
+	bestellungID     = core.AttrInfo{Name: "ID", Type: core.INT}
+	bestellungKunde  = core.AttrInfo{Name: "Kunde", Type: core.INT}
+	bestellungBetrag = core.AttrInfo{Name: "Betrag", Type: core.INT}
+	kundeLimit       = core.AttrInfo{Name: "Limit", Type: core.INT}
+)
+
+// Returns the rows as sorted texts, so rows produced in different orders can be compared.
+func sortedRows(rows [][]interface{}) []string {
+	texts := make([]string, len(rows))
+	for i, row := range rows {
+		texts[i] = fmt.Sprint(row)
+	}
+	sort.Strings(texts)
+	return texts
+}
+
+// Checks if "left comp right" holds for two INT values, comparisons with NULL values are false.
+func compareInts(left interface{}, comp core.Comparison, right interface{}) bool {
+	l, lok := left.(int)
+	r, rok := right.(int)
+	if !lok || !rok {
+		return false
+	}
+	switch comp {
+	case core.EQ:
+		return l == r
+	case core.NEQ:
+		return l != r
+	case core.LT:
+		return l < r
+	case core.LE:
+		return l <= r
+	case core.GT:
+		return l > r
+	}
+	return l >= r
+}
+
+// Joins the rows with two nested loops like the join of the passed kind, unmatched rows of LEFT
+// joins have NULL values for the right columns.
+func referenceJoin(left, right [][]interface{}, lcol int, comp core.Comparison, rcol int, kind core.JoinKind) [][]interface{} {
+	result := make([][]interface{}, 0)
+	for _, l := range left {
+		matched := false
+		for _, r := range right {
+			if !compareInts(l[lcol], comp, r[rcol]) {
+				continue
+			}
+			matched = true
+			if kind == core.INNER || kind == core.LEFT {
+				result = append(result, append(append([]interface{}{}, l...), r...))
+			}
+		}
+		switch {
+		case kind == core.SEMI && matched, kind == core.ANTI && !matched:
+			result = append(result, l)
+		case kind == core.LEFT && !matched:
+			result = append(result, append(append([]interface{}{}, l...), make([]interface{}, len(right[0]))...))
+		}
+	}
+	return result
+}
+
+// Creates the relations "bestellungen" and "kunden" with NULL keys and customers with several
+// rows. The customers 1 to n have a limit of 10 times their number.
+func createBestellungen(cs *core.ColumnStore, kunden int) (core.Relationer, core.Relationer) {
+	bestellungen := cs.CreateRelation("bestellungen", []core.AttrInfo{bestellungID, bestellungKunde, bestellungBetrag})
+	for i := 1; i <= 12; i++ {
+		var kunde interface{} = i % 6
+		if i%5 == 0 {
+			kunde = nil
+		}
+		bestellungen.Insert([][]interface{}{{i, kunde, i * 7 % 50}})
+	}
+	kundenRel := cs.CreateRelation("kunden", []core.AttrInfo{bestellungKunde, kundeLimit})
+	for k := 1; k <= kunden; k++ {
+		kundenRel.Insert([][]interface{}{{k, k * 10}})
+	}
+	kundenRel.Insert([][]interface{}{{2, 45}, {nil, 30}})
+	return bestellungen, kundenRel
+}
+
+// Checks the joins of every kind against nested loops over the rows of both relations.
+func TestJoinKinds(t *testing.T) {
+	cs := new(core.ColumnStore)
+	bestellungen, kunden := createBestellungen(cs, 4)
+	left, right := rowValues(bestellungen), rowValues(kunden)
+
+	conditions := []struct {
+		cond       core.JoinCondition
+		lcol, rcol int
+	}{
+		{core.JoinCondition{Left: bestellungKunde, Comp: core.EQ, Right: bestellungKunde}, 1, 0},
+		{core.JoinCondition{Left: bestellungBetrag, Comp: core.LE, Right: kundeLimit}, 2, 1},
+		{core.JoinCondition{Left: bestellungBetrag, Comp: core.GT, Right: kundeLimit}, 2, 1},
+		{core.JoinCondition{Left: bestellungKunde, Comp: core.NEQ, Right: bestellungKunde}, 1, 0},
+	}
+	for _, c := range conditions {
+		for _, kind := range []core.JoinKind{core.INNER, core.LEFT, core.SEMI, core.ANTI} {
+			query := fmt.Sprintf("%s join on %s %s %s", kind, c.cond.Left.Name, c.cond.Comp, c.cond.Right.Name)
+			got := sortedRows(rowValues(cs.Join(bestellungen, kunden, c.cond, kind)))
+			expected := sortedRows(referenceJoin(left, right, c.lcol, c.cond.Comp, c.rcol, kind))
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("The %s returned %v instead of %v.", query, got, expected)
+			}
+		}
+	}
+
+	// the joins with a chosen algorithm join the rows where "right value comp left value" holds,
+	// hash joins on other comparisons than EQ return the rows of the nested loops and hash joins
+	// on EQ put the columns of the relation with less keys, here "kunden", first
+	legacyJoins := map[string]func(string, core.AttrInfo, string, core.AttrInfo, core.Comparison) core.Relationer{
+		"NestedLoopJoin":   cs.NestedLoopJoin,
+		"HashJoin":         cs.HashJoin,
+		"ParallelHashJoin": cs.ParallelHashJoin,
+	}
+	flipped := map[core.Comparison]core.Comparison{core.EQ: core.EQ, core.LE: core.GE, core.GT: core.LT}
+	for name, join := range legacyJoins {
+		for _, comp := range []core.Comparison{core.EQ, core.LE, core.GT} {
+			got := sortedRows(rowValues(join("bestellungen", bestellungBetrag, "kunden", kundeLimit, comp)))
+			expected := sortedRows(referenceJoin(left, right, 2, flipped[comp], 1, core.INNER))
+			if name != "NestedLoopJoin" && comp == core.EQ {
+				expected = sortedRows(referenceJoin(right, left, 1, core.EQ, 2, core.INNER))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("The %s on Limit %s Betrag returned %v instead of %v.", name, comp, got, expected)
+			}
+		}
+	}
+}
+
+// Checks the algorithms chosen by the optimizer from the comparison, the sizes of the inputs and
+// their indexes, and that every choice returns the rows of the nested loops.
+func TestJoinAlgorithmChoice(t *testing.T) {
+	equal := core.JoinCondition{Left: bestellungKunde, Comp: core.EQ, Right: bestellungKunde}
+	lower := core.JoinCondition{Left: bestellungBetrag, Comp: core.LE, Right: kundeLimit}
+	tests := []struct {
+		name    string
+		kunden  int
+		index   core.IndexKind
+		cond    core.JoinCondition
+		lcol    int
+		rcol    int
+		// the operator expected in the plan and the build side, the right relation is the second
+		expected string
+	}{
+		{"equal keys", 4, "", equal, 1, 0, "HashJoin INNER on Kunde == Kunde, build: second"},
+		{"equal keys, large right relation", 1000, "", equal, 1, 0, "HashJoin INNER on Kunde == Kunde, build: first"},
+		{"equal keys, hash index on the large relation", 1000, core.HASH, equal, 1, 0, "IndexNestedLoopJoin INNER on Kunde == Kunde"},
+		{"range", 4, "", lower, 2, 1, "NestedLoopJoin INNER on Betrag <= Limit"},
+		{"range, hash index", 1000, core.HASH, lower, 2, 1, "NestedLoopJoin INNER on Betrag <= Limit"},
+		{"range, ordered index on the large relation", 1000, core.ORDERED, lower, 2, 1, "IndexNestedLoopJoin INNER on Betrag <= Limit"},
+	}
+	for _, test := range tests {
+		cs := new(core.ColumnStore)
+		bestellungen, kunden := createBestellungen(cs, test.kunden)
+		if test.index != "" {
+			kunden.MakeIndex(test.cond.Right, test.index)
+		}
+		join := cs.Join(bestellungen, kunden, test.cond, core.INNER)
+		if plan := join.Explain(); !strings.Contains(plan, test.expected) {
+			t.Errorf("%s: the plan does not contain %q:\n%s", test.name, test.expected, plan)
+		}
+		got := sortedRows(rowValues(join))
+		expected := sortedRows(referenceJoin(rowValues(bestellungen), rowValues(kunden), test.lcol, test.cond.Comp, test.rcol, core.INNER))
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%s: the join returned %d rows instead of %d.", test.name, len(got), len(expected))
+		}
+	}
+}
+
+// Checks multi-way joins against nested loops, with several predicates between two relations
+// and a selection pushed into an input, and with more relations than dynamic programming orders.
+func TestMultiJoin(t *testing.T) {
+	cs := new(core.ColumnStore)
+	bestellungen, kunden := createBestellungen(cs, 4)
+	rabatte := cs.CreateRelation("rabatte", []core.AttrInfo{bestellungKunde, {Name: "Prozent", Type: core.INT}})
+	rabatte.Insert([][]interface{}{{1, 5}, {2, 10}, {2, 15}, {4, 20}, {nil, 50}})
+
+	join := cs.MultiJoin(map[string]core.Relationer{"b": bestellungen, "k": kunden, "r": rabatte}, []core.JoinPredicate{
+		{LeftRelation: "b", Left: bestellungKunde, Comp: core.EQ, RightRelation: "k", Right: bestellungKunde},
+		{LeftRelation: "r", Left: bestellungKunde, Comp: core.EQ, RightRelation: "k", Right: bestellungKunde},
+		{LeftRelation: "b", Left: bestellungBetrag, Comp: core.LE, RightRelation: "k", Right: kundeLimit},
+	}).
+		Select(core.AttrInfo{Name: "r.Prozent"}, core.GE, 10).
+		Scan([]core.AttrInfo{{Name: "b.ID"}, {Name: "k.Limit"}, {Name: "r.Prozent"}})
+	expected := make([][]interface{}, 0)
+	for _, b := range rowValues(bestellungen) {
+		for _, k := range rowValues(kunden) {
+			for _, r := range rowValues(rabatte) {
+				if compareInts(b[1], core.EQ, k[0]) && compareInts(r[0], core.EQ, k[0]) && compareInts(b[2], core.LE, k[1]) && r[1].(int) >= 10 {
+					expected = append(expected, []interface{}{b[0], k[1], r[1]})
+				}
+			}
+		}
+	}
+	if got := sortedRows(rowValues(join)); fmt.Sprint(got) != fmt.Sprint(sortedRows(expected)) {
+		t.Errorf("The join of three relations returned %v instead of %v.\n%s", got, sortedRows(expected), join.Explain())
+	}
+
+	// a chain of relations, the relation i has the keys 1 to i+2, so only the keys 1 to 3 are joined
+	relations := make(map[string]core.Relationer)
+	preds := make([]core.JoinPredicate, 0)
+	key := core.AttrInfo{Name: "Key", Type: core.INT}
+	for i := 1; i <= 12; i++ {
+		name := fmt.Sprintf("r%d", i)
+		rel := cs.CreateRelation(name, []core.AttrInfo{key})
+		for k := 1; k <= i+2; k++ {
+			rel.Insert([][]interface{}{{k}})
+		}
+		relations[name] = rel
+		if i > 1 {
+			preds = append(preds, core.JoinPredicate{LeftRelation: fmt.Sprintf("r%d", i-1), Left: key, Comp: core.EQ, RightRelation: name, Right: key})
+		}
+	}
+	chain := cs.MultiJoin(relations, preds).Scan([]core.AttrInfo{{Name: "r12.Key"}})
+	if got := intValues(chain.OrderBy(core.AttrInfo{Name: "r12.Key"}, false), 0); fmt.Sprint(got) != "[1 2 3]" {
+		t.Errorf("The chain of 12 relations returned the keys %v instead of [1 2 3].", got)
+	}
+}
@@ -3,6 +3,10 @@ package main
 import (
 	"ColumnStore/core"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func test_session_1(cs *core.ColumnStore) {
@@ -126,6 +130,297 @@ func test_session_3(cs *core.ColumnStore) {
         Print()
 }
 
+func test_session_4(cs *core.ColumnStore) {
+	students_rel := cs.GetRelation("students")
+
+	fmt.Println("========================= SESSION 4 =========================")
+
+	fmt.Println("Studenten mit 1.2 <= Durchschnitt < 2.5 und 21 < Alter <= 24 (SelectWhere)")
+	students_rel.
+		SelectWhere(core.And(
+			core.Compare(core.AttrInfo{Name: "Durchschnitt"}, core.GE, 1.2),
+			core.Compare(core.AttrInfo{Name: "Durchschnitt"}, core.LT, 2.5),
+			core.Not(core.Between(core.AttrInfo{Name: "Alter"}, 0, 21)),
+			core.Compare(core.AttrInfo{Name: "Alter"}, core.LE, 24))).
+		Print()
+
+	fmt.Println("Studenten mit ID in (1, 3, 5) oder Alter < 20")
+	students_rel.
+		SelectWhere(core.Or(
+			core.In(core.AttrInfo{Name: "ID"}, 1, 3, 5),
+			core.Compare(core.AttrInfo{Name: "Alter"}, core.LT, 20))).
+		Print()
+
+	fmt.Println("Studenten, deren Nachname mit M beginnt")
+	students_rel.
+		Select(core.AttrInfo{Name: "Nachname"}, core.STARTS_WITH, "M").
+		Print()
+
+	fmt.Println("Studenten, deren Nachname wie 'M_yer' ist")
+	students_rel.
+		Select(core.AttrInfo{Name: "Nachname"}, core.LIKE, "M_yer").
+		Print()
+
+	fmt.Println("Studenten, deren Vorname 'al' enthält (ILIKE)")
+	students_rel.
+		Select(core.AttrInfo{Name: "Vorname"}, core.ILIKE, "%al%").
+		Scan([]core.AttrInfo{{Name: "ID"}, {Name: "Vorname"}}).
+		Print()
+}
+
+func test_session_5(cs *core.ColumnStore) {
+	students_rel := cs.GetRelation("students")
+
+	fmt.Println("========================= SESSION 5 =========================")
+
+	fmt.Println("Studenten sortiert nach Nachname (de-DE)")
+	students_rel.
+		Collate(core.AttrInfo{Name: "Nachname"}, core.DE_DE).
+		OrderBy(core.AttrInfo{Name: "Nachname"}, false).
+		Scan([]core.AttrInfo{{Name: "ID"}, {Name: "Nachname"}}).
+		Print()
+
+	fmt.Println("Studenten mit Nachname == mueller (de-DE-phonebook)")
+	students_rel.
+		Collate(core.AttrInfo{Name: "Nachname"}, core.DE_DE_PHONEBOOK).
+		Select(core.AttrInfo{Name: "Nachname"}, core.EQ, "mueller").
+		Print()
+}
+
+func test_session_6(cs *core.ColumnStore) {
+	students_rel := cs.GetRelation("students")
+
+	fmt.Println("========================= SESSION 6 =========================")
+
+	fmt.Println("Berechnete Spalten")
+	students_rel.
+		Project([]core.NamedExpr{
+			{Name: "ID", Expr: core.Col("ID")},
+			{Name: "Name", Expr: core.Concat(core.Upper(core.Col("Nachname")), core.Const(", "), core.Substring(core.Col("Vorname"), core.Const(1), core.Const(1)), core.Const("."))},
+			{Name: "Geburtsjahr", Expr: core.Sub(core.Const(2022), core.Col("Alter"))},
+			{Name: "Durchschnitt / (Alter - 20)", Expr: core.Div(core.Col("Durchschnitt"), core.Sub(core.Col("Alter"), core.Const(20)))},
+			{Name: "Bewertung", Expr: core.Case([]core.When{
+				{Cond: core.Compare(core.AttrInfo{Name: "Durchschnitt"}, core.LT, 1.5), Then: core.Const("sehr gut")},
+				{Cond: core.Compare(core.AttrInfo{Name: "Durchschnitt"}, core.LT, 2.5), Then: core.Const("gut")},
+			}, nil)},
+			{Name: "Alter (Text)", Expr: core.Cast(core.Col("Alter"), core.STRING)},
+		}).
+		Print()
+
+	fmt.Println("Typfehler werden vor der Ausführung erkannt")
+	_, err := students_rel.ProjectChecked([]core.NamedExpr{{Name: "Fehler", Expr: core.Add(core.Col("Nachname"), core.Const(1))}})
+	fmt.Println(err)
+	_, err = students_rel.ProjectChecked([]core.NamedExpr{{Name: "Fehler", Expr: core.Case([]core.When{
+		{Cond: core.Compare(core.AttrInfo{Name: "ID"}, core.EQ, "eins"), Then: core.Const(1)},
+	}, core.Const(0))}})
+	fmt.Println(err)
+}
+
+func test_session_7(cs *core.ColumnStore) {
+	students_rel := cs.GetRelation("students")
+
+	fmt.Println("========================= SESSION 7 =========================")
+
+	// nothing is computed until the plan reaches a sink
+	plan := students_rel.
+		Select(core.AttrInfo{Name: "Alter"}, core.GT, 21).
+		Scan([]core.AttrInfo{{Name: "ID"}, {Name: "Nachname"}, {Name: "Durchschnitt"}})
+
+	fmt.Println("Batches der Studenten älter als 21")
+	it := plan.Iterator()
+	it.Open()
+	for batch := it.Next(); batch != nil; batch = it.Next() {
+		fmt.Printf("Batch mit %d Zeilen\n", batch.RowCount())
+	}
+	it.Close()
+
+	fmt.Println("Materialisiertes Ergebnis")
+	result := plan.Materialize()
+	result.Select(core.AttrInfo{Name: "Durchschnitt"}, core.LT, 2.0).Print()
+
+	fmt.Println("Exportiertes und wieder geladenes Ergebnis")
+	file := filepath.Join(os.TempDir(), "aeltere_studenten.csv")
+	defer os.Remove(file)
+	plan.Export(file, ',')
+	cs.Load(file, ',').Print()
+}
+
+func test_session_8(cs *core.ColumnStore) {
+	students_rel := cs.GetRelation("students")
+	noten_rel := cs.GetRelation("noten")
+	namen_rel := cs.GetRelation("haeufige_namen")
+	vornamen_rel := cs.GetRelation("vornamen")
+
+	fmt.Println("========================= SESSION 8 =========================")
+
+	fmt.Println("Studenten mit häufigem Vornamen (Algorithmus vom Optimierer gewählt)")
+	join := cs.Join(students_rel, namen_rel, core.JoinCondition{Left: core.AttrInfo{Name: "Vorname"}, Comp: core.EQ, Right: core.AttrInfo{Name: "Vorname"}}, core.SEMI)
+	fmt.Print(join.Explain())
+	join.Scan([]core.AttrInfo{{Name: "ID"}, {Name: "Vorname"}}).Print()
+
+	fmt.Println("Noten, die Studenten über 22 erreicht haben")
+	join = cs.Join(students_rel, noten_rel, core.JoinCondition{Left: core.AttrInfo{Name: "Durchschnitt"}, Comp: core.LE, Right: core.AttrInfo{Name: "Note"}}, core.INNER).
+		Select(core.AttrInfo{Name: "Alter"}, core.GT, 22).
+		Scan([]core.AttrInfo{{Name: "ID"}, {Name: "Durchschnitt"}, {Name: "Note"}})
+	fmt.Print(join.Explain())
+
+	fmt.Println("Alle Studenten mit Vornamen aus der Vornamen Relation, sonst NULL")
+	join = cs.Join(students_rel, vornamen_rel, core.JoinCondition{Left: core.AttrInfo{Name: "ID"}, Comp: core.EQ, Right: core.AttrInfo{Name: "ID"}}, core.LEFT).
+		Scan([]core.AttrInfo{{Name: "ID"}, {Name: "Nachname"}, {Name: "Vorname (right)"}})
+	fmt.Print(join.Explain())
+	join.Print()
+}
+
+func test_session_9(cs *core.ColumnStore) {
+	relations := map[string]core.Relationer{
+		"students": cs.GetRelation("students"),
+		"vornamen": cs.GetRelation("vornamen"),
+		"noten":    cs.GetRelation("noten"),
+	}
+
+	fmt.Println("========================= SESSION 9 =========================")
+
+	fmt.Println("Studenten mit Vornamen aus der Vornamen Relation und Noten, die besser als ihr Durchschnitt sind")
+	join := cs.MultiJoin(relations, []core.JoinPredicate{
+		{LeftRelation: "students", Left: core.AttrInfo{Name: "ID"}, Comp: core.EQ, RightRelation: "vornamen", Right: core.AttrInfo{Name: "ID"}},
+		{LeftRelation: "noten", Left: core.AttrInfo{Name: "Note"}, Comp: core.LT, RightRelation: "students", Right: core.AttrInfo{Name: "Durchschnitt"}},
+	}).
+		Select(core.AttrInfo{Name: "students.Alter"}, core.GT, 20).
+		Scan([]core.AttrInfo{{Name: "students.ID"}, {Name: "vornamen.Vorname"}, {Name: "students.Durchschnitt"}, {Name: "noten.Note"}})
+	fmt.Print(join.Explain())
+	join.Print()
+}
+
+func test_session_10(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 10 =========================")
+
+	fmt.Println("Laufzeit der Operatoren von HashJoin, Scan, MakeIndex und IndexScan")
+	plan := cs.
+		HashJoin("students", core.AttrInfo{Name: "Durchschnitt"}, "noten", core.AttrInfo{Name: "Note"}, core.LE).
+		Scan([]core.AttrInfo{{Name: "ID"}, {Name: "Vorname"}, {Name: "Nachname"}, {Name: "Beschreibung"}}).
+		MakeIndex(core.AttrInfo{Name: "Beschreibung"}).
+		IndexScan(core.AttrInfo{Name: "Beschreibung"}, "gut")
+	fmt.Print(plan.ExplainAnalyze())
+
+	fmt.Println("Plan als JSON")
+	fmt.Print(plan.ExplainJSON())
+}
+
+func test_session_11(cs *core.ColumnStore) {
+	students_rel := cs.GetRelation("students")
+
+	fmt.Println("========================= SESSION 11 =========================")
+
+	fmt.Println("Statistiken der Studenten Relation")
+	students_rel.Analyze().Print()
+
+	fmt.Println("Geschätzte Zeilen mit Statistiken")
+	fmt.Print(students_rel.
+		SelectWhere(core.And(core.Compare(core.AttrInfo{Name: "Alter"}, core.GT, 20), core.Between(core.AttrInfo{Name: "Durchschnitt"}, 1.5, 2.5))).
+		Explain())
+}
+
+func test_session_12(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 12 =========================")
+
+	file := filepath.Join(os.TempDir(), "matrikel.csv")
+	defer os.Remove(file)
+	var builder strings.Builder
+	builder.WriteString("ID,Semester\n")
+	for i := 0; i < 300000; i++ {
+		fmt.Fprintf(&builder, "%d,%d\n", i, i%12+1)
+	}
+	if err := os.WriteFile(file, []byte(builder.String()), 0644); err != nil {
+		fmt.Println(err)
+		return
+	}
+	matrikel_rel := cs.Load(file, ',')
+
+	fmt.Println("Matrikelnummern unter 1000 (übersprungene Blöcke)")
+	fmt.Print(matrikel_rel.Select(core.AttrInfo{Name: "ID"}, core.LT, 1000).Explain())
+
+	fmt.Println("Matrikelnummern im dritten Semester")
+	fmt.Print(matrikel_rel.Select(core.AttrInfo{Name: "Semester"}, core.EQ, 3).Explain())
+}
+
+func test_session_13(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 13 =========================")
+	students_rel := cs.GetRelation("students")
+	students_rel.MakeIndex(core.AttrInfo{Name: "Alter"}, core.ORDERED)
+
+	fmt.Println("Studenten mit 21 <= Alter <= 24 (geordneter Index)")
+	students_rel.IndexScanWhere(core.Between(core.AttrInfo{Name: "Alter"}, 21, 24)).Print()
+
+	fmt.Println("Studenten älter als 25 (geordneter Index)")
+	scan := students_rel.IndexScanWhere(core.Compare(core.AttrInfo{Name: "Alter"}, core.GT, 25))
+	fmt.Print(scan.Explain())
+	scan.Print()
+
+	fmt.Println("Studenten sortiert nach Alter (geordneter Index)")
+	students_rel.OrderBy(core.AttrInfo{Name: "Alter"}, false).Print()
+
+	fmt.Println("Noten, die nicht schlechter als der Durchschnitt sind (Index Nested Loop Join mit <=)")
+	cs.IndexRangeJoin("students", core.AttrInfo{Name: "Durchschnitt"}, "noten", core.AttrInfo{Name: "Note"}, core.LE).Print()
+}
+
+func test_session_14(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 14 =========================")
+	students_rel := cs.GetRelation("students")
+	students_rel.MakeIndex(core.AttrInfo{Name: "Alter"}, core.BITMAP)
+	alter := core.AttrInfo{Name: "Alter"}
+
+	fmt.Println("Studenten mit Alter 20 oder 27 (Bitmap Index)")
+	both := students_rel.SelectWhere(core.Or(core.Compare(alter, core.EQ, 20), core.Compare(alter, core.EQ, 27)))
+	fmt.Print(both.Explain())
+	both.Print()
+
+	fmt.Println("Studenten nicht älter als 22 und nicht 20 mit Durchschnitt < 2.0 (Bitmap Index und Select)")
+	mixed := students_rel.SelectWhere(core.And(
+		core.Not(core.Or(core.Compare(alter, core.GT, 22), core.Compare(alter, core.EQ, 20))),
+		core.Compare(core.AttrInfo{Name: "Durchschnitt"}, core.LT, 2.0),
+	))
+	fmt.Print(mixed.Explain())
+	mixed.Print()
+}
+
+func test_session_15(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 15 =========================")
+	noten_rel := cs.GetRelation("noten")
+	noten_rel.CreateIndex("noten_beschreibung", core.AttrInfo{Name: "Beschreibung"}, core.HASH)
+	noten_rel.MakeIndex(core.AttrInfo{Name: "Note"}, core.ORDERED)
+
+	fmt.Println("Indexe der Noten Relation")
+	noten_rel.Indexes().Print()
+
+	fmt.Println("Indexe der Studenten Relation")
+	cs.GetRelation("students").Indexes().Print()
+
+	fmt.Println("IndexScan auf Noten/Beschreibung mit \"gut\" nach dem Löschen des Index")
+	noten_rel.DropIndex("noten_beschreibung")
+	scan := noten_rel.IndexScan(core.AttrInfo{Name: "Beschreibung"}, "gut")
+	fmt.Print(scan.Explain())
+	scan.Print()
+}
+
+func test_session_16(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 16 =========================")
+	dir, err := os.MkdirTemp("", "columnstore")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	cs.Save(dir)
+
+	opened := new(core.ColumnStore)
+	opened.Open(dir)
+	fmt.Println("Indexe der gespeicherten Studenten Relation")
+	opened.GetRelation("students").Indexes().Print()
+
+	fmt.Println("Studenten mit 21 <= Alter <= 24 aus der gespeicherten Relation (geordneter Index)")
+	opened.GetRelation("students").IndexScanWhere(core.Between(core.AttrInfo{Name: "Alter"}, 21, 24)).Print()
+}
+
 func main() {
 	var cs = new(core.ColumnStore)
     fmt.Println("Studentend Relation")
@@ -142,4 +437,186 @@ func main() {
     test_session_1(cs)
     test_session_2(cs)
     test_session_3(cs)
+    test_session_4(cs)
+    test_session_5(cs)
+    test_session_6(cs)
+    test_session_7(cs)
+    test_session_8(cs)
+    test_session_9(cs)
+    test_session_10(cs)
+    test_session_11(cs)
+    test_session_12(cs)
+    test_session_13(cs)
+    test_session_14(cs)
+    test_session_15(cs)
+    test_session_16(cs)
+    test_session_17(cs)
+    test_session_18(cs)
+    test_session_19(cs)
+    test_session_20(cs)
+    test_session_21(cs)
+    test_session_22(cs)
+}
+
+func test_session_17(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 17 =========================")
+
+	file := filepath.Join(os.TempDir(), "vorlesungen.csv")
+	defer os.Remove(file)
+	lines := []string{
+		"ID,Beschreibung",
+		"1,Einführung in Datenbanken und relationale Algebra",
+		"2,Spaltenorientierte Datenbanken: Kompression und Indexe",
+		"3,Verteilte Systeme und Datenbank-Replikation",
+		"4,Algorithmen und Datenstrukturen für Indexe",
+		"5,Relationale Algebra für Fortgeschrittene",
+	}
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		fmt.Println(err)
+		return
+	}
+	vorlesungen_rel := cs.Load(file, ',')
+	beschreibung := core.AttrInfo{Name: "Beschreibung"}
+	vorlesungen_rel.CreateFullTextIndex("vorlesungen_text", beschreibung,
+		core.Tokenizer{Split: core.WORDS, Lowercase: true, Stemming: true})
+
+	fmt.Println("Vorlesungen über Datenbanken und Indexe (Volltextindex mit Stammformen)")
+	vorlesungen_rel.SelectWhere(core.Match(beschreibung, "datenbank index")).Print()
+
+	fmt.Println("Vorlesungen mit der Phrase \"relationale Algebra\" oder über Replikation")
+	scan := vorlesungen_rel.SelectWhere(core.Match(beschreibung, "\"relationale Algebra\" OR Replikation"))
+	fmt.Print(scan.Explain())
+	scan.Print()
+
+	fmt.Println("Vorlesungen über Algebra mit ID > 2 (Volltextindex und Select)")
+	mixed := vorlesungen_rel.SelectWhere(core.And(core.Match(beschreibung, "algebra"), core.Compare(core.AttrInfo{Name: "ID"}, core.GT, 2)))
+	fmt.Print(mixed.Explain())
+	mixed.Print()
+}
+
+func test_session_18(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 18 =========================")
+
+	id := core.AttrInfo{Name: "ID", Type: core.INT}
+	name := core.AttrInfo{Name: "Name", Type: core.STRING}
+	semester := core.AttrInfo{Name: "Semester", Type: core.INT}
+	hoerer_rel := cs.CreateRelation("hoerer", []core.AttrInfo{id, name, semester})
+	hoerer_rel.CreateIndex("hoerer_semester", semester, core.BITMAP)
+
+	fmt.Println("Hörer nach Insert")
+	hoerer_rel.Insert([][]interface{}{
+		{1, "Anna", 3},
+		{2, "Ben", 1},
+		{3, "Clara", nil},
+		{4, "David", 5},
+	})
+	hoerer_rel.Print()
+
+	fmt.Println("Hörer nach InsertColumns")
+	batch := hoerer_rel.SelectWhere(core.Compare(id, core.LE, 2)).Project([]core.NamedExpr{
+		{Name: "ID", Expr: core.Add(core.Col("ID"), core.Const(10))},
+		{Name: "Name", Expr: core.Upper(core.Col("Name"))},
+		{Name: "Semester", Expr: core.Col("Semester")},
+	}).Iterator()
+	batch.Open()
+	for b := batch.Next(); b != nil; b = batch.Next() {
+		hoerer_rel.InsertColumns(b)
+	}
+	batch.Close()
+	hoerer_rel.Print()
+
+	fmt.Println("Hörer nach Update: ein Semester mehr für alle im ersten Semester")
+	hoerer_rel.Update(core.Compare(semester, core.EQ, 1), []core.NamedExpr{{Name: "Semester", Expr: core.Add(core.Col("Semester"), core.Const(1))}})
+	hoerer_rel.Print()
+
+	fmt.Println("Hörer nach Delete der Hörer ohne Semester")
+	hoerer_rel.Delete(core.IsNull(semester))
+	hoerer_rel.IndexScanWhere(core.Compare(semester, core.GE, 2)).Print()
+	hoerer_rel.Indexes().Print()
+}
+
+func test_session_19(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 19 =========================")
+
+	dir, err := os.MkdirTemp("", "columnstore-")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// the changes of the opened store are written into the log of the directory
+	store := new(core.ColumnStore)
+	store.Open(dir)
+	semester := core.AttrInfo{Name: "Semester", Type: core.INT}
+	kurse_rel := store.CreateRelation("kurse", []core.AttrInfo{{Name: "Kurs", Type: core.STRING}, semester})
+	kurse_rel.Insert([][]interface{}{{"Datenbanken", 3}, {"Compilerbau", 5}, {"Algorithmen", 2}})
+	kurse_rel.CreateIndex("kurse_semester", semester, core.ORDERED)
+	store.Save(dir)
+	kurse_rel.Update(core.Compare(semester, core.EQ, 5), []core.NamedExpr{{Name: "Semester", Expr: core.Const(4)}})
+	kurse_rel.Delete(core.Compare(semester, core.LT, 3))
+
+	// a new store replays the changes after the checkpoint of Save like after a crash
+	fmt.Println("Kurse nach dem Wiederherstellen aus dem Log")
+	recovered := new(core.ColumnStore)
+	recovered.Open(dir)
+	recovered.GetRelation("kurse").IndexScanWhere(core.Compare(semester, core.GE, 3)).Print()
+	recovered.GetRelation("kurse").Indexes().Print()
+}
+
+func test_session_20(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 20 =========================")
+
+	store := new(core.ColumnStore)
+	platz := core.AttrInfo{Name: "Platz", Type: core.INT}
+	plaetze_rel := store.CreateRelation("plaetze", []core.AttrInfo{platz, {Name: "Gebucht", Type: core.STRING}})
+	plaetze_rel.Insert([][]interface{}{{1, nil}, {2, nil}, {3, nil}})
+
+	// both transactions book the same seat, the second commit conflicts with the first
+	anna, ben := store.Begin(), store.Begin()
+	frei := core.And(core.Compare(platz, core.EQ, 2), core.IsNull(core.AttrInfo{Name: "Gebucht"}))
+	anna.GetRelation("plaetze").Update(frei, []core.NamedExpr{{Name: "Gebucht", Expr: core.Const("Anna")}})
+	ben.GetRelation("plaetze").Update(frei, []core.NamedExpr{{Name: "Gebucht", Expr: core.Const("Ben")}})
+	fmt.Println("Plaetze in der Transaktion von Ben")
+	ben.GetRelation("plaetze").Print()
+	fmt.Println("Commit von Anna:", anna.Commit())
+	fmt.Println("Commit von Ben:", ben.Commit())
+	plaetze_rel.Print()
+}
+
+func test_session_21(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 21 =========================")
+
+	store := new(core.ColumnStore)
+	preis := core.AttrInfo{Name: "Preis", Type: core.INT}
+	buecher_rel := store.CreateRelation("buecher", []core.AttrInfo{{Name: "Titel", Type: core.STRING}, preis})
+	buecher_rel.CreateIndex("buecher_preis", preis, core.ORDERED)
+	buecher_rel.Insert([][]interface{}{{"Datenbanksysteme", 45}, {"Compilerbau", 60}})
+
+	// the inserted rows are read from the delta until they are merged into the main columns
+	for _, buch := range [][]interface{}{{"Algorithmen", 30}, {"Betriebssysteme", 50}, {"Rechnernetze", 40}} {
+		buecher_rel.Insert([][]interface{}{buch})
+	}
+	fmt.Println("Buecher mit Preis >= 40 nach dem Preis geordnet")
+	buecher_rel.IndexScanWhere(core.Compare(preis, core.GE, 40)).Print()
+	buecher_rel.Indexes().Print()
+}
+
+func test_session_22(cs *core.ColumnStore) {
+	fmt.Println("========================= SESSION 22 =========================")
+
+	store := new(core.ColumnStore)
+	note := core.AttrInfo{Name: "Note", Type: core.FLOAT}
+	pruefungen_rel := store.CreateRelation("pruefungen", []core.AttrInfo{{Name: "Student", Type: core.STRING}, note})
+	pruefungen_rel.Insert([][]interface{}{{"Anna", 1.3}, {"Ben", 2.7}, {"Clara", 4.0}})
+	vorher := time.Now()
+
+	// the changes are recorded as versions, older versions stay readable
+	pruefungen_rel.Update(core.Compare(note, core.EQ, 4.0), []core.NamedExpr{{Name: "Note", Expr: core.Const(3.3)}})
+	pruefungen_rel.Delete(core.Compare(note, core.GT, 2.0))
+	fmt.Println("Pruefungen vor den Aenderungen")
+	store.GetRelationAsOf("pruefungen", vorher).OrderBy(note, false).Print()
+	fmt.Println("Pruefungen nach dem Update")
+	store.GetRelationAtCommit("pruefungen", 3).Print()
+	store.Snapshots().Scan([]core.AttrInfo{{Name: "Relation"}, {Name: "Commit"}, {Name: "Rows"}}).Print()
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// The changes of query results, the test process runs the one named by MODIFY_QUERY_RESULT.
+var queryResultChanges = map[string]func(query core.Relationer){
+	"Insert":      func(query core.Relationer) { query.Insert([][]interface{}{{100, 1.5, "Bremen"}}) },
+	"Update":      func(query core.Relationer) { query.Update(core.Compare(messungID, core.EQ, 3), nil) },
+	"Delete":      func(query core.Relationer) { query.Delete(core.Compare(messungID, core.LT, 5)) },
+	"CreateIndex": func(query core.Relationer) { query.CreateIndex("messungen_id", messungID, core.HASH) },
+	"DropIndex":   func(query core.Relationer) { query.DropIndex("messungen_wert") },
+}
+
+// Checks that changes of the results of queries exit with an error instead of changing a copy
+// of the result without notice.
+func TestModifyingQueryResultsExits(t *testing.T) {
+	if name := os.Getenv("MODIFY_QUERY_RESULT"); name != "" {
+		cs := new(core.ColumnStore)
+		messungen := createMessungen(cs)
+		messungen.CreateIndex("messungen_wert", messungWert, core.ORDERED)
+		queryResultChanges[name](messungen.Select(messungID, core.GT, 2))
+		return
+	}
+
+	for name := range queryResultChanges {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestModifyingQueryResultsExits$")
+		cmd.Env = append(os.Environ(), "MODIFY_QUERY_RESULT="+name)
+		output, err := cmd.CombinedOutput()
+		if _, exited := err.(*exec.ExitError); !exited || !strings.Contains(string(output), name+" needs a relation") {
+			t.Errorf("%s of a query result did not exit with an error: %v\n%s", name, err, output)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"strings"
+	"testing"
+)
+
+// Returns the indentation of the first line of the plan containing the passed text, -1 if no
+// line contains it. The inputs of an operator are indented deeper than the operator.
+func explainDepth(plan string, text string) int {
+	for _, line := range strings.Split(plan, "\n") {
+		if strings.Contains(line, text) {
+			return len(line) - len(strings.TrimLeft(line, " "))
+		}
+	}
+	return -1
+}
+
+// Checks that the rewritten plans return the rows of the same queries whose operators are
+// separated by Materialize, so no rule can move an operator across it, and that the rules
+// were applied as shown by Explain.
+func TestOptimizerRewrites(t *testing.T) {
+	cs := new(core.ColumnStore)
+	students := cs.Load("students.csv", ',')
+	noten := cs.Load("noten.csv", ',')
+	vornamen := cs.Load("vornamen.csv", ',')
+	alter := core.AttrInfo{Name: "Alter"}
+	durchschnitt := core.AttrInfo{Name: "Durchschnitt"}
+	bewertet := func() core.Relationer {
+		return cs.Join(students, noten, core.JoinCondition{Left: durchschnitt, Comp: core.LE, Right: core.AttrInfo{Name: "Note"}}, core.INNER)
+	}
+	benannt := func() core.Relationer {
+		return cs.Join(students, vornamen, core.JoinCondition{Left: core.AttrInfo{Name: "ID"}, Comp: core.EQ, Right: core.AttrInfo{Name: "ID"}}, core.LEFT)
+	}
+	idNote := []core.AttrInfo{{Name: "ID"}, {Name: "Note"}}
+
+	tests := []struct {
+		name      string
+		query     core.Relationer
+		reference core.Relationer
+		// the operators of Explain containing the first text are below the one containing the second
+		below    [2]string
+		contains string
+	}{
+		{name: "selection pushed below the join",
+			query:     bewertet().Select(alter, core.GT, 22),
+			reference: bewertet().Materialize().Select(alter, core.GT, 22),
+			below:     [2]string{"Select on Alter", "Join INNER"}},
+		{name: "consecutive selections merged",
+			query:     students.Select(alter, core.GT, 20).Select(durchschnitt, core.LT, 2.5),
+			reference: students.Select(alter, core.GT, 20).Materialize().Select(durchschnitt, core.LT, 2.5),
+			contains:  "Select on Alter, Durchschnitt"},
+		{name: "columns pruned below the join",
+			query:     bewertet().Scan(idNote),
+			reference: bewertet().Materialize().Scan(idNote),
+			below:     [2]string{"Scan ID, Durchschnitt", "Join INNER"}},
+		{name: "selection on the right input of a LEFT join kept above it",
+			query:     benannt().SelectWhere(core.IsNull(core.AttrInfo{Name: "Vorname (right)"})),
+			reference: benannt().Materialize().SelectWhere(core.IsNull(core.AttrInfo{Name: "Vorname (right)"})),
+			below:     [2]string{"Join LEFT", "Select on Vorname (right)"}},
+		{name: "selection pushed below the order",
+			query:     students.OrderBy(alter, true).Select(durchschnitt, core.LT, 2.0),
+			reference: students.OrderBy(alter, true).Materialize().Select(durchschnitt, core.LT, 2.0),
+			below:     [2]string{"Select on Durchschnitt", "OrderBy Alter"}},
+		{name: "constants folded",
+			query: students.Project([]core.NamedExpr{
+				{Name: "ID", Expr: core.Col("ID")},
+				{Name: "Alter", Expr: core.Add(core.Mul(core.Const(2), core.Const(3)), core.Col("Alter"))},
+			}).Select(alter, core.GT, 28),
+			reference: students.Project([]core.NamedExpr{
+				{Name: "ID", Expr: core.Col("ID")},
+				{Name: "Alter", Expr: core.Add(core.Col("Alter"), core.Const(6))},
+			}).Materialize().Select(alter, core.GT, 28)},
+	}
+	for _, test := range tests {
+		checkRows(t, test.name, rowValues(test.query), rowValues(test.reference))
+		plan := test.query.Explain()
+		if test.contains != "" && !strings.Contains(plan, test.contains) {
+			t.Errorf("%s: the plan does not contain %q:\n%s", test.name, test.contains, plan)
+		}
+		if test.below[0] != "" {
+			lower, upper := explainDepth(plan, test.below[0]), explainDepth(plan, test.below[1])
+			if lower == -1 || upper == -1 || lower <= upper {
+				t.Errorf("%s: %q is not below %q:\n%s", test.name, test.below[0], test.below[1], plan)
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var (
+	messungID   = core.AttrInfo{Name: "ID", Type: core.INT}
+	messungWert = core.AttrInfo{Name: "Wert", Type: core.FLOAT}
+	messungOrt  = core.AttrInfo{Name: "Ort", Type: core.STRING}
+)
+
+// Returns the values of all rows of the relationer, NULL values are nil.
+func rowValues(rel core.Relationer) [][]interface{} {
+	it := rel.Iterator()
+	it.Open()
+	defer it.Close()
+	rows := make([][]interface{}, 0)
+	for batch := it.Next(); batch != nil; batch = it.Next() {
+		for row := 0; row < batch.RowCount(); row++ {
+			values := make([]interface{}, len(batch.Columns))
+			for col := range batch.Columns {
+				values[col] = batch.Value(col, row)
+			}
+			rows = append(rows, values)
+		}
+	}
+	return rows
+}
+
+// Returns the rows accepted by the passed function in their order.
+func filterValues(rows [][]interface{}, accept func(row []interface{}) bool) [][]interface{} {
+	result := make([][]interface{}, 0)
+	for _, row := range rows {
+		if accept(row) {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+// Fails if the rows of the query differ from the expected rows.
+func checkRows(t *testing.T, query string, got, expected [][]interface{}) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("%s returned %d rows %v instead of %d rows %v.", query, len(got), got, len(expected), expected)
+	}
+}
+
+// Creates the relation "messungen" whose columns have NULL values in some rows.
+func createMessungen(cs *core.ColumnStore) core.Relationer {
+	messungen := cs.CreateRelation("messungen", []core.AttrInfo{messungID, messungWert, messungOrt})
+	orte := []string{"Berlin", "Köln", "München", "Hamburg"}
+	for i := 1; i <= 30; i++ {
+		row := []interface{}{i, float64(i*7%40) + 0.5, orte[i%len(orte)]}
+		if i%5 == 0 {
+			row[1] = nil
+		}
+		if i%7 == 0 {
+			row[2] = nil
+		}
+		messungen.Insert([][]interface{}{row})
+	}
+	return messungen
+}
+
+// Checks the compound predicates of SelectWhere against the rows filtered one by one. Comparisons
+// with NULL values are unknown, so neither they nor their negations return the rows.
+func TestCompoundPredicates(t *testing.T) {
+	cs := new(core.ColumnStore)
+	messungen := createMessungen(cs)
+	all := rowValues(messungen)
+	wert := func(row []interface{}) (float64, bool) {
+		value, ok := row[1].(float64)
+		return value, ok
+	}
+	id := func(row []interface{}) int { return row[0].(int) }
+
+	tests := []struct {
+		name     string
+		pred     core.Predicate
+		expected func(row []interface{}) bool
+	}{
+		{"And", core.And(core.Compare(messungID, core.GT, 5), core.Compare(messungWert, core.LT, 20.0)),
+			func(row []interface{}) bool { w, ok := wert(row); return id(row) > 5 && ok && w < 20 }},
+		{"Or", core.Or(core.In(messungOrt, "Berlin", "Köln"), core.Between(messungID, 20, 25)),
+			func(row []interface{}) bool {
+				return row[2] == "Berlin" || row[2] == "Köln" || (id(row) >= 20 && id(row) <= 25)
+			}},
+		{"Not", core.Not(core.Compare(messungWert, core.GE, 30.0)),
+			func(row []interface{}) bool { w, ok := wert(row); return ok && w < 30 }},
+		{"Not of Not", core.Not(core.Not(core.Compare(messungWert, core.GE, 30.0))),
+			func(row []interface{}) bool { w, ok := wert(row); return ok && w >= 30 }},
+		{"Not of And", core.Not(core.And(core.Compare(messungWert, core.GE, 30.0), core.Compare(messungID, core.GT, 25))),
+			func(row []interface{}) bool { w, ok := wert(row); return ok && w < 30 || id(row) <= 25 }},
+		{"Not of Or", core.Not(core.Or(core.Compare(messungWert, core.GE, 30.0), core.Compare(messungOrt, core.EQ, "Berlin"))),
+			func(row []interface{}) bool {
+				w, ok := wert(row)
+				return ok && w < 30 && row[2] != nil && row[2] != "Berlin"
+			}},
+		{"IsNull", core.IsNull(messungWert),
+			func(row []interface{}) bool { return row[1] == nil }},
+		{"Not IsNull", core.Not(core.IsNull(messungOrt)),
+			func(row []interface{}) bool { return row[2] != nil }},
+		{"In with NULL values", core.In(messungOrt, "München", "Bremen"),
+			func(row []interface{}) bool { return row[2] == "München" }},
+		{"nested", core.And(core.Not(core.Or(core.IsNull(messungWert), core.Compare(messungOrt, core.EQ, "Hamburg"))), core.Compare(messungID, core.LE, 20)),
+			func(row []interface{}) bool {
+				return row[1] != nil && row[2] != nil && row[2] != "Hamburg" && id(row) <= 20
+			}},
+		{"empty And", core.And(core.Compare(messungID, core.GT, 30), core.IsNull(messungOrt)),
+			func(row []interface{}) bool { return false }},
+		{"Or of NULL tests", core.Or(core.IsNull(messungWert), core.IsNull(messungOrt)),
+			func(row []interface{}) bool { return row[1] == nil || row[2] == nil }},
+	}
+	for _, test := range tests {
+		checkRows(t, test.name, rowValues(messungen.SelectWhere(test.pred)), filterValues(all, test.expected))
+	}
+
+	// a conjunction of comparisons returns the rows of the chained selections
+	chained := messungen.Select(messungWert, core.GE, 10.0).Select(messungID, core.LT, 25)
+	conjunction := messungen.SelectWhere(core.And(core.Compare(messungWert, core.GE, 10.0), core.Compare(messungID, core.LT, 25)))
+	checkRows(t, "And of comparisons", rowValues(conjunction), rowValues(chained))
+}
+
+// Checks the pattern comparisons against the names filtered one by one, also after the cache
+// of the compiled patterns evicted them.
+func TestPatternComparisons(t *testing.T) {
+	cs := new(core.ColumnStore)
+	name := core.AttrInfo{Name: "Name", Type: core.STRING}
+	namen := cs.CreateRelation("namen", []core.AttrInfo{name})
+	for _, n := range []interface{}{"Müller", "müller", "Mueller", "Meier", "Maier", "Ärger", "ärgerlich", "100%", "10_0", "a.b", "axb", `a\b`, "", nil} {
+		namen.Insert([][]interface{}{{n}})
+	}
+	all := rowValues(namen)
+	matching := func(accept func(string) bool) func(row []interface{}) bool {
+		return func(row []interface{}) bool {
+			value, ok := row[0].(string)
+			return ok && accept(value)
+		}
+	}
+
+	tests := []struct {
+		comp     core.Comparison
+		pattern  string
+		expected func(string) bool
+	}{
+		{core.LIKE, "M%er", func(n string) bool { return strings.HasPrefix(n, "M") && strings.HasSuffix(n, "er") }},
+		{core.LIKE, "M_ier", func(n string) bool { return n == "Meier" || n == "Maier" }},
+		{core.LIKE, "%", func(n string) bool { return true }},
+		{core.LIKE, "_", func(n string) bool { return false }},
+		{core.LIKE, "a.b", func(n string) bool { return n == "a.b" }},
+		{core.LIKE, "10_%", func(n string) bool { return n == "10_0" || n == "100%" }},
+		{core.LIKE, `10\_%`, func(n string) bool { return n == "10_0" }},
+		{core.LIKE, `%\%`, func(n string) bool { return n == "100%" }},
+		{core.LIKE, `a\\b`, func(n string) bool { return n == `a\b` }},
+		{core.ILIKE, `%0\%`, func(n string) bool { return n == "100%" }},
+		{core.ILIKE, "mü%", func(n string) bool { return strings.HasPrefix(strings.ToLower(n), "mü") }},
+		{core.ILIKE, "ärger%", func(n string) bool { return strings.HasPrefix(strings.ToLower(n), "ärger") }},
+		{core.STARTS_WITH, "Mü", func(n string) bool { return strings.HasPrefix(n, "Mü") }},
+		{core.STARTS_WITH, "", func(n string) bool { return true }},
+		{core.CONTAINS, "ll", func(n string) bool { return strings.Contains(n, "ll") }},
+		{core.CONTAINS, "%", func(n string) bool { return strings.Contains(n, "%") }},
+		{core.REGEXP, "^M[ae]i?er$", func(n string) bool { return n == "Meier" || n == "Maier" }},
+		{core.REGEXP, "^a.b$", func(n string) bool { return n == "a.b" || n == "axb" || n == `a\b` }},
+		{core.REGEXP, "(?i)^m(ü|ue)ller$", func(n string) bool { return strings.HasSuffix(strings.ToLower(n), "ller") }},
+	}
+	check := func() {
+		t.Helper()
+		for _, test := range tests {
+			query := fmt.Sprintf("%s '%s'", test.comp, test.pattern)
+			expected := filterValues(all, matching(test.expected))
+			checkRows(t, query, rowValues(namen.Select(name, test.comp, test.pattern)), expected)
+			checkRows(t, query+" of SelectWhere", rowValues(namen.SelectWhere(core.Compare(name, test.comp, test.pattern))), expected)
+		}
+	}
+	check()
+	// more distinct patterns than the cache keeps, so the patterns above are compiled again
+	for i := 0; i < 300; i++ {
+		namen.Select(name, core.REGEXP, fmt.Sprintf("^x%d$", i)).Materialize()
+	}
+	check()
+
+	// the results of the distinct values are kept for all batches of a query
+	viele := cs.CreateRelation("viele", []core.AttrInfo{name})
+	values := make([][]interface{}, 5000)
+	for i := range values {
+		values[i] = all[i%len(all)]
+	}
+	viele.Insert(values)
+	for _, comp := range []core.Comparison{core.LIKE, core.ILIKE} {
+		query := viele.SelectWhere(core.Or(core.Compare(name, comp, "M%er"), core.Compare(name, comp, `%\%`)))
+		expected := filterValues(values, matching(func(n string) bool {
+			return comp == core.ILIKE && strings.HasPrefix(strings.ToLower(n), "m") && strings.HasSuffix(n, "er") ||
+				strings.HasPrefix(n, "M") && strings.HasSuffix(n, "er") || strings.HasSuffix(n, "%")
+		}))
+		checkRows(t, fmt.Sprintf("%s on several batches", comp), rowValues(query), expected)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"ColumnStore/internal/crashtest"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// A change of the recovery test made by one call of the store.
+type recoveryChange struct {
+	creates string // the name of the relation created by the change
+	change  func(cs *core.ColumnStore, dir string)
+}
+
+var (
+	hoererID       = core.AttrInfo{Name: "ID", Type: core.INT}
+	hoererName     = core.AttrInfo{Name: "Name", Type: core.STRING}
+	hoererSemester = core.AttrInfo{Name: "Semester", Type: core.INT}
+)
+
+// The changes of the recovery test. The store is saved into its directory in between, which
+// writes checkpoints, the changes expecting the state without store directory skip saving.
+var recoveryChanges = []recoveryChange{
+	{"noten", func(cs *core.ColumnStore, dir string) { cs.Load("noten.csv", ',') }},
+	{"hoerer", func(cs *core.ColumnStore, dir string) {
+		cs.CreateRelation("hoerer", []core.AttrInfo{hoererID, hoererName, hoererSemester})
+	}},
+	{"", func(cs *core.ColumnStore, dir string) {
+		cs.GetRelation("hoerer").Insert([][]interface{}{{1, "Anna", 3}, {2, "Ben", 1}, {3, "Clara", nil}, {4, "David", 5}})
+	}},
+	{"", func(cs *core.ColumnStore, dir string) {
+		cs.GetRelation("hoerer").CreateIndex("hoerer_semester", hoererSemester, core.BITMAP)
+	}},
+	{"", func(cs *core.ColumnStore, dir string) { cs.GetRelation("hoerer").MakeIndex(hoererID, core.ORDERED) }},
+	{"", func(cs *core.ColumnStore, dir string) {
+		cs.GetRelation("hoerer").Update(core.Compare(hoererSemester, core.LT, 4),
+			[]core.NamedExpr{{Name: "Semester", Expr: core.Add(core.Col("Semester"), core.Const(1))}})
+	}},
+	{"", saveStore},
+	{"", func(cs *core.ColumnStore, dir string) {
+		cs.GetRelation("noten").Delete(core.Compare(core.AttrInfo{Name: "Note"}, core.GT, 2.0))
+	}},
+	{"", func(cs *core.ColumnStore, dir string) { cs.GetRelation("hoerer").SetCollation(hoererName, core.NOCASE) }},
+	{"", func(cs *core.ColumnStore, dir string) {
+		cs.GetRelation("hoerer").CreateFullTextIndex("hoerer_name", hoererName, core.DefaultTokenizer)
+	}},
+	{"", func(cs *core.ColumnStore, dir string) {
+		cs.GetRelation("hoerer").Insert([][]interface{}{{5, "emil", 2}, {6, "Frieda", nil}})
+	}},
+	{"", func(cs *core.ColumnStore, dir string) { cs.GetRelation("hoerer").DropIndex("hoerer_semester") }},
+	{"", func(cs *core.ColumnStore, dir string) { cs.GetRelation("hoerer").Delete(core.IsNull(hoererSemester)) }},
+	{"", saveStore},
+	{"", func(cs *core.ColumnStore, dir string) {
+		cs.GetRelation("hoerer").Insert([][]interface{}{{7, "Gustav", 1}})
+	}},
+	{"gaeste", func(cs *core.ColumnStore, dir string) {
+		cs.CreateRelation("gaeste", []core.AttrInfo{hoererID, hoererName, hoererSemester})
+	}},
+	{"", func(cs *core.ColumnStore, dir string) {
+		cs.GetRelation("gaeste").Insert([][]interface{}{{8, "Hanna", 1}})
+	}},
+	{"gaeste", func(cs *core.ColumnStore, dir string) {
+		cs.CreateRelation("gaeste", []core.AttrInfo{hoererID, hoererName})
+	}},
+	{"", func(cs *core.ColumnStore, dir string) {
+		cs.GetRelation("gaeste").Insert([][]interface{}{{9, "Ida"}})
+	}},
+}
+
+func saveStore(cs *core.ColumnStore, dir string) {
+	if dir != "" {
+		cs.Save(dir)
+	}
+}
+
+// Makes the changes and returns the number of completed changes. A simulated crash stops the
+// changes, other panics fail the test.
+func makeChanges(changes []recoveryChange, cs *core.ColumnStore, dir string) (completed int, crashed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != crashtest.ErrCrashed {
+				panic(r)
+			}
+			crashed = true
+		}
+	}()
+	for _, c := range changes {
+		c.change(cs, dir)
+		completed++
+	}
+	return completed, false
+}
+
+// Returns the rows and indexes of the relations created by the changes as text.
+func dumpRelations(cs *core.ColumnStore, changes []recoveryChange) string {
+	var builder strings.Builder
+	seen := make(map[string]bool)
+	for _, c := range changes {
+		if c.creates == "" || seen[c.creates] {
+			continue
+		}
+		seen[c.creates] = true
+		rel := cs.GetRelation(c.creates)
+		// the keys of the indexes depend on the merged rows, so the delta is merged first
+		rel.(*core.Relation).MergeDelta()
+		for _, part := range []core.Relationer{rel, rel.Indexes()} {
+			fmt.Fprintln(&builder, c.creates, part.Iterator().Schema())
+			it := part.Iterator()
+			it.Open()
+			for batch := it.Next(); batch != nil; batch = it.Next() {
+				for row := 0; row < batch.RowCount(); row++ {
+					for col := range batch.Columns {
+						fmt.Fprint(&builder, batch.Value(col, row), " ")
+					}
+					fmt.Fprintln(&builder)
+				}
+			}
+			it.Close()
+		}
+	}
+	return builder.String()
+}
+
+// Returns the state after the first changes made on a store without directory.
+func expectedState(completed int) string {
+	cs := new(core.ColumnStore)
+	makeChanges(recoveryChanges[:completed], cs, "")
+	return dumpRelations(cs, recoveryChanges[:completed])
+}
+
+// Crashes the store at every write to its directory and checks that opening the directory
+// restores the state after the completed changes, and that the remaining changes can be made
+// on the restored store and are restored as well.
+func TestRecoveryAfterCrashes(t *testing.T) {
+	final := expectedState(len(recoveryChanges))
+	for writes := 1; ; writes++ {
+		dir := t.TempDir()
+		cs := new(core.ColumnStore)
+		cs.Open(dir)
+		crashtest.AfterWrites(dir, writes)
+		completed, crashed := makeChanges(recoveryChanges, cs, dir)
+		if !crashed {
+			if writes < len(recoveryChanges) {
+				t.Fatalf("The changes made only %d writes.", writes)
+			}
+			break
+		}
+
+		recovered := new(core.ColumnStore)
+		recovered.Open(dir)
+		if got, want := dumpRelations(recovered, recoveryChanges[:completed]), expectedState(completed); got != want {
+			t.Fatalf("Crash at write %d after %d changes, recovered:\n%s\nexpected:\n%s", writes, completed, got, want)
+		}
+		makeChanges(recoveryChanges[completed:], recovered, dir)
+		reopened := new(core.ColumnStore)
+		reopened.Open(dir)
+		if got := dumpRelations(reopened, recoveryChanges); got != final {
+			t.Fatalf("Crash at write %d, changes after the recovery:\n%s\nexpected:\n%s", writes, got, final)
+		}
+	}
+}
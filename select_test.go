@@ -0,0 +1,133 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func BenchmarkSelect_Students(b *testing.B) {
+	var cs = new(core.ColumnStore)
+	cs.Load("students.csv", ',')
+	students := cs.GetRelation("students")
+	for i := 0; i < b.N; i++ {
+		students.Select(core.AttrInfo{Name: "Durchschnitt"}, core.LT, 2.0).Materialize()
+	}
+}
+
+func BenchmarkSelectChain_Students(b *testing.B) {
+	var cs = new(core.ColumnStore)
+	cs.Load("students.csv", ',')
+	students := cs.GetRelation("students")
+	for i := 0; i < b.N; i++ {
+		students.
+			Select(core.AttrInfo{Name: "Durchschnitt"}, core.GE, 1.2).
+			Select(core.AttrInfo{Name: "Durchschnitt"}, core.LT, 2.5).
+			Select(core.AttrInfo{Name: "Alter"}, core.GT, 21).
+			Select(core.AttrInfo{Name: "Alter"}, core.LE, 24).Materialize()
+	}
+}
+
+// Writes a relation with the passed number of rows into a csv file and loads it.
+// Returns the name of the loaded relation.
+func loadLarge(b *testing.B, cs *core.ColumnStore, name string, rows int) string {
+	relName := filepath.Join(b.TempDir(), name)
+	file := relName + ".csv"
+	var builder strings.Builder
+	builder.WriteString("ID,Gruppe,Wert,Name\n")
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&builder, "%d,%d,%d.%d,Name%d\n", i, i%100, i%1000, i%10, i%5000)
+	}
+	if err := os.WriteFile(file, []byte(builder.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	cs.Load(file, ',')
+	return relName
+}
+
+func BenchmarkSelectChain_Large(b *testing.B) {
+	var cs = new(core.ColumnStore)
+	large := cs.GetRelation(loadLarge(b, cs, "large", 200000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		large.
+			Select(core.AttrInfo{Name: "Wert"}, core.GE, 100.0).
+			Select(core.AttrInfo{Name: "Wert"}, core.LT, 800.0).
+			Select(core.AttrInfo{Name: "Gruppe"}, core.GT, 10).
+			Select(core.AttrInfo{Name: "Gruppe"}, core.LE, 50).Materialize()
+	}
+}
+
+func BenchmarkSelectRange_Large(b *testing.B) {
+	var cs = new(core.ColumnStore)
+	large := cs.GetRelation(loadLarge(b, cs, "large", 200000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// the IDs are sorted, so only the first block is scanned
+		large.Select(core.AttrInfo{Name: "ID"}, core.LT, 20000).Materialize()
+	}
+}
+
+func BenchmarkIndexScanRange_Large(b *testing.B) {
+	var cs = new(core.ColumnStore)
+	large := cs.GetRelation(loadLarge(b, cs, "large", 200000))
+	large.MakeIndex(core.AttrInfo{Name: "Wert"}, core.ORDERED)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// the unsorted values are found by binary search in the ordered index
+		large.IndexScanWhere(core.Between(core.AttrInfo{Name: "Wert"}, 100.0, 120.0)).Materialize()
+	}
+}
+
+func BenchmarkSelectBitmap_Large(b *testing.B) {
+	var cs = new(core.ColumnStore)
+	large := cs.GetRelation(loadLarge(b, cs, "large", 200000))
+	large.MakeIndex(core.AttrInfo{Name: "Gruppe"}, core.BITMAP)
+	gruppe := core.AttrInfo{Name: "Gruppe"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// the predicate is evaluated on the bitmaps without reading the column
+		large.SelectWhere(core.Or(
+			core.Compare(gruppe, core.EQ, 3),
+			core.And(core.Compare(gruppe, core.GE, 90), core.Not(core.Compare(gruppe, core.EQ, 95))),
+		)).Materialize()
+	}
+}
+
+func BenchmarkHashJoin_Large(b *testing.B) {
+	var cs = new(core.ColumnStore)
+	large := loadLarge(b, cs, "large", 200000)
+	small := loadLarge(b, cs, "small", 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cs.HashJoin(large, core.AttrInfo{Name: "Gruppe"}, small, core.AttrInfo{Name: "ID"}, core.EQ).Materialize()
+	}
+}
+
+func BenchmarkHashJoinSelect_Large(b *testing.B) {
+	var cs = new(core.ColumnStore)
+	large := loadLarge(b, cs, "large", 200000)
+	small := loadLarge(b, cs, "small", 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// the selection on the large relation is evaluated before the join
+		cs.HashJoin(large, core.AttrInfo{Name: "Gruppe"}, small, core.AttrInfo{Name: "ID"}, core.EQ).
+			Select(core.AttrInfo{Name: "ID"}, core.LT, 20000).
+			Scan([]core.AttrInfo{{Name: "ID"}, {Name: "Name"}}).Materialize()
+	}
+}
+
+func BenchmarkJoin_Large(b *testing.B) {
+	var cs = new(core.ColumnStore)
+	large := cs.GetRelation(loadLarge(b, cs, "large", 200000))
+	small := cs.GetRelation(loadLarge(b, cs, "small", 5000))
+	cond := core.JoinCondition{Left: core.AttrInfo{Name: "Gruppe"}, Comp: core.EQ, Right: core.AttrInfo{Name: "ID"}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// the optimizer builds the hash table on the small relation
+		cs.Join(large, small, cond, core.INNER).Materialize()
+	}
+}
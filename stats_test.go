@@ -0,0 +1,174 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	wertID     = core.AttrInfo{Name: "ID", Type: core.INT}
+	wertGruppe = core.AttrInfo{Name: "Gruppe", Type: core.INT}
+	wertName   = core.AttrInfo{Name: "Name", Type: core.STRING}
+)
+
+// Returns the estimated rows of the root operator of the plan.
+func explainRows(plan string) int {
+	match := regexp.MustCompile(`\(rows: (\d+)\)`).FindStringSubmatch(plan)
+	if match == nil {
+		return -1
+	}
+	rows, _ := strconv.Atoi(match[1])
+	return rows
+}
+
+// Creates the relation "werte" with sorted IDs, skewed groups with NULL values and names.
+func createWerte(cs *core.ColumnStore, rows int) core.Relationer {
+	werte := cs.CreateRelation("werte", []core.AttrInfo{wertID, wertGruppe, wertName})
+	values := make([][]interface{}, rows)
+	for i := range values {
+		var gruppe interface{} = i % 7
+		if i%3 == 0 {
+			// the group 0 is the most common one
+			gruppe = 0
+		}
+		if i%10 == 9 {
+			gruppe = nil
+		}
+		values[i] = []interface{}{i + 1, gruppe, fmt.Sprintf("Name%d", i%40)}
+	}
+	werte.Insert(values)
+	return werte
+}
+
+// Returns the statistics of the values of the column as they are listed by Analyze.
+func expectedStats(rows [][]interface{}, col int) []interface{} {
+	values := make([]interface{}, 0)
+	for _, row := range rows {
+		if row[col] != nil {
+			values = append(values, row[col])
+		}
+	}
+	less := func(a, b interface{}) bool {
+		if x, ok := a.(int); ok {
+			return x < b.(int)
+		}
+		return a.(string) < b.(string)
+	}
+	sort.SliceStable(values, func(i, j int) bool { return less(values[i], values[j]) })
+
+	distinct := make([]interface{}, 0)
+	counts := make(map[interface{}]int)
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			distinct = append(distinct, value)
+		}
+		counts[value]++
+	}
+	buckets := len(values)
+	if buckets > 10 {
+		buckets = 10
+	}
+	bounds := make([]string, 0)
+	for b := 1; b <= buckets; b++ {
+		bounds = append(bounds, fmt.Sprint(values[b*len(values)/buckets-1]))
+	}
+	sort.SliceStable(distinct, func(i, j int) bool { return counts[distinct[i]] > counts[distinct[j]] })
+	common := make([]string, 0)
+	for _, value := range distinct {
+		if len(common) == 5 || counts[value] < 2 {
+			break
+		}
+		common = append(common, fmt.Sprintf("%v (%d)", value, counts[value]))
+	}
+	return []interface{}{
+		len(rows), len(rows) - len(values), fmt.Sprint(values[0]), fmt.Sprint(values[len(values)-1]),
+		len(distinct), "true", strings.Join(bounds, ", "), strings.Join(common, ", "),
+	}
+}
+
+// Checks the statistics of Analyze against the values of the scanned rows, also after rows
+// were deleted, and the estimates of the optimizer based on them.
+func TestAnalyze(t *testing.T) {
+	cs := new(core.ColumnStore)
+	werte := createWerte(cs, 200)
+	check := func(state string) {
+		t.Helper()
+		rows := rowValues(werte)
+		stats := rowValues(werte.Analyze())
+		for col := range rows[0] {
+			if got, expected := fmt.Sprint(stats[col][2:]), fmt.Sprint(expectedStats(rows, col)); got != expected {
+				t.Errorf("%s: the statistics of %v are %s instead of %s.", state, stats[col][0], got, expected)
+			}
+		}
+	}
+	check("inserted")
+	werte.Delete(core.Compare(wertGruppe, core.EQ, 0))
+	check("deleted")
+
+	tests := []struct {
+		name string
+		pred core.Predicate
+		// the tolerated difference between the estimated and the actual rows
+		tolerance int
+	}{
+		{"most common value", core.Compare(wertGruppe, core.EQ, 3), 0},
+		{"value above the maximum", core.Compare(wertID, core.GT, 1000), 0},
+		{"NULL values", core.IsNull(wertGruppe), 0},
+		{"range of sorted values", core.Compare(wertID, core.LT, 90), 5},
+		{"range above the minimum", core.Compare(wertID, core.GE, 150), 5},
+	}
+	for _, test := range tests {
+		query := werte.SelectWhere(test.pred)
+		estimated, actual := explainRows(query.Explain()), countRows(query)
+		if math.Abs(float64(estimated-actual)) > float64(test.tolerance) {
+			t.Errorf("%s: %d rows are estimated instead of %d.\n%s", test.name, estimated, actual, query.Explain())
+		}
+	}
+}
+
+// Checks that the distinct values of large columns are estimated and that the estimate is close
+// to the exact number, and that the most common values taken from a sample are close to their
+// exact counts.
+func TestAnalyzeEstimatesDistinctValues(t *testing.T) {
+	cs := new(core.ColumnStore)
+	werte := createWerte(cs, 30000)
+	stats := rowValues(werte.Analyze())
+	if id := stats[0]; id[7] != "false" || math.Abs(float64(id[6].(int)-30000)) > 30000*0.03 {
+		t.Errorf("The distinct IDs are %v with exact %v instead of about 30000 estimated ones.", id[6], id[7])
+	}
+	if gruppe := stats[1]; gruppe[7] != "false" || math.Abs(float64(gruppe[6].(int)-7)) > 1 {
+		t.Errorf("The distinct groups are %v with exact %v instead of about 7 estimated ones.", gruppe[6], gruppe[7])
+	}
+
+	rows := rowValues(werte)
+	for col, name := range []string{"ID", "Gruppe", "Name"} {
+		exact := expectedStats(rows, col)
+		if got := stats[col][2:6]; fmt.Sprint(got) != fmt.Sprint(exact[:4]) {
+			t.Errorf("The rows, NULL values, minimum and maximum of %s are %v instead of %v.", name, got, exact[:4])
+		}
+	}
+	// the group 0 is the most common one
+	zeros := len(filterValues(rows, func(row []interface{}) bool { return row[1] == 0 }))
+	common := strings.Split(stats[1][9].(string), ", ")
+	var value, count int
+	if _, err := fmt.Sscanf(common[0], "%d (%d)", &value, &count); err != nil || value != 0 || math.Abs(float64(count-zeros)) > float64(zeros)*0.03 {
+		t.Errorf("The most common groups are %v instead of about %d times 0 first.", common, zeros)
+	}
+}
+
+// Checks that the distinct values of a column with only NULL values are counted exactly.
+func TestAnalyzeNullColumn(t *testing.T) {
+	cs := new(core.ColumnStore)
+	leer := cs.CreateRelation("leer", []core.AttrInfo{wertID, wertName})
+	leer.Insert([][]interface{}{{1, nil}, {2, nil}, {3, nil}})
+	stats := rowValues(leer.Analyze())
+	if expected := []interface{}{3, 3, nil, nil, 0, "true", "", ""}; fmt.Sprint(stats[1][2:]) != fmt.Sprint(expected) {
+		t.Errorf("The statistics of the NULL column are %v instead of %v.", stats[1][2:], expected)
+	}
+}
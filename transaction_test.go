@@ -0,0 +1,244 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"ColumnStore/internal/crashtest"
+	"errors"
+	"sync"
+	"testing"
+)
+
+var (
+	kontoID    = core.AttrInfo{Name: "ID", Type: core.INT}
+	kontoStand = core.AttrInfo{Name: "Stand", Type: core.INT}
+)
+
+// Creates the relation "konten" with the passed number of accounts holding 100 each.
+func createKonten(cs *core.ColumnStore, accounts int) core.Relationer {
+	rows := make([][]interface{}, accounts)
+	for i := range rows {
+		rows[i] = []interface{}{i + 1, 100}
+	}
+	konten := cs.CreateRelation("konten", []core.AttrInfo{kontoID, kontoStand})
+	konten.Insert(rows)
+	return konten
+}
+
+// Returns the balances of the accounts by their IDs.
+func balances(rel core.Relationer) map[int]int {
+	result := make(map[int]int)
+	it := rel.Iterator()
+	it.Open()
+	defer it.Close()
+	for batch := it.Next(); batch != nil; batch = it.Next() {
+		for row := 0; row < batch.RowCount(); row++ {
+			result[batch.Value(0, row).(int)] = batch.Value(1, row).(int)
+		}
+	}
+	return result
+}
+
+// Moves the amount from one account to another inside the transaction.
+func transfer(tx *core.Transaction, from, to, amount int) {
+	konten := tx.GetRelation("konten")
+	konten.Update(core.Compare(kontoID, core.EQ, from), []core.NamedExpr{{Name: "Stand", Expr: core.Sub(core.Col("Stand"), core.Const(amount))}})
+	konten.Update(core.Compare(kontoID, core.EQ, to), []core.NamedExpr{{Name: "Stand", Expr: core.Add(core.Col("Stand"), core.Const(amount))}})
+}
+
+// Returns the number of rows covered by the index with the passed position in the catalog of
+// the relation, including the deleted rows.
+func indexedRows(rel core.Relationer, index int) int {
+	it := rel.Indexes().Iterator()
+	it.Open()
+	defer it.Close()
+	return it.Next().Value(4, index).(int)
+}
+
+// Checks that transactions see the relations as of their start and their own changes, and that
+// concurrent changes of the same rows conflict.
+func TestTransactionSnapshotIsolation(t *testing.T) {
+	cs := new(core.ColumnStore)
+	konten := createKonten(cs, 3)
+	first, second := cs.Begin(), cs.Begin()
+
+	transfer(first, 1, 2, 30)
+	if got := balances(first.GetRelation("konten")); got[1] != 70 || got[2] != 130 {
+		t.Fatalf("The transaction does not see its own changes: %v", got)
+	}
+	if got := balances(konten); got[1] != 100 || got[2] != 100 {
+		t.Fatalf("The store sees uncommitted changes: %v", got)
+	}
+	if err := first.Commit(); err != nil {
+		t.Fatalf("The commit failed: %s", err)
+	}
+	if got := balances(konten); got[1] != 70 || got[2] != 130 || len(got) != 3 {
+		t.Fatalf("The store does not see the committed changes: %v", got)
+	}
+	if got := balances(second.GetRelation("konten")); got[1] != 100 || got[2] != 100 {
+		t.Fatalf("The running transaction sees changes committed after its start: %v", got)
+	}
+
+	transfer(second, 2, 3, 50)
+	if err := second.Commit(); !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("Changing committed rows returned %v instead of a conflict.", err)
+	}
+	if got := balances(konten); got[2] != 130 || got[3] != 100 {
+		t.Fatalf("The conflicting transaction changed the store: %v", got)
+	}
+
+	// inserts and changes of other rows do not conflict
+	third, fourth := cs.Begin(), cs.Begin()
+	third.GetRelation("konten").Insert([][]interface{}{{4, 10}})
+	fourth.GetRelation("konten").Insert([][]interface{}{{5, 20}})
+	fourth.GetRelation("konten").Delete(core.Compare(kontoID, core.EQ, 3))
+	if err := third.Commit(); err != nil {
+		t.Fatalf("The commit failed: %s", err)
+	}
+	if err := fourth.Commit(); err != nil {
+		t.Fatalf("The commit failed: %s", err)
+	}
+	if got := balances(konten); len(got) != 4 || got[4] != 10 || got[5] != 20 {
+		t.Fatalf("The inserts were not committed: %v", got)
+	}
+
+	rolledBack := cs.Begin()
+	rolledBack.GetRelation("konten").Delete(core.Compare(kontoID, core.GT, 0))
+	rolledBack.Rollback()
+	if got := balances(konten); len(got) != 4 {
+		t.Fatalf("The rolled back transaction changed the store: %v", got)
+	}
+}
+
+// Checks that deleted rows stay in the relation while a transaction started before their
+// deletion runs and are removed once it ended.
+func TestTransactionGarbageCollection(t *testing.T) {
+	cs := new(core.ColumnStore)
+	konten := createKonten(cs, 8)
+	konten.CreateIndex("konten_id", kontoID, core.ORDERED)
+	tx := cs.Begin()
+	konten.Delete(core.Compare(kontoID, core.LE, 4))
+	if got := indexedRows(konten, 0); got != 8 {
+		t.Fatalf("The relation was compacted while a transaction sees the deleted rows, %d rows are indexed.", got)
+	}
+	if got := balances(tx.GetRelation("konten")); len(got) != 8 {
+		t.Fatalf("The transaction lost deleted rows: %v", got)
+	}
+	tx.Rollback()
+	if got := indexedRows(konten, 0); got != 4 {
+		t.Fatalf("The deleted rows were not removed after the transaction ended, %d rows are indexed.", got)
+	}
+	if got := balances(konten); len(got) != 4 || got[5] != 100 {
+		t.Fatalf("The compaction changed the rows: %v", got)
+	}
+}
+
+// The transactions of the recovery test, each changes both relations.
+var transactionChanges = []recoveryChange{
+	{"konten", func(cs *core.ColumnStore, dir string) { createKonten(cs, 4) }},
+	{"buchungen", func(cs *core.ColumnStore, dir string) {
+		cs.CreateRelation("buchungen", []core.AttrInfo{kontoID, {Name: "Betrag", Type: core.INT}})
+	}},
+	{"", func(cs *core.ColumnStore, dir string) { commitTransfer(cs, 1) }},
+	{"", func(cs *core.ColumnStore, dir string) { commitTransfer(cs, 2) }},
+	{"", func(cs *core.ColumnStore, dir string) { commitTransfer(cs, 3) }},
+}
+
+// Commits a transfer from the account to the next one, books it and deletes the last account.
+func commitTransfer(cs *core.ColumnStore, account int) {
+	tx := cs.Begin()
+	transfer(tx, account, account+1, 10*account)
+	tx.GetRelation("buchungen").Insert([][]interface{}{{account, 10 * account}})
+	tx.GetRelation("konten").Delete(core.Compare(kontoID, core.EQ, 4))
+	if err := tx.Commit(); err != nil {
+		panic(err)
+	}
+}
+
+// Crashes the store at every write of the committed transactions and checks that the recovered
+// store contains all or none of the changes of the transaction of the crash.
+func TestTransactionRecovery(t *testing.T) {
+	// the states after the relations are created and after every transaction
+	states := make(map[int]string)
+	for completed := 2; completed <= len(transactionChanges); completed++ {
+		cs := new(core.ColumnStore)
+		makeChanges(transactionChanges[:completed], cs, "")
+		states[completed] = dumpRelations(cs, transactionChanges)
+	}
+	for writes := 1; ; writes++ {
+		dir := t.TempDir()
+		cs := new(core.ColumnStore)
+		cs.Open(dir)
+		crashtest.AfterWrites(dir, writes)
+		completed, crashed := makeChanges(transactionChanges, cs, dir)
+		if !crashed {
+			break
+		}
+		if completed < 2 {
+			// crashes while relations are created are covered by TestRecoveryAfterCrashes
+			continue
+		}
+
+		recovered := new(core.ColumnStore)
+		recovered.Open(dir)
+		// the transaction of the crash is recovered if its commit was logged before the crash
+		if got := dumpRelations(recovered, transactionChanges); got != states[completed] && got != states[completed+1] {
+			t.Fatalf("Crash at write %d after %d changes recovered a partial transaction:\n%s", writes, completed, got)
+		}
+	}
+}
+
+// Transfers amounts between accounts in concurrent transactions, which are retried after
+// conflicts, while other transactions check that they always see the same total. Run with -race.
+func TestConcurrentTransactions(t *testing.T) {
+	cs := new(core.ColumnStore)
+	const accounts = 5
+	konten := createKonten(cs, accounts)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				from, to := (g+i)%accounts+1, (g+2*i+1)%accounts+1
+				if from == to {
+					continue
+				}
+				for {
+					tx := cs.Begin()
+					transfer(tx, from, to, i)
+					err := tx.Commit()
+					if err == nil {
+						break
+					}
+					if !errors.Is(err, core.ErrConflict) {
+						t.Errorf("The commit failed: %s", err)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				tx := cs.Begin()
+				total := 0
+				for _, stand := range balances(tx.GetRelation("konten")) {
+					total += stand
+				}
+				tx.Rollback()
+				if total != 100*accounts {
+					t.Errorf("A transaction sees the total %d instead of %d.", total, 100*accounts)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := balances(konten); len(got) != accounts {
+		t.Fatalf("The accounts changed: %v", got)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"ColumnStore/core"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var (
+	blockID       = core.AttrInfo{Name: "ID", Type: core.INT}
+	blockGruppe   = core.AttrInfo{Name: "Gruppe", Type: core.INT}
+	blockMesswert = core.AttrInfo{Name: "Messwert", Type: core.INT}
+)
+
+// The number of rows of a block of the zone maps.
+const blockRows = 1 << 16
+
+// Creates the analyzed relation "bloecke" with five blocks. The IDs are sorted, the groups are
+// clustered by their blocks and the third block has only NULL values in "Messwert".
+func createBloecke(cs *core.ColumnStore) core.Relationer {
+	bloecke := cs.CreateRelation("bloecke", []core.AttrInfo{blockID, blockGruppe, blockMesswert})
+	values := make([][]interface{}, 4*blockRows+1000)
+	for i := range values {
+		var messwert interface{} = i % 1000
+		if i/blockRows == 2 {
+			messwert = nil
+		}
+		values[i] = []interface{}{i, i/blockRows*10 + i%10, messwert}
+	}
+	bloecke.Insert(values)
+	// the rows of the delta have no zone maps
+	bloecke.(*core.Relation).MergeDelta()
+	bloecke.Analyze()
+	return bloecke
+}
+
+// Checks that selections skip the blocks excluded by the zone maps, also after the relation was
+// saved and opened again, and that they return the rows of the scan filtered one by one.
+func TestZoneMapSkipping(t *testing.T) {
+	cs := new(core.ColumnStore)
+	bloecke := createBloecke(cs)
+	all := rowValues(bloecke)
+	last := len(all) - 1
+	value := func(row []interface{}, col int) (int, bool) {
+		v, ok := row[col].(int)
+		return v, ok
+	}
+
+	tests := []struct {
+		name     string
+		pred     core.Predicate
+		skipped  int
+		expected func(row []interface{}) bool
+	}{
+		{"first rows", core.Compare(blockID, core.LT, 1000), 4,
+			func(row []interface{}) bool { return row[0].(int) < 1000 }},
+		{"last blocks", core.Compare(blockID, core.GE, 3*blockRows), 3,
+			func(row []interface{}) bool { return row[0].(int) >= 3*blockRows }},
+		{"clustered groups", core.Between(blockGruppe, 20, 25), 4,
+			func(row []interface{}) bool { g := row[1].(int); return g >= 20 && g <= 25 }},
+		{"In", core.In(blockGruppe, 5, 45), 3,
+			func(row []interface{}) bool { g := row[1].(int); return g == 5 || g == 45 }},
+		{"block of NULL values", core.Compare(blockMesswert, core.EQ, 5), 1,
+			func(row []interface{}) bool { m, ok := value(row, 2); return ok && m == 5 }},
+		{"IsNull", core.IsNull(blockMesswert), 4,
+			func(row []interface{}) bool { return row[2] == nil }},
+		{"Or of both ends", core.Or(core.Compare(blockID, core.LT, 10), core.Compare(blockID, core.GT, last-10)), 3,
+			func(row []interface{}) bool { id := row[0].(int); return id < 10 || id > last-10 }},
+		{"And", core.And(core.Compare(blockGruppe, core.GE, 30), core.Compare(blockMesswert, core.LT, 3)), 3,
+			func(row []interface{}) bool { m, ok := value(row, 2); return row[1].(int) >= 30 && ok && m < 3 }},
+		{"small values", core.Compare(blockMesswert, core.LT, 3), 1,
+			func(row []interface{}) bool { m, ok := value(row, 2); return ok && m < 3 }},
+		{"Not without skipped blocks", core.Not(core.Compare(blockID, core.LT, 1000)), 0,
+			func(row []interface{}) bool { return row[0].(int) >= 1000 }},
+	}
+	check := func(state string, rel core.Relationer) {
+		t.Helper()
+		for _, test := range tests {
+			query := rel.SelectWhere(test.pred)
+			skipped := fmt.Sprintf("skipped blocks: %d of 5", test.skipped)
+			if plan := query.Explain(); !strings.Contains(plan, skipped) {
+				t.Errorf("%s: %s does not show %q:\n%s", state, test.name, skipped, plan)
+			}
+			got, expected := rowValues(query), filterValues(all, test.expected)
+			if len(got) != len(expected) || fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("%s: %s returned %d rows instead of %d.", state, test.name, len(got), len(expected))
+			}
+		}
+	}
+	check("analyzed", bloecke)
+
+	dir := t.TempDir()
+	cs.Save(dir)
+	opened := new(core.ColumnStore)
+	opened.Open(dir)
+	check("opened", opened.GetRelation("bloecke"))
+}